@@ -1,19 +1,137 @@
 package main
 
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
 // Representation of a network device's metadata (currently biased towards
 // optical data).
 type DeviceData struct {
 	Host         string
-	Error        string               `json:",omitempty"`
-	OpticsByPort map[uint]*OpticsData `json:",omitempty"`
+	Error        string                 `json:",omitempty"`
+	OpticsByPort map[PortID]*OpticsData `json:",omitempty"`
+
+	// Address the host resolved to, and its reverse DNS name (with -resolve).
+	ResolvedIP string `json:",omitempty"`
+	PTR        string `json:",omitempty"`
+
+	// Identification of the device (SNMPv2-MIB system group)
+	SysName     string `json:",omitempty"`
+	SysDescr    string `json:",omitempty"`
+	SysObjectID string `json:",omitempty"`
+
+	// Time the query of the device completed, which rates between runs are
+	// computed from (-counter-rates).
+	CollectedAt *time.Time `json:",omitempty"`
+
+	// Instrumentation of the query of the device
+	QueryDurationMs int64  `json:",omitempty"`
+	PDUCount        int    `json:",omitempty"`
+	SNMPVersion     string `json:",omitempty"` // "1", "2c" or "3"
+
+	// Ports discarded because they had no optical data (e.g. direct-attach
+	// cables), in ascending order.
+	DroppedPorts []PortID `json:",omitempty"`
+
+	// Number of implausible sensor readings discarded (with -sanitize only).
+	SuspectReadings int `json:",omitempty"`
+
+	// PDUs received that could not be mapped to the MIB, and a sample of them
+	// as "OID (type)" (with -debug-unmapped only).
+	UnmappedPDUCount  int      `json:",omitempty"`
+	UnmappedPDUSample []string `json:",omitempty"`
+}
+
+// Identifies a port of a device. Subport is only set for breakout (channelized)
+// interfaces when they are reported separately, and is 0 otherwise.
+type PortID struct {
+	Port    uint
+	Subport uint
+}
+
+// Formats the port as "P", or "P/S" for a subport.
+func (self PortID) String() string {
+	if self.Subport == 0 {
+		return strconv.FormatUint(uint64(self.Port), 10)
+	}
+	return fmt.Sprintf("%d/%d", self.Port, self.Subport)
+}
+
+func (self PortID) MarshalText() ([]byte, error) {
+	return []byte(self.String()), nil
+}
+
+// Parses a port as written by MarshalText, "P" or "P/S".
+func (self *PortID) UnmarshalText(text []byte) error {
+	port, subport := string(text), "0"
+	if i := strings.IndexByte(port, '/'); i >= 0 {
+		port, subport = port[:i], port[i+1:]
+	}
+
+	portNum, err := strconv.ParseUint(port, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid port '%s'", text)
+	}
+	subportNum, err := strconv.ParseUint(subport, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid port '%s'", text)
+	}
+
+	*self = PortID{Port: uint(portNum), Subport: uint(subportNum)}
+	return nil
+}
+
+func (self PortID) Less(other PortID) bool {
+	if self.Port != other.Port {
+		return self.Port < other.Port
+	}
+	return self.Subport < other.Subport
+}
+
+// Options of the compilation of MIB data into a DeviceData.
+type DeviceDataOptions struct {
+	// Report breakout ports separately, keyed by port/subport, instead of
+	// summing their values by physical port.
+	Breakout bool
+
+	// Keep ports without optical data (e.g. direct-attach cables or dark
+	// ports) instead of discarding them.
+	KeepEmptyOptics bool
+
+	// Discard sensor readings out of these ranges, if set.
+	SanityRanges *SanityRanges
+}
+
+// Converts an interface name to the port its data is keyed by.
+func (self *DeviceDataOptions) interfacePort(name string) (PortID, bool) {
+	port, ok := interfaceNameToPort(name)
+	if !self.Breakout {
+		port.Subport = 0
+	}
+	return port, ok
 }
 
 // Representation of a network device port's L3 and optical metrics.
 type OpticsData struct {
 	Speed uint64
 
-	// TODO: connector present? admin? oper?
-	// TODO: optical module vendor / model / serial
+	// Configured description of the port (ifAlias), e.g. "to-spine-01"
+	Description string `json:",omitempty"`
+
+	// TODO: connector present?
+	AdminStatus InterfaceAdminStatus `json:",omitempty"`
+	OperStatus  InterfaceOperStatus  `json:",omitempty"`
+
+	// Optical module identification, when exposed by the device
+	Vendor      string `json:",omitempty"`
+	Model       string `json:",omitempty"`
+	SerialNum   string `json:",omitempty"`
+	HardwareRev string `json:",omitempty"`
 
 	InErrors        uint64
 	InOctets        uint64
@@ -27,11 +145,23 @@ type OpticsData struct {
 	OutMulticastPkts uint64
 	OutBroadcastPkts uint64
 
+	// Whether counters come from 64-bit (ifXTable) or 32-bit (ifTable) ones.
+	UsingHCCounters bool
+
+	// Last time counters were reset or otherwise discontinued: deltas with a
+	// previous run are meaningless if it changed in between (by more than the
+	// latency of the queries, see discontinuityTolerance).
+	DiscontinuityTime *time.Time `json:",omitempty"`
+
 	// Lane 0 is the whole module, others ones are actual lanes
 	ModuleTemperature float32
 	ModuleVoltage     float32
-	LaneCount         uint32
+	LaneCount         uint32 // Highest of the reported count and lanes with data
 	SensorsByLane     map[uint]*OpticalSensor
+
+	// Power of the whole module, summed across lanes (dBm)
+	TotalRxPowerDbm float32
+	TotalTxPowerDbm float32
 }
 
 // Representation of an optical module's sensor data.
@@ -40,6 +170,19 @@ type OpticalSensor struct {
 	RxLaserPower       float32 // dBm
 	TxLaserBiasCurrent float32 // Amperes
 	TxLaserPower       float32 // dBm
+
+	// Whether power readings were set, as 0 dBm is a valid reading. Outputs of
+	// earlier versions lack them.
+	HasRxLaserPower bool `json:",omitempty"`
+	HasTxLaserPower bool `json:",omitempty"`
+}
+
+func (self *OpticalSensor) setRxLaserPower(dbm float32) {
+	self.RxLaserPower, self.HasRxLaserPower = dbm, true
+}
+
+func (self *OpticalSensor) setTxLaserPower(dbm float32) {
+	self.TxLaserPower, self.HasTxLaserPower = dbm, true
 }
 
 func (self *OpticalSensor) IsNonZero() bool {
@@ -49,24 +192,71 @@ func (self *OpticalSensor) IsNonZero() bool {
 
 // Compiles a given MIB dataset into a summary DeviceData. May cross-reference
 // entries between MIBs. May convert raw values into specific units/dimensions.
-// Currently filters out direct-attach cables and breakout configurations.
-func NewDeviceData(host string, mib *OpticsMIB) *DeviceData {
+// Filters out ports without optical data (e.g. direct-attach cables) and sums
+// breakout ports by physical port, unless told otherwise through options.
+func NewDeviceData(host string, mib *OpticsMIB, options DeviceDataOptions) *DeviceData {
 	opticsByID := make(map[uint]*OpticsData)
-	opticsByPort := make(map[uint]*OpticsData)
+	opticsByPort := make(map[PortID]*OpticsData)
+
+	extractInterfaceData(mib, &options, opticsByID, opticsByPort)
+	extractInterfaceHCData(mib, &options, opticsByPort)
+
+	// Vendor MIBs may share OID layouts: only trust the device's own, unless
+	// we cannot tell which it is.
+	switch detectVendor(mib) {
+	case VendorArista:
+		extractAristaData(mib, opticsByPort)
+	case VendorJuniper:
+		extractJuniperData(mib, opticsByID)
+	case VendorCisco:
+		extractCiscoData(mib, opticsByPort)
+	case VendorNokia:
+		extractNokiaData(mib, opticsByID)
+	default:
+		extractAristaData(mib, opticsByPort)
+		extractJuniperData(mib, opticsByID)
+		extractCiscoData(mib, opticsByPort)
+		extractNokiaData(mib, opticsByID)
+	}
 
-	extractInterfaceData(mib, opticsByID, opticsByPort)
-	extractInterfaceHCData(mib, opticsByPort)
+	// Unfortunately only available on Arista devices…
+	extractEntityData(mib, opticsByPort)
 
-	// TODO: detect vendor?
-	extractAristaData(mib, opticsByPort)
-	extractJuniperData(mib, opticsByID)
+	reconcileLaneCounts(opticsByPort)
+
+	suspectReadings := 0
+	if options.SanityRanges != nil {
+		suspectReadings = sanitizeOpticsData(opticsByPort, options.SanityRanges)
+	}
+
+	for _, optics := range opticsByPort {
+		optics.TotalRxPowerDbm = totalLanePower(optics, func(sensor *OpticalSensor) (float32, bool) {
+			return sensor.RxLaserPower, sensor.HasRxLaserPower
+		})
+		optics.TotalTxPowerDbm = totalLanePower(optics, func(sensor *OpticalSensor) (float32, bool) {
+			return sensor.TxLaserPower, sensor.HasTxLaserPower
+		})
+	}
+
+	validOpticsData := opticsByPort
+	var droppedPorts []PortID
+	if !options.KeepEmptyOptics {
+		validOpticsData = cleanupOpticsData(opticsByPort)
+		for _, port := range sortedPorts(opticsByPort) {
+			if _, ok := validOpticsData[port]; !ok {
+				droppedPorts = append(droppedPorts, port)
+			}
+		}
+	}
 
-	// TODO: matching for EntityPhysical to get manufacturer / serial etc.
-	//       (unfortunately only available on Arista devices…)
-	validOpticsData := cleanupOpticsData(opticsByPort)
 	return &DeviceData{
-		Host:         host,
-		OpticsByPort: validOpticsData,
+		Host:            host,
+		OpticsByPort:    validOpticsData,
+		SysName:         mib.System.Name,
+		SysDescr:        mib.System.Descr,
+		SysObjectID:     mib.System.ObjectID,
+		DroppedPorts:    droppedPorts,
+		SuspectReadings: suspectReadings,
 	}
 }
 
@@ -81,11 +271,12 @@ func NewDeviceDataError(host string, error string) *DeviceData {
 
 func extractInterfaceData(
 	mib *OpticsMIB,
+	options *DeviceDataOptions,
 	opticsByID map[uint]*OpticsData,
-	opticsByPort map[uint]*OpticsData,
+	opticsByPort map[PortID]*OpticsData,
 ) {
 	for id, entry := range mib.Interface {
-		port, ok := interfaceNameToPort(entry.Descr)
+		port, ok := options.interfacePort(entry.Descr)
 		if !ok {
 			continue
 		}
@@ -103,6 +294,14 @@ func extractInterfaceData(
 		// Speed is specified in bits/sec, but modern systems use megabits/sec
 		intf.Speed += uint64(entry.Speed) / 1000000
 
+		// A port is up as soon as one of its interfaces is.
+		if intf.AdminStatus == 0 || entry.AdminStatus == AdminUp {
+			intf.AdminStatus = entry.AdminStatus
+		}
+		if intf.OperStatus == 0 || entry.OperStatus == OperUp {
+			intf.OperStatus = entry.OperStatus
+		}
+
 		intf.InErrors += uint64(entry.InErrors)
 		intf.InOctets += uint64(entry.InOctets)
 		intf.InUnicastPkts += uint64(entry.InUcastPkts)
@@ -113,42 +312,105 @@ func extractInterfaceData(
 	}
 }
 
-func extractInterfaceHCData(mib *OpticsMIB, opticsByPort map[uint]*OpticsData) {
-	// As we summarize values by port, we should reset existing values if the
-	// device supports 64-bit counters.
-	if len(mib.InterfaceHC) > 0 {
-		for _, entry := range opticsByPort {
-			entry.Speed = 0
-			entry.InOctets = 0
-			entry.InUnicastPkts = 0
-			entry.OutOctets = 0
-			entry.OutUnicastPkts = 0
+func extractInterfaceHCData(
+	mib *OpticsMIB,
+	options *DeviceDataOptions,
+	opticsByPort map[PortID]*OpticsData,
+) {
+	// Sum values by port separately, as we only know which counters to use
+	// once all interfaces of a port are summed.
+	hcByPort := make(map[PortID]*OpticsData)
+	legacyByPort := make(map[PortID]*OpticsData)
+	descriptionIDs := make(map[PortID]uint)
+	for id, entry := range mib.InterfaceHC {
+		port, ok := options.interfacePort(entry.Name)
+		if !ok {
+			continue
+		}
+		if _, ok := opticsByPort[port]; !ok {
+			continue
 		}
-	}
 
-	for _, entry := range mib.InterfaceHC {
-		port, ok := interfaceNameToPort(entry.Name)
+		hc, ok := hcByPort[port]
 		if !ok {
-			continue
+			hc = &OpticsData{}
+			hcByPort[port] = hc
+			legacyByPort[port] = &OpticsData{}
+		}
+		legacy := legacyByPort[port]
+
+		// Use the description of the first interface of the port that has one,
+		// for stable results.
+		if entry.Alias != "" {
+			if prevID, ok := descriptionIDs[port]; !ok || id < prevID {
+				descriptionIDs[port] = id
+				opticsByPort[port].Description = entry.Alias
+			}
 		}
 
+		hc.Speed += entry.HighSpeed
+
+		hc.InOctets += entry.HCInOctets
+		hc.InUnicastPkts += entry.HCInUcastPkts
+		hc.InMulticastPkts += entry.HCInMulticastPkts
+		hc.InBroadcastPkts += entry.HCInBroadcastPkts
+		legacy.InMulticastPkts += uint64(entry.InMulticastPkts)
+		legacy.InBroadcastPkts += uint64(entry.InBroadcastPkts)
+
+		hc.OutOctets += entry.HCOutOctets
+		hc.OutUnicastPkts += entry.HCOutUcastPkts
+		hc.OutMulticastPkts += entry.HCOutMulticastPkts
+		hc.OutBroadcastPkts += entry.HCOutBroadcastPkts
+		legacy.OutMulticastPkts += uint64(entry.OutMulticastPkts)
+		legacy.OutBroadcastPkts += uint64(entry.OutBroadcastPkts)
+
+		// Boot time (hence this time) is estimated from the uptime, so it
+		// varies between runs with the latency of the query: it is only
+		// truncated to the second for readability, and must be compared with
+		// a tolerance (see discontinuityTolerance).
+		if !entry.CounterDiscontinuityTime.IsZero() {
+			intf := opticsByPort[port]
+			discontinuityTime := entry.CounterDiscontinuityTime.Truncate(time.Second)
+			if intf.DiscontinuityTime == nil || discontinuityTime.After(*intf.DiscontinuityTime) {
+				intf.DiscontinuityTime = &discontinuityTime
+			}
+		}
+	}
+
+	for port, hc := range hcByPort {
 		intf := opticsByPort[port]
 
-		intf.Speed += entry.HighSpeed
+		// ifSpeed saturates above 4Gbps, so prefer ifHighSpeed when available.
+		if hc.Speed > 0 {
+			intf.Speed = hc.Speed
+		}
 
-		intf.InOctets += entry.HCInOctets
-		intf.InUnicastPkts += entry.HCInUcastPkts
-		intf.InMulticastPkts += entry.HCInMulticastPkts
-		intf.InBroadcastPkts += entry.HCInBroadcastPkts
+		// Some devices report 64-bit counters stuck at zero while 32-bit ones
+		// tick: only use 64-bit counters when they are populated.
+		if hc.InOctets == 0 && hc.OutOctets == 0 {
+			legacy := legacyByPort[port]
+			intf.InMulticastPkts = legacy.InMulticastPkts
+			intf.InBroadcastPkts = legacy.InBroadcastPkts
+			intf.OutMulticastPkts = legacy.OutMulticastPkts
+			intf.OutBroadcastPkts = legacy.OutBroadcastPkts
+			continue
+		}
+
+		intf.UsingHCCounters = true
+
+		intf.InOctets = hc.InOctets
+		intf.InUnicastPkts = hc.InUnicastPkts
+		intf.InMulticastPkts = hc.InMulticastPkts
+		intf.InBroadcastPkts = hc.InBroadcastPkts
 
-		intf.OutOctets += entry.HCOutOctets
-		intf.OutUnicastPkts += entry.HCOutUcastPkts
-		intf.OutMulticastPkts += entry.HCOutMulticastPkts
-		intf.OutBroadcastPkts += entry.HCOutBroadcastPkts
+		intf.OutOctets = hc.OutOctets
+		intf.OutUnicastPkts = hc.OutUnicastPkts
+		intf.OutMulticastPkts = hc.OutMulticastPkts
+		intf.OutBroadcastPkts = hc.OutBroadcastPkts
 	}
 }
 
-func extractAristaData(mib *OpticsMIB, opticsByPort map[uint]*OpticsData) {
+func extractAristaData(mib *OpticsMIB, opticsByPort map[PortID]*OpticsData) {
 	const (
 		ModuleTemperatureSensor = 1
 		ModuleVoltageSensor     = 2
@@ -160,7 +422,8 @@ func extractAristaData(mib *OpticsMIB, opticsByPort map[uint]*OpticsData) {
 	)
 
 	for id, entry := range mib.Sensor {
-		// OID format for DOM sensors on Arista is 1003PP2LS:
+		// Sensor indexes (entPhysicalIndex, a single OID element) of DOM
+		// sensors on Arista are decimal numbers of the form 1003PP2LS:
 		//   PP: port number
 		//   L:  lane number (0 = module)
 		//   S:  sensor
@@ -170,45 +433,50 @@ func extractAristaData(mib *OpticsMIB, opticsByPort map[uint]*OpticsData) {
 			continue
 		}
 
+		// Do not report values the device itself declares stale or invalid.
+		if entry.OperStatus != SensorOk {
+			continue
+		}
+
 		// See above comment for details.
 		sub := id % 100000
 		port := sub / 1000
 		lane := (sub / 10) % 10
 		sensorId := sub % 10
 
-		intf := opticsByPort[port]
-
-		// Lane 0 is for module sensors (as opposed to individual lanes)
-		isModuleSensors := (lane == 0)
-
-		if isModuleSensors {
-			switch sensorId {
-			case ModuleTemperatureSensor:
-				intf.ModuleTemperature = entry.Float32()
-			case ModuleVoltageSensor:
-				intf.ModuleVoltage = entry.Float32()
-			}
-		} else {
-			sensor, ok := intf.SensorsByLane[lane]
-			if !ok {
-				sensor = &OpticalSensor{}
-				intf.SensorsByLane[lane] = sensor
-			}
-
-			// XXX: On PEs we have -1000000mW RX power on some down interfaces,
-			//      which causes NaN values as we compute logarithms.
-			//      We default to 1 because log(0) = -Inf.
-			if entry.Value < 0 {
-				entry.Value = 1
-			}
-
-			switch sensorId {
-			case TxLaserBiasCurrentSensor:
-				sensor.TxLaserBiasCurrent = entry.Float32()
-			case TxLaserPowerSensor:
-				sensor.TxLaserPower = wattsToDecibellMilliwatts(entry.Float32())
-			case RxLaserPowerSensor:
-				sensor.RxLaserPower = wattsToDecibellMilliwatts(entry.Float32())
+		// Sensors are per physical port: breakout ports share the same module.
+		for _, intf := range lookupPorts(opticsByPort, PortID{Port: port}) {
+			// Lane 0 is for module sensors (as opposed to individual lanes)
+			isModuleSensors := (lane == 0)
+
+			if isModuleSensors {
+				switch sensorId {
+				case ModuleTemperatureSensor:
+					intf.ModuleTemperature = entry.Float32()
+				case ModuleVoltageSensor:
+					intf.ModuleVoltage = entry.Float32()
+				}
+			} else {
+				sensor, ok := intf.SensorsByLane[lane]
+				if !ok {
+					sensor = &OpticalSensor{}
+					intf.SensorsByLane[lane] = sensor
+				}
+
+				// On PEs we have -1000000mW RX power on some down interfaces:
+				// non-positive power is clamped to the floor as "no signal".
+				switch sensorId {
+				case TxLaserBiasCurrentSensor:
+					sensor.TxLaserBiasCurrent = entry.Float32()
+				case TxLaserPowerSensor:
+					if power, ok := opticalPowerDBm(entry.Normalized()); ok {
+						sensor.setTxLaserPower(power)
+					}
+				case RxLaserPowerSensor:
+					if power, ok := opticalPowerDBm(entry.Normalized()); ok {
+						sensor.setRxLaserPower(power)
+					}
+				}
 			}
 		}
 	}
@@ -222,8 +490,8 @@ func extractJuniperData(mib *OpticsMIB, opticsByID map[uint]*OpticsData) {
 			continue
 		}
 
-		intf.ModuleTemperature = float32(entry.Temperature)
-		intf.ModuleVoltage = float32(entry.Voltage) / 1000
+		intf.ModuleTemperature = entry.Temperature
+		intf.ModuleVoltage = entry.Voltage
 		intf.LaneCount = uint32(entry.LaneCount)
 	}
 
@@ -245,18 +513,289 @@ func extractJuniperData(mib *OpticsMIB, opticsByID map[uint]*OpticsData) {
 				intf.SensorsByLane[lane] = sensor
 			}
 
-			sensor.LaserTemperature = float32(entry.LaserTemperature)
-			sensor.RxLaserPower = float32(entry.RxLaserPower) / 100
-			sensor.TxLaserBiasCurrent = float32(entry.TxLaserBiasCurrent) / 1000000
-			sensor.TxLaserPower = float32(entry.TxLaserPower) / 100
+			sensor.LaserTemperature = entry.LaserTemperature
+			sensor.setRxLaserPower(entry.RxLaserPower)
+			sensor.TxLaserBiasCurrent = entry.TxLaserBiasCurrent
+			sensor.setTxLaserPower(entry.TxLaserPower)
+		}
+	}
+}
+
+func extractNokiaData(mib *OpticsMIB, opticsByID map[uint]*OpticsData) {
+	// Port IDs are also used as interface indexes on SR OS.
+	// XXX: does not support multiple chassis, but should be OK.
+	for index, entry := range mib.NokiaDDM {
+		chassis, id := index[0], index[1]
+		if chassis != 1 {
+			continue
+		}
+
+		intf, ok := opticsByID[id]
+		if !ok {
+			continue
 		}
+
+		intf.ModuleTemperature = entry.Temperature
+		intf.ModuleVoltage = entry.SupplyVoltage
+
+		// Module-level values are those of the single lane of SFPs.
+		sensor := getOrCreateLaneSensor(intf, 1)
+		sensor.TxLaserBiasCurrent = entry.TxBiasCurrent
+		if entry.TxOutputPower > 0 {
+			sensor.setTxLaserPower(wattsToDecibellMilliwatts(entry.TxOutputPower))
+		}
+		if entry.RxOpticalPower > 0 {
+			sensor.setRxLaserPower(wattsToDecibellMilliwatts(entry.RxOpticalPower))
+		}
+	}
+}
+
+var ciscoLaneRegexp = regexp.MustCompile(`(?i)lane\s*(\d+)`)
+
+func extractCiscoData(mib *OpticsMIB, opticsByPort map[PortID]*OpticsData) {
+	for id, ciscoEntry := range mib.CiscoSensor {
+		entry := (*SensorEntry)(ciscoEntry)
+		if entry.OperStatus != SensorOk {
+			continue
+		}
+
+		// Sensors are physical entities, contained in the port they measure.
+		entity, ok := mib.Entity[id]
+		if !ok {
+			continue
+		}
+
+		port, ok := findEntityPort(mib.Entity, entity)
+		if !ok {
+			continue
+		}
+
+		// Sensors are per physical port: breakout ports share the same module.
+		intfs := lookupPorts(opticsByPort, port)
+		if len(intfs) == 0 {
+			continue
+		}
+
+		// Sensor names look like "Te0/0/0/5-Rx Lane 0 Pwr" or
+		// "HundredGigE0/0/0/1 Lane 2 Transmit Power Sensor". Cisco lane
+		// numbering starts at 0, but ours starts at 1. Sensors without lane are
+		// module sensors, or the single lane of the module for optical power.
+		descr := entity.Name + " " + entity.Descr
+		lane := uint(0)
+		if match := ciscoLaneRegexp.FindStringSubmatch(descr); match != nil {
+			if laneIdx, err := strconv.ParseUint(match[1], 10, 32); err == nil {
+				lane = uint(laneIdx) + 1
+			}
+		}
+
+		laneOrFirst := lane
+		if laneOrFirst == 0 {
+			laneOrFirst = 1
+		}
+
+		lowerDescr := strings.ToLower(descr)
+		isRx := strings.Contains(lowerDescr, "rx") || strings.Contains(lowerDescr, "receive")
+		isTx := strings.Contains(lowerDescr, "tx") || strings.Contains(lowerDescr, "transmit")
+
+		for _, intf := range intfs {
+			switch entry.Type {
+			case TypeCelsius:
+				if lane == 0 {
+					intf.ModuleTemperature = entry.Float32()
+				} else {
+					getOrCreateLaneSensor(intf, lane).LaserTemperature = entry.Float32()
+				}
+
+			case TypeVoltsDC:
+				if lane == 0 {
+					intf.ModuleVoltage = entry.Float32()
+				}
+
+			case TypeAmperes:
+				getOrCreateLaneSensor(intf, laneOrFirst).TxLaserBiasCurrent = entry.Float32()
+
+			case TypeWatts, CiscoTypeDBm:
+				power, _ := opticalPowerDBm(entry.Normalized())
+
+				if isRx {
+					getOrCreateLaneSensor(intf, laneOrFirst).setRxLaserPower(power)
+				} else if isTx {
+					getOrCreateLaneSensor(intf, laneOrFirst).setTxLaserPower(power)
+				}
+			}
+		}
+	}
+}
+
+// Converts a normalized optical power reading to dBm. Fails if the value is
+// not a power.
+func opticalPowerDBm(value float32, unit SensorDataType) (float32, bool) {
+	switch unit {
+	case TypeWatts:
+		return wattsToDecibellMilliwatts(value), true
+	case CiscoTypeDBm:
+		return value, true
+	}
+	return 0, false
+}
+
+// Walks up the containment hierarchy of an entity until one has a name that
+// can be converted to a port.
+func findEntityPort(
+	entities map[uint]*EntityPhysicalEntry,
+	entry *EntityPhysicalEntry,
+) (PortID, bool) {
+	// Bound the walk in case of a containment loop in device data.
+	for depth := 0; entry != nil && depth < 8; depth++ {
+		if port, ok := interfaceNameToPort(entry.Name); ok {
+			return port, true
+		}
+		if port, ok := interfaceNameToPort(entry.Descr); ok {
+			return port, true
+		}
+
+		if entry.ContainedIn <= 0 {
+			break
+		}
+		entry = entities[uint(entry.ContainedIn)]
+	}
+
+	return PortID{}, false
+}
+
+// Returns the data of a given port. A physical port (without subport) matches
+// all of its subports when breakout ports are reported separately, and a
+// subport matches its physical port otherwise.
+func lookupPorts(opticsByPort map[PortID]*OpticsData, port PortID) []*OpticsData {
+	if intf, ok := opticsByPort[port]; ok {
+		return []*OpticsData{intf}
+	}
+
+	if port.Subport != 0 {
+		if intf, ok := opticsByPort[PortID{Port: port.Port}]; ok {
+			return []*OpticsData{intf}
+		}
+		return nil
+	}
+
+	var intfs []*OpticsData
+	for id, intf := range opticsByPort {
+		if id.Port == port.Port {
+			intfs = append(intfs, intf)
+		}
+	}
+	return intfs
+}
+
+// Returns the sensor of a given lane, creating it if needed.
+func getOrCreateLaneSensor(intf *OpticsData, lane uint) *OpticalSensor {
+	sensor, ok := intf.SensorsByLane[lane]
+	if !ok {
+		sensor = &OpticalSensor{}
+		intf.SensorsByLane[lane] = sensor
+	}
+	return sensor
+}
+
+func extractEntityData(mib *OpticsMIB, opticsByPort map[PortID]*OpticsData) {
+	for _, entry := range mib.Entity {
+		if entry.Class != ClassPort {
+			continue
+		}
+
+		port, ok := interfaceNameToPort(entry.Name)
+		if !ok {
+			port, ok = interfaceNameToPort(entry.Descr)
+		}
+		if !ok {
+			continue
+		}
+
+		intfs := lookupPorts(opticsByPort, port)
+		if len(intfs) == 0 {
+			continue
+		}
+
+		module := findTransceiverEntity(mib.Entity, entry)
+		if module == nil {
+			continue
+		}
+
+		for _, intf := range intfs {
+			intf.Vendor = strings.TrimSpace(module.MfgName)
+			intf.Model = strings.TrimSpace(module.ModelName)
+			intf.SerialNum = strings.TrimSpace(module.SerialNum)
+			intf.HardwareRev = strings.TrimSpace(module.HardwareRev)
+		}
+	}
+}
+
+// Walks up the containment hierarchy of a port entity to find the module
+// holding its identification data (the transceiver). The port entity itself
+// is accepted, as some devices expose the data directly on it.
+func findTransceiverEntity(
+	entities map[uint]*EntityPhysicalEntry,
+	entry *EntityPhysicalEntry,
+) *EntityPhysicalEntry {
+	// Bound the walk in case of a containment loop in device data.
+	for depth := 0; entry != nil && depth < 8; depth++ {
+		if entry.SerialNum != "" || entry.MfgName != "" {
+			return entry
+		}
+
+		// Stop at chassis level: any data above does not describe the port.
+		if entry.Class == ClassChassis || entry.ContainedIn <= 0 {
+			return nil
+		}
+		entry = entities[uint(entry.ContainedIn)]
+	}
+
+	return nil
+}
+
+// Sets the lane count of ports to the highest lane with sensor data, unless
+// the device reported a higher one (e.g. lanes without sensor data).
+func reconcileLaneCounts(opticsByPort map[PortID]*OpticsData) {
+	for _, optics := range opticsByPort {
+		for lane := range optics.SensorsByLane {
+			if uint32(lane) > optics.LaneCount {
+				optics.LaneCount = uint32(lane)
+			}
+		}
+	}
+}
+
+// Sums a lane power reading across lanes, in the linear domain. Unset and
+// invalid readings are ignored. Returns the floor if no lane has a signal, or
+// 0 (unset) if there is no reading at all.
+func totalLanePower(optics *OpticsData, power func(*OpticalSensor) (float32, bool)) float32 {
+	var watts float64
+	noSignal := false
+	for _, sensor := range optics.SensorsByLane {
+		dbm, ok := power(sensor)
+		switch {
+		case !ok || math.IsNaN(float64(dbm)) || math.IsInf(float64(dbm), 0):
+			continue
+		case dbm <= powerFloorDBm:
+			noSignal = true
+		default:
+			watts += float64(decibellMilliwattsToWatts(dbm))
+		}
+	}
+
+	if watts > 0 {
+		return wattsToDecibellMilliwatts(float32(watts))
+	}
+	if noSignal {
+		return powerFloorDBm
 	}
+	return 0
 }
 
 // Discards ports that have no sensors, and lane that have nil/zero sensor
 // values. These are usually direct-attach cables or useless defaults.
-func cleanupOpticsData(opticsByPort map[uint]*OpticsData) map[uint]*OpticsData {
-	cleanData := make(map[uint]*OpticsData)
+func cleanupOpticsData(opticsByPort map[PortID]*OpticsData) map[PortID]*OpticsData {
+	cleanData := make(map[PortID]*OpticsData)
 	for port, entry := range opticsByPort {
 		// Discard entries with no lanes.
 		if len(entry.SensorsByLane) == 0 {
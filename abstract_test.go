@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+import (
+	"github.com/criteo/netopticon/snmpmagic"
+)
+
+import (
+	"github.com/soniah/gosnmp"
+)
+
+func TestReconcileLaneCounts(t *testing.T) {
+	testCases := []struct {
+		name     string
+		reported uint32
+		lanes    []uint
+		expected uint32
+	}{
+		{"no lanes", 0, nil, 0},
+		{"module sensors only", 0, []uint{0}, 0},
+		{"not reported", 0, []uint{1, 2, 3, 4}, 4},
+		{"reported, lanes without data", 4, []uint{1}, 4},
+		{"reported lower than lanes with data", 1, []uint{1, 2, 3, 4}, 4},
+		{"sparse lanes", 0, []uint{0, 2, 8}, 8},
+	}
+	for _, testCase := range testCases {
+		optics := &OpticsData{
+			LaneCount:     testCase.reported,
+			SensorsByLane: make(map[uint]*OpticalSensor),
+		}
+		for _, lane := range testCase.lanes {
+			optics.SensorsByLane[lane] = &OpticalSensor{RxLaserPower: -2}
+		}
+
+		reconcileLaneCounts(map[PortID]*OpticsData{{Port: 1}: optics})
+		if optics.LaneCount != testCase.expected {
+			t.Errorf("%s: got lane count %d, expected %d", testCase.name, optics.LaneCount, testCase.expected)
+		}
+	}
+}
+
+func TestNewDeviceDataLaneCount(t *testing.T) {
+	lane := func(rxPower float32) *JuniperModuleLaneDOMEntry {
+		return &JuniperModuleLaneDOMEntry{Entries: map[uint]*JuniperLaneDOMEntry{
+			501: {RxLaserPower: rxPower, TxLaserPower: -1, TxLaserBiasCurrent: 0.006},
+		}}
+	}
+	mib := &OpticsMIB{
+		Interface: map[uint]*InterfaceEntry{
+			501: {Descr: "et-0/0/0"},
+		},
+		// The module reports 4 lanes, but only has data for 2 of them.
+		JuniperDOM: map[uint]*JuniperModuleDOMEntry{
+			501: {Temperature: 40, LaneCount: 4},
+		},
+		JuniperLaneDOM: map[uint]*JuniperModuleLaneDOMEntry{0: lane(-2), 1: lane(-3)},
+	}
+
+	data := NewDeviceData("10.0.0.1", mib, DeviceDataOptions{})
+	optics := data.OpticsByPort[PortID{Port: 1}]
+	if optics == nil || len(optics.SensorsByLane) != 2 || optics.LaneCount != 4 {
+		t.Fatalf("expected 2 lanes with data out of 4, got %+v", optics)
+	}
+
+	// Lanes with data beyond the reported count are counted.
+	mib.JuniperDOM[501].LaneCount = 1
+	data = NewDeviceData("10.0.0.1", mib, DeviceDataOptions{})
+	if optics := data.OpticsByPort[PortID{Port: 1}]; optics.LaneCount != 2 {
+		t.Errorf("expected 2 lanes, got %d", optics.LaneCount)
+	}
+}
+
+func TestExtractCiscoData(t *testing.T) {
+	mib := &OpticsMIB{
+		Interface: map[uint]*InterfaceEntry{
+			5: {Descr: "TenGigE0/0/0/5"},
+		},
+		Entity: map[uint]*EntityPhysicalEntry{
+			10:  {Name: "TenGigE0/0/0/5"},
+			100: {Name: "Te0/0/0/5-Rx Lane 1 Pwr", ContainedIn: 10},
+			101: {Name: "Te0/0/0/5-Temp", ContainedIn: 10},
+			102: {Name: "Te0/0/0/5-Tx Lane 1 Pwr", ContainedIn: 10},
+		},
+		// Decoded as ENTITY-SENSOR-MIB values, in units (scale 9) with
+		// Precision decimal places.
+		CiscoSensor: map[uint]*CiscoSensorEntry{
+			100: {Type: CiscoTypeDBm, Scale: 9, Precision: 1, Value: -25, OperStatus: SensorOk},
+			101: {Type: TypeCelsius, Scale: 9, Precision: 0, Value: 40, OperStatus: SensorOk},
+			102: {Type: CiscoTypeDBm, Scale: 9, Precision: 1, Value: -10, OperStatus: SensorUnavailable},
+		},
+	}
+
+	data := NewDeviceData("10.0.0.1", mib, DeviceDataOptions{KeepEmptyOptics: true})
+	optics := data.OpticsByPort[PortID{Port: 6}]
+	if optics == nil || optics.ModuleTemperature != 40 {
+		t.Fatalf("expected a module temperature of 40 on port 6, got %+v", optics)
+	}
+	// Cisco lanes are numbered from 0, and sensors that are not ok are skipped.
+	sensor := optics.SensorsByLane[2]
+	if len(optics.SensorsByLane) != 1 || sensor == nil || sensor.RxLaserPower != -2.5 || sensor.TxLaserPower != 0 {
+		t.Errorf("expected lane 2 with an Rx power of -2.5 dBm, got %v", optics.SensorsByLane)
+	}
+}
+
+func TestExtractNokiaData(t *testing.T) {
+	var mib OpticsMIB
+	magic, err := snmpmagic.NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Port 1/1/5 (port ID 35815424) of chassis 1.
+	ddm := ".1.3.6.1.4.1.6527.3.1.2.2.4.31.1"
+	pdus := snmpmagic.PDUSlice{
+		{Name: ".1.3.6.1.2.1.2.2.1.2.35815424", Type: gosnmp.OctetString, Value: []byte("1/1/5, 10-Gig Ethernet")},
+		{Name: ddm + ".1.1.35815424", Type: gosnmp.Integer, Value: 38},
+		{Name: ddm + ".6.1.35815424", Type: gosnmp.Integer, Value: 32950},
+		{Name: ddm + ".11.1.35815424", Type: gosnmp.Integer, Value: 6500},
+		{Name: ddm + ".16.1.35815424", Type: gosnmp.Integer, Value: 5000},
+		{Name: ddm + ".21.1.35815424", Type: gosnmp.Integer, Value: 10000},
+	}
+	if err := magic.QueryWalker(context.Background(), pdus); err != nil {
+		t.Fatal(err)
+	}
+
+	data := NewDeviceData("10.0.0.1", &mib, DeviceDataOptions{})
+	optics := data.OpticsByPort[PortID{Port: 5}]
+	if optics == nil || optics.ModuleTemperature != 38 || !approxEqual(optics.ModuleVoltage, 3.295) {
+		t.Fatalf("unexpected module values: %+v", optics)
+	}
+	sensor := optics.SensorsByLane[1]
+	if sensor == nil || !approxEqual(sensor.TxLaserBiasCurrent, 0.0065) ||
+		!approxEqual(sensor.TxLaserPower, -3.0103) || !approxEqual(sensor.RxLaserPower, 0) {
+		t.Errorf("unexpected lane values: %+v", sensor)
+	}
+}
+
+func approxEqual(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 1e-4
+}
+
+func TestTotalLanePower(t *testing.T) {
+	defer func(floor float32) { powerFloorDBm = floor }(powerFloorDBm)
+	powerFloorDBm = -40
+
+	rx := func(sensor *OpticalSensor) (float32, bool) {
+		return sensor.RxLaserPower, sensor.HasRxLaserPower
+	}
+	testCases := []struct {
+		name     string
+		lanes    []float32 // Rx power by lane, NaN if unset
+		expected float32
+	}{
+		{"no lanes", nil, 0},
+		{"single lane", []float32{-2.5}, -2.5},
+		// 4 × 1 mW
+		{"0 dBm lanes", []float32{0, 0, 0, 0}, 6.0206},
+		{"unset lanes", []float32{0, float32(math.NaN()), 0}, 3.0103},
+		{"no reading", []float32{float32(math.NaN())}, 0},
+		{"no signal", []float32{-40, -40}, -40},
+		{"some lanes without signal", []float32{-40, -3.0103}, -3.0103},
+		// Many small readings do not lose precision
+		{"many lanes", []float32{-30, -30, -30, -30, -30, -30, -30, -30, -30, -30}, -20},
+	}
+	for _, testCase := range testCases {
+		optics := &OpticsData{SensorsByLane: make(map[uint]*OpticalSensor)}
+		for i, dbm := range testCase.lanes {
+			sensor := &OpticalSensor{}
+			if !math.IsNaN(float64(dbm)) {
+				sensor.setRxLaserPower(dbm)
+			}
+			optics.SensorsByLane[uint(i+1)] = sensor
+		}
+
+		if total := totalLanePower(optics, rx); !approxEqual(total, testCase.expected) {
+			t.Errorf("%s: got %v dBm, expected %v", testCase.name, total, testCase.expected)
+		}
+	}
+}
+
+func TestExtractInterfaceHCData(t *testing.T) {
+	newMIB := func(hc *InterfaceHCEntry) *OpticsMIB {
+		return &OpticsMIB{
+			Interface: map[uint]*InterfaceEntry{
+				1: {Descr: "Ethernet1", Speed: 4294967295, InOctets: 1000, OutOctets: 2000, InUcastPkts: 10, OutUcastPkts: 20},
+			},
+			InterfaceHC: map[uint]*InterfaceHCEntry{1: hc},
+		}
+	}
+	extract := func(mib *OpticsMIB) *OpticsData {
+		opticsByID := make(map[uint]*OpticsData)
+		opticsByPort := make(map[PortID]*OpticsData)
+		options := DeviceDataOptions{}
+		extractInterfaceData(mib, &options, opticsByID, opticsByPort)
+		extractInterfaceHCData(mib, &options, opticsByPort)
+		return opticsByPort[PortID{Port: 1}]
+	}
+
+	// Populated 64-bit counters override 32-bit ones.
+	optics := extract(newMIB(&InterfaceHCEntry{
+		Name:              "Ethernet1",
+		HighSpeed:         100000,
+		HCInOctets:        5000000000,
+		HCOutOctets:       6000000000,
+		HCInUcastPkts:     50,
+		HCOutUcastPkts:    60,
+		HCInMulticastPkts: 7,
+		InMulticastPkts:   3,
+	}))
+	if !optics.UsingHCCounters || optics.Speed != 100000 || optics.InOctets != 5000000000 ||
+		optics.OutOctets != 6000000000 || optics.InUnicastPkts != 50 || optics.InMulticastPkts != 7 {
+		t.Errorf("expected 64-bit counters, got %+v", optics)
+	}
+
+	// 64-bit counters stuck at zero are ignored, but not the rest of the table.
+	optics = extract(newMIB(&InterfaceHCEntry{
+		Name:            "Ethernet1",
+		HighSpeed:       100000,
+		InMulticastPkts: 3,
+		Alias:           "uplink",
+	}))
+	if optics.UsingHCCounters || optics.InOctets != 1000 || optics.OutOctets != 2000 ||
+		optics.InUnicastPkts != 10 || optics.OutUnicastPkts != 20 || optics.InMulticastPkts != 3 {
+		t.Errorf("expected 32-bit counters, got %+v", optics)
+	}
+	if optics.Speed != 100000 || optics.Description != "uplink" {
+		t.Errorf("expected the speed and description of the 64-bit table, got %+v", optics)
+	}
+}
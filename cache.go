@@ -0,0 +1,87 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Cache of device data for a given time, used by -serve so that repeated
+// queries of a host do not walk it again. Concurrent queries of a key that is
+// not cached share a single fetch.
+type resultCache struct {
+	ttl time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*cacheEntry
+	hits    uint64
+}
+
+type cacheEntry struct {
+	// Closed once data is fetched, after which entries are read-only.
+	ready  chan struct{}
+	data   *DeviceData
+	expiry time.Time
+}
+
+func newResultCache(ttl time.Duration) *resultCache {
+	return &resultCache{
+		ttl:     ttl,
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+// Returns the cached data of a key if it has not expired, or waits for the
+// fetch in progress for it, if any. Otherwise fetches it and caches it.
+func (self *resultCache) get(key string, fetch func() *DeviceData) *DeviceData {
+	self.mutex.Lock()
+	if entry, ok := self.entries[key]; ok {
+		select {
+		case <-entry.ready:
+			if time.Now().Before(entry.expiry) {
+				self.hits += 1
+				self.mutex.Unlock()
+				return entry.data
+			}
+		default:
+			self.hits += 1
+			self.mutex.Unlock()
+			<-entry.ready
+			return entry.data
+		}
+	}
+
+	self.evictExpired()
+	entry := &cacheEntry{ready: make(chan struct{})}
+	self.entries[key] = entry
+	self.mutex.Unlock()
+
+	entry.data = fetch()
+	entry.expiry = time.Now().Add(self.ttl)
+	close(entry.ready)
+
+	return entry.data
+}
+
+// Returns the number of queries answered from the cache, or by joining a
+// fetch in progress.
+func (self *resultCache) hitCount() uint64 {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return self.hits
+}
+
+// Removes expired entries, so that hosts no longer queried do not stay in
+// memory. The mutex must be held.
+func (self *resultCache) evictExpired() {
+	now := time.Now()
+	for key, entry := range self.entries {
+		select {
+		case <-entry.ready:
+			if !now.Before(entry.expiry) {
+				delete(self.entries, key)
+			}
+		default:
+		}
+	}
+}
@@ -0,0 +1,840 @@
+// Ingest API of the central collector netopticon pushes results to with
+// -grpc-target. Messages mirror DeviceData/OpticsData of the JSON outputs.
+//
+// Regenerate the Go code (collector.pb.go, collector_grpc.pb.go) with:
+//
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//       --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+//       collector/collector.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.33.0
+// 	protoc        (unknown)
+// source: collector/collector.proto
+
+package collector
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type DeviceData struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Host  string  `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`
+	Error string  `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	Ports []*Port `protobuf:"bytes,3,rep,name=ports,proto3" json:"ports,omitempty"`
+	// Start of the run the data was collected by.
+	GeneratedAt     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=generated_at,json=generatedAt,proto3" json:"generated_at,omitempty"`
+	ResolvedIp      string                 `protobuf:"bytes,5,opt,name=resolved_ip,json=resolvedIp,proto3" json:"resolved_ip,omitempty"`
+	Ptr             string                 `protobuf:"bytes,6,opt,name=ptr,proto3" json:"ptr,omitempty"`
+	SysName         string                 `protobuf:"bytes,7,opt,name=sys_name,json=sysName,proto3" json:"sys_name,omitempty"`
+	SysDescr        string                 `protobuf:"bytes,8,opt,name=sys_descr,json=sysDescr,proto3" json:"sys_descr,omitempty"`
+	SysObjectId     string                 `protobuf:"bytes,9,opt,name=sys_object_id,json=sysObjectId,proto3" json:"sys_object_id,omitempty"`
+	QueryDurationMs int64                  `protobuf:"varint,10,opt,name=query_duration_ms,json=queryDurationMs,proto3" json:"query_duration_ms,omitempty"`
+	PduCount        int64                  `protobuf:"varint,11,opt,name=pdu_count,json=pduCount,proto3" json:"pdu_count,omitempty"`
+	SnmpVersion     string                 `protobuf:"bytes,12,opt,name=snmp_version,json=snmpVersion,proto3" json:"snmp_version,omitempty"`
+	// As "port" or "port/subport".
+	DroppedPorts      []string `protobuf:"bytes,13,rep,name=dropped_ports,json=droppedPorts,proto3" json:"dropped_ports,omitempty"`
+	SuspectReadings   int64    `protobuf:"varint,14,opt,name=suspect_readings,json=suspectReadings,proto3" json:"suspect_readings,omitempty"`
+	UnmappedPduCount  int64    `protobuf:"varint,15,opt,name=unmapped_pdu_count,json=unmappedPduCount,proto3" json:"unmapped_pdu_count,omitempty"`
+	UnmappedPduSample []string `protobuf:"bytes,16,rep,name=unmapped_pdu_sample,json=unmappedPduSample,proto3" json:"unmapped_pdu_sample,omitempty"`
+}
+
+func (x *DeviceData) Reset() {
+	*x = DeviceData{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_collector_collector_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DeviceData) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeviceData) ProtoMessage() {}
+
+func (x *DeviceData) ProtoReflect() protoreflect.Message {
+	mi := &file_collector_collector_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeviceData.ProtoReflect.Descriptor instead.
+func (*DeviceData) Descriptor() ([]byte, []int) {
+	return file_collector_collector_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *DeviceData) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *DeviceData) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *DeviceData) GetPorts() []*Port {
+	if x != nil {
+		return x.Ports
+	}
+	return nil
+}
+
+func (x *DeviceData) GetGeneratedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.GeneratedAt
+	}
+	return nil
+}
+
+func (x *DeviceData) GetResolvedIp() string {
+	if x != nil {
+		return x.ResolvedIp
+	}
+	return ""
+}
+
+func (x *DeviceData) GetPtr() string {
+	if x != nil {
+		return x.Ptr
+	}
+	return ""
+}
+
+func (x *DeviceData) GetSysName() string {
+	if x != nil {
+		return x.SysName
+	}
+	return ""
+}
+
+func (x *DeviceData) GetSysDescr() string {
+	if x != nil {
+		return x.SysDescr
+	}
+	return ""
+}
+
+func (x *DeviceData) GetSysObjectId() string {
+	if x != nil {
+		return x.SysObjectId
+	}
+	return ""
+}
+
+func (x *DeviceData) GetQueryDurationMs() int64 {
+	if x != nil {
+		return x.QueryDurationMs
+	}
+	return 0
+}
+
+func (x *DeviceData) GetPduCount() int64 {
+	if x != nil {
+		return x.PduCount
+	}
+	return 0
+}
+
+func (x *DeviceData) GetSnmpVersion() string {
+	if x != nil {
+		return x.SnmpVersion
+	}
+	return ""
+}
+
+func (x *DeviceData) GetDroppedPorts() []string {
+	if x != nil {
+		return x.DroppedPorts
+	}
+	return nil
+}
+
+func (x *DeviceData) GetSuspectReadings() int64 {
+	if x != nil {
+		return x.SuspectReadings
+	}
+	return 0
+}
+
+func (x *DeviceData) GetUnmappedPduCount() int64 {
+	if x != nil {
+		return x.UnmappedPduCount
+	}
+	return 0
+}
+
+func (x *DeviceData) GetUnmappedPduSample() []string {
+	if x != nil {
+		return x.UnmappedPduSample
+	}
+	return nil
+}
+
+type Port struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Port        uint32 `protobuf:"varint,1,opt,name=port,proto3" json:"port,omitempty"`
+	Subport     uint32 `protobuf:"varint,2,opt,name=subport,proto3" json:"subport,omitempty"`
+	Speed       uint64 `protobuf:"varint,3,opt,name=speed,proto3" json:"speed,omitempty"`
+	Description string `protobuf:"bytes,4,opt,name=description,proto3" json:"description,omitempty"`
+	// As in JSON outputs, e.g. "up", "down".
+	AdminStatus       string                 `protobuf:"bytes,5,opt,name=admin_status,json=adminStatus,proto3" json:"admin_status,omitempty"`
+	OperStatus        string                 `protobuf:"bytes,6,opt,name=oper_status,json=operStatus,proto3" json:"oper_status,omitempty"`
+	Vendor            string                 `protobuf:"bytes,7,opt,name=vendor,proto3" json:"vendor,omitempty"`
+	Model             string                 `protobuf:"bytes,8,opt,name=model,proto3" json:"model,omitempty"`
+	SerialNum         string                 `protobuf:"bytes,9,opt,name=serial_num,json=serialNum,proto3" json:"serial_num,omitempty"`
+	HardwareRev       string                 `protobuf:"bytes,10,opt,name=hardware_rev,json=hardwareRev,proto3" json:"hardware_rev,omitempty"`
+	InErrors          uint64                 `protobuf:"varint,11,opt,name=in_errors,json=inErrors,proto3" json:"in_errors,omitempty"`
+	InOctets          uint64                 `protobuf:"varint,12,opt,name=in_octets,json=inOctets,proto3" json:"in_octets,omitempty"`
+	InUnicastPkts     uint64                 `protobuf:"varint,13,opt,name=in_unicast_pkts,json=inUnicastPkts,proto3" json:"in_unicast_pkts,omitempty"`
+	InMulticastPkts   uint64                 `protobuf:"varint,14,opt,name=in_multicast_pkts,json=inMulticastPkts,proto3" json:"in_multicast_pkts,omitempty"`
+	InBroadcastPkts   uint64                 `protobuf:"varint,15,opt,name=in_broadcast_pkts,json=inBroadcastPkts,proto3" json:"in_broadcast_pkts,omitempty"`
+	OutErrors         uint64                 `protobuf:"varint,16,opt,name=out_errors,json=outErrors,proto3" json:"out_errors,omitempty"`
+	OutOctets         uint64                 `protobuf:"varint,17,opt,name=out_octets,json=outOctets,proto3" json:"out_octets,omitempty"`
+	OutUnicastPkts    uint64                 `protobuf:"varint,18,opt,name=out_unicast_pkts,json=outUnicastPkts,proto3" json:"out_unicast_pkts,omitempty"`
+	OutMulticastPkts  uint64                 `protobuf:"varint,19,opt,name=out_multicast_pkts,json=outMulticastPkts,proto3" json:"out_multicast_pkts,omitempty"`
+	OutBroadcastPkts  uint64                 `protobuf:"varint,20,opt,name=out_broadcast_pkts,json=outBroadcastPkts,proto3" json:"out_broadcast_pkts,omitempty"`
+	UsingHcCounters   bool                   `protobuf:"varint,21,opt,name=using_hc_counters,json=usingHcCounters,proto3" json:"using_hc_counters,omitempty"`
+	DiscontinuityTime *timestamppb.Timestamp `protobuf:"bytes,22,opt,name=discontinuity_time,json=discontinuityTime,proto3" json:"discontinuity_time,omitempty"`
+	ModuleTemperature float32                `protobuf:"fixed32,23,opt,name=module_temperature,json=moduleTemperature,proto3" json:"module_temperature,omitempty"`
+	ModuleVoltage     float32                `protobuf:"fixed32,24,opt,name=module_voltage,json=moduleVoltage,proto3" json:"module_voltage,omitempty"`
+	LaneCount         uint32                 `protobuf:"varint,25,opt,name=lane_count,json=laneCount,proto3" json:"lane_count,omitempty"`
+	// Sorted by lane number, lane 0 being the whole module.
+	Lanes           []*Lane `protobuf:"bytes,26,rep,name=lanes,proto3" json:"lanes,omitempty"`
+	TotalRxPowerDbm float32 `protobuf:"fixed32,27,opt,name=total_rx_power_dbm,json=totalRxPowerDbm,proto3" json:"total_rx_power_dbm,omitempty"`
+	TotalTxPowerDbm float32 `protobuf:"fixed32,28,opt,name=total_tx_power_dbm,json=totalTxPowerDbm,proto3" json:"total_tx_power_dbm,omitempty"`
+}
+
+func (x *Port) Reset() {
+	*x = Port{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_collector_collector_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Port) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Port) ProtoMessage() {}
+
+func (x *Port) ProtoReflect() protoreflect.Message {
+	mi := &file_collector_collector_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Port.ProtoReflect.Descriptor instead.
+func (*Port) Descriptor() ([]byte, []int) {
+	return file_collector_collector_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Port) GetPort() uint32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *Port) GetSubport() uint32 {
+	if x != nil {
+		return x.Subport
+	}
+	return 0
+}
+
+func (x *Port) GetSpeed() uint64 {
+	if x != nil {
+		return x.Speed
+	}
+	return 0
+}
+
+func (x *Port) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Port) GetAdminStatus() string {
+	if x != nil {
+		return x.AdminStatus
+	}
+	return ""
+}
+
+func (x *Port) GetOperStatus() string {
+	if x != nil {
+		return x.OperStatus
+	}
+	return ""
+}
+
+func (x *Port) GetVendor() string {
+	if x != nil {
+		return x.Vendor
+	}
+	return ""
+}
+
+func (x *Port) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *Port) GetSerialNum() string {
+	if x != nil {
+		return x.SerialNum
+	}
+	return ""
+}
+
+func (x *Port) GetHardwareRev() string {
+	if x != nil {
+		return x.HardwareRev
+	}
+	return ""
+}
+
+func (x *Port) GetInErrors() uint64 {
+	if x != nil {
+		return x.InErrors
+	}
+	return 0
+}
+
+func (x *Port) GetInOctets() uint64 {
+	if x != nil {
+		return x.InOctets
+	}
+	return 0
+}
+
+func (x *Port) GetInUnicastPkts() uint64 {
+	if x != nil {
+		return x.InUnicastPkts
+	}
+	return 0
+}
+
+func (x *Port) GetInMulticastPkts() uint64 {
+	if x != nil {
+		return x.InMulticastPkts
+	}
+	return 0
+}
+
+func (x *Port) GetInBroadcastPkts() uint64 {
+	if x != nil {
+		return x.InBroadcastPkts
+	}
+	return 0
+}
+
+func (x *Port) GetOutErrors() uint64 {
+	if x != nil {
+		return x.OutErrors
+	}
+	return 0
+}
+
+func (x *Port) GetOutOctets() uint64 {
+	if x != nil {
+		return x.OutOctets
+	}
+	return 0
+}
+
+func (x *Port) GetOutUnicastPkts() uint64 {
+	if x != nil {
+		return x.OutUnicastPkts
+	}
+	return 0
+}
+
+func (x *Port) GetOutMulticastPkts() uint64 {
+	if x != nil {
+		return x.OutMulticastPkts
+	}
+	return 0
+}
+
+func (x *Port) GetOutBroadcastPkts() uint64 {
+	if x != nil {
+		return x.OutBroadcastPkts
+	}
+	return 0
+}
+
+func (x *Port) GetUsingHcCounters() bool {
+	if x != nil {
+		return x.UsingHcCounters
+	}
+	return false
+}
+
+func (x *Port) GetDiscontinuityTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.DiscontinuityTime
+	}
+	return nil
+}
+
+func (x *Port) GetModuleTemperature() float32 {
+	if x != nil {
+		return x.ModuleTemperature
+	}
+	return 0
+}
+
+func (x *Port) GetModuleVoltage() float32 {
+	if x != nil {
+		return x.ModuleVoltage
+	}
+	return 0
+}
+
+func (x *Port) GetLaneCount() uint32 {
+	if x != nil {
+		return x.LaneCount
+	}
+	return 0
+}
+
+func (x *Port) GetLanes() []*Lane {
+	if x != nil {
+		return x.Lanes
+	}
+	return nil
+}
+
+func (x *Port) GetTotalRxPowerDbm() float32 {
+	if x != nil {
+		return x.TotalRxPowerDbm
+	}
+	return 0
+}
+
+func (x *Port) GetTotalTxPowerDbm() float32 {
+	if x != nil {
+		return x.TotalTxPowerDbm
+	}
+	return 0
+}
+
+type Lane struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Lane               uint32  `protobuf:"varint,1,opt,name=lane,proto3" json:"lane,omitempty"`
+	LaserTemperature   float32 `protobuf:"fixed32,2,opt,name=laser_temperature,json=laserTemperature,proto3" json:"laser_temperature,omitempty"`
+	RxLaserPower       float32 `protobuf:"fixed32,3,opt,name=rx_laser_power,json=rxLaserPower,proto3" json:"rx_laser_power,omitempty"`
+	TxLaserBiasCurrent float32 `protobuf:"fixed32,4,opt,name=tx_laser_bias_current,json=txLaserBiasCurrent,proto3" json:"tx_laser_bias_current,omitempty"`
+	TxLaserPower       float32 `protobuf:"fixed32,5,opt,name=tx_laser_power,json=txLaserPower,proto3" json:"tx_laser_power,omitempty"`
+}
+
+func (x *Lane) Reset() {
+	*x = Lane{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_collector_collector_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Lane) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Lane) ProtoMessage() {}
+
+func (x *Lane) ProtoReflect() protoreflect.Message {
+	mi := &file_collector_collector_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Lane.ProtoReflect.Descriptor instead.
+func (*Lane) Descriptor() ([]byte, []int) {
+	return file_collector_collector_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Lane) GetLane() uint32 {
+	if x != nil {
+		return x.Lane
+	}
+	return 0
+}
+
+func (x *Lane) GetLaserTemperature() float32 {
+	if x != nil {
+		return x.LaserTemperature
+	}
+	return 0
+}
+
+func (x *Lane) GetRxLaserPower() float32 {
+	if x != nil {
+		return x.RxLaserPower
+	}
+	return 0
+}
+
+func (x *Lane) GetTxLaserBiasCurrent() float32 {
+	if x != nil {
+		return x.TxLaserBiasCurrent
+	}
+	return 0
+}
+
+func (x *Lane) GetTxLaserPower() float32 {
+	if x != nil {
+		return x.TxLaserPower
+	}
+	return 0
+}
+
+type PushSummary struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Number of devices received on the stream.
+	Received int64 `protobuf:"varint,1,opt,name=received,proto3" json:"received,omitempty"`
+}
+
+func (x *PushSummary) Reset() {
+	*x = PushSummary{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_collector_collector_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PushSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PushSummary) ProtoMessage() {}
+
+func (x *PushSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_collector_collector_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PushSummary.ProtoReflect.Descriptor instead.
+func (*PushSummary) Descriptor() ([]byte, []int) {
+	return file_collector_collector_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PushSummary) GetReceived() int64 {
+	if x != nil {
+		return x.Received
+	}
+	return 0
+}
+
+var File_collector_collector_proto protoreflect.FileDescriptor
+
+var file_collector_collector_proto_rawDesc = []byte{
+	0x0a, 0x19, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x2f, 0x63, 0x6f, 0x6c, 0x6c,
+	0x65, 0x63, 0x74, 0x6f, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x17, 0x6e, 0x65, 0x74,
+	0x6f, 0x70, 0x74, 0x69, 0x63, 0x6f, 0x6e, 0x2e, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x6f,
+	0x72, 0x2e, 0x76, 0x31, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xd3, 0x04, 0x0a, 0x0a, 0x44, 0x65, 0x76, 0x69, 0x63, 0x65,
+	0x44, 0x61, 0x74, 0x61, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f,
+	0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x33,
+	0x0a, 0x05, 0x70, 0x6f, 0x72, 0x74, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1d, 0x2e,
+	0x6e, 0x65, 0x74, 0x6f, 0x70, 0x74, 0x69, 0x63, 0x6f, 0x6e, 0x2e, 0x63, 0x6f, 0x6c, 0x6c, 0x65,
+	0x63, 0x74, 0x6f, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x6f, 0x72, 0x74, 0x52, 0x05, 0x70, 0x6f,
+	0x72, 0x74, 0x73, 0x12, 0x3d, 0x0a, 0x0c, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x64,
+	0x5f, 0x61, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65,
+	0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x0b, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x64,
+	0x41, 0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x72, 0x65, 0x73, 0x6f, 0x6c, 0x76, 0x65, 0x64, 0x5f, 0x69,
+	0x70, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x72, 0x65, 0x73, 0x6f, 0x6c, 0x76, 0x65,
+	0x64, 0x49, 0x70, 0x12, 0x10, 0x0a, 0x03, 0x70, 0x74, 0x72, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x03, 0x70, 0x74, 0x72, 0x12, 0x19, 0x0a, 0x08, 0x73, 0x79, 0x73, 0x5f, 0x6e, 0x61, 0x6d,
+	0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x73, 0x79, 0x73, 0x4e, 0x61, 0x6d, 0x65,
+	0x12, 0x1b, 0x0a, 0x09, 0x73, 0x79, 0x73, 0x5f, 0x64, 0x65, 0x73, 0x63, 0x72, 0x18, 0x08, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x08, 0x73, 0x79, 0x73, 0x44, 0x65, 0x73, 0x63, 0x72, 0x12, 0x22, 0x0a,
+	0x0d, 0x73, 0x79, 0x73, 0x5f, 0x6f, 0x62, 0x6a, 0x65, 0x63, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x09,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x73, 0x79, 0x73, 0x4f, 0x62, 0x6a, 0x65, 0x63, 0x74, 0x49,
+	0x64, 0x12, 0x2a, 0x0a, 0x11, 0x71, 0x75, 0x65, 0x72, 0x79, 0x5f, 0x64, 0x75, 0x72, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x5f, 0x6d, 0x73, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0f, 0x71, 0x75,
+	0x65, 0x72, 0x79, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4d, 0x73, 0x12, 0x1b, 0x0a,
+	0x09, 0x70, 0x64, 0x75, 0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x03,
+	0x52, 0x08, 0x70, 0x64, 0x75, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x21, 0x0a, 0x0c, 0x73, 0x6e,
+	0x6d, 0x70, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x0b, 0x73, 0x6e, 0x6d, 0x70, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x23, 0x0a,
+	0x0d, 0x64, 0x72, 0x6f, 0x70, 0x70, 0x65, 0x64, 0x5f, 0x70, 0x6f, 0x72, 0x74, 0x73, 0x18, 0x0d,
+	0x20, 0x03, 0x28, 0x09, 0x52, 0x0c, 0x64, 0x72, 0x6f, 0x70, 0x70, 0x65, 0x64, 0x50, 0x6f, 0x72,
+	0x74, 0x73, 0x12, 0x29, 0x0a, 0x10, 0x73, 0x75, 0x73, 0x70, 0x65, 0x63, 0x74, 0x5f, 0x72, 0x65,
+	0x61, 0x64, 0x69, 0x6e, 0x67, 0x73, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0f, 0x73, 0x75,
+	0x73, 0x70, 0x65, 0x63, 0x74, 0x52, 0x65, 0x61, 0x64, 0x69, 0x6e, 0x67, 0x73, 0x12, 0x2c, 0x0a,
+	0x12, 0x75, 0x6e, 0x6d, 0x61, 0x70, 0x70, 0x65, 0x64, 0x5f, 0x70, 0x64, 0x75, 0x5f, 0x63, 0x6f,
+	0x75, 0x6e, 0x74, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x03, 0x52, 0x10, 0x75, 0x6e, 0x6d, 0x61, 0x70,
+	0x70, 0x65, 0x64, 0x50, 0x64, 0x75, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x2e, 0x0a, 0x13, 0x75,
+	0x6e, 0x6d, 0x61, 0x70, 0x70, 0x65, 0x64, 0x5f, 0x70, 0x64, 0x75, 0x5f, 0x73, 0x61, 0x6d, 0x70,
+	0x6c, 0x65, 0x18, 0x10, 0x20, 0x03, 0x28, 0x09, 0x52, 0x11, 0x75, 0x6e, 0x6d, 0x61, 0x70, 0x70,
+	0x65, 0x64, 0x50, 0x64, 0x75, 0x53, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x22, 0x99, 0x08, 0x0a, 0x04,
+	0x50, 0x6f, 0x72, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x75, 0x62, 0x70,
+	0x6f, 0x72, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x73, 0x75, 0x62, 0x70, 0x6f,
+	0x72, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x70, 0x65, 0x65, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x04, 0x52, 0x05, 0x73, 0x70, 0x65, 0x65, 0x64, 0x12, 0x20, 0x0a, 0x0b, 0x64, 0x65, 0x73, 0x63,
+	0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x64,
+	0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x21, 0x0a, 0x0c, 0x61, 0x64,
+	0x6d, 0x69, 0x6e, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x0b, 0x61, 0x64, 0x6d, 0x69, 0x6e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x1f, 0x0a,
+	0x0b, 0x6f, 0x70, 0x65, 0x72, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x06, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0a, 0x6f, 0x70, 0x65, 0x72, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x16,
+	0x0a, 0x06, 0x76, 0x65, 0x6e, 0x64, 0x6f, 0x72, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
+	0x76, 0x65, 0x6e, 0x64, 0x6f, 0x72, 0x12, 0x14, 0x0a, 0x05, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x18,
+	0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x12, 0x1d, 0x0a, 0x0a,
+	0x73, 0x65, 0x72, 0x69, 0x61, 0x6c, 0x5f, 0x6e, 0x75, 0x6d, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x09, 0x73, 0x65, 0x72, 0x69, 0x61, 0x6c, 0x4e, 0x75, 0x6d, 0x12, 0x21, 0x0a, 0x0c, 0x68,
+	0x61, 0x72, 0x64, 0x77, 0x61, 0x72, 0x65, 0x5f, 0x72, 0x65, 0x76, 0x18, 0x0a, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0b, 0x68, 0x61, 0x72, 0x64, 0x77, 0x61, 0x72, 0x65, 0x52, 0x65, 0x76, 0x12, 0x1b,
+	0x0a, 0x09, 0x69, 0x6e, 0x5f, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x73, 0x18, 0x0b, 0x20, 0x01, 0x28,
+	0x04, 0x52, 0x08, 0x69, 0x6e, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x73, 0x12, 0x1b, 0x0a, 0x09, 0x69,
+	0x6e, 0x5f, 0x6f, 0x63, 0x74, 0x65, 0x74, 0x73, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08,
+	0x69, 0x6e, 0x4f, 0x63, 0x74, 0x65, 0x74, 0x73, 0x12, 0x26, 0x0a, 0x0f, 0x69, 0x6e, 0x5f, 0x75,
+	0x6e, 0x69, 0x63, 0x61, 0x73, 0x74, 0x5f, 0x70, 0x6b, 0x74, 0x73, 0x18, 0x0d, 0x20, 0x01, 0x28,
+	0x04, 0x52, 0x0d, 0x69, 0x6e, 0x55, 0x6e, 0x69, 0x63, 0x61, 0x73, 0x74, 0x50, 0x6b, 0x74, 0x73,
+	0x12, 0x2a, 0x0a, 0x11, 0x69, 0x6e, 0x5f, 0x6d, 0x75, 0x6c, 0x74, 0x69, 0x63, 0x61, 0x73, 0x74,
+	0x5f, 0x70, 0x6b, 0x74, 0x73, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0f, 0x69, 0x6e, 0x4d,
+	0x75, 0x6c, 0x74, 0x69, 0x63, 0x61, 0x73, 0x74, 0x50, 0x6b, 0x74, 0x73, 0x12, 0x2a, 0x0a, 0x11,
+	0x69, 0x6e, 0x5f, 0x62, 0x72, 0x6f, 0x61, 0x64, 0x63, 0x61, 0x73, 0x74, 0x5f, 0x70, 0x6b, 0x74,
+	0x73, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0f, 0x69, 0x6e, 0x42, 0x72, 0x6f, 0x61, 0x64,
+	0x63, 0x61, 0x73, 0x74, 0x50, 0x6b, 0x74, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x6f, 0x75, 0x74, 0x5f,
+	0x65, 0x72, 0x72, 0x6f, 0x72, 0x73, 0x18, 0x10, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09, 0x6f, 0x75,
+	0x74, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x6f, 0x75, 0x74, 0x5f, 0x6f,
+	0x63, 0x74, 0x65, 0x74, 0x73, 0x18, 0x11, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09, 0x6f, 0x75, 0x74,
+	0x4f, 0x63, 0x74, 0x65, 0x74, 0x73, 0x12, 0x28, 0x0a, 0x10, 0x6f, 0x75, 0x74, 0x5f, 0x75, 0x6e,
+	0x69, 0x63, 0x61, 0x73, 0x74, 0x5f, 0x70, 0x6b, 0x74, 0x73, 0x18, 0x12, 0x20, 0x01, 0x28, 0x04,
+	0x52, 0x0e, 0x6f, 0x75, 0x74, 0x55, 0x6e, 0x69, 0x63, 0x61, 0x73, 0x74, 0x50, 0x6b, 0x74, 0x73,
+	0x12, 0x2c, 0x0a, 0x12, 0x6f, 0x75, 0x74, 0x5f, 0x6d, 0x75, 0x6c, 0x74, 0x69, 0x63, 0x61, 0x73,
+	0x74, 0x5f, 0x70, 0x6b, 0x74, 0x73, 0x18, 0x13, 0x20, 0x01, 0x28, 0x04, 0x52, 0x10, 0x6f, 0x75,
+	0x74, 0x4d, 0x75, 0x6c, 0x74, 0x69, 0x63, 0x61, 0x73, 0x74, 0x50, 0x6b, 0x74, 0x73, 0x12, 0x2c,
+	0x0a, 0x12, 0x6f, 0x75, 0x74, 0x5f, 0x62, 0x72, 0x6f, 0x61, 0x64, 0x63, 0x61, 0x73, 0x74, 0x5f,
+	0x70, 0x6b, 0x74, 0x73, 0x18, 0x14, 0x20, 0x01, 0x28, 0x04, 0x52, 0x10, 0x6f, 0x75, 0x74, 0x42,
+	0x72, 0x6f, 0x61, 0x64, 0x63, 0x61, 0x73, 0x74, 0x50, 0x6b, 0x74, 0x73, 0x12, 0x2a, 0x0a, 0x11,
+	0x75, 0x73, 0x69, 0x6e, 0x67, 0x5f, 0x68, 0x63, 0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72,
+	0x73, 0x18, 0x15, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0f, 0x75, 0x73, 0x69, 0x6e, 0x67, 0x48, 0x63,
+	0x43, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72, 0x73, 0x12, 0x49, 0x0a, 0x12, 0x64, 0x69, 0x73, 0x63,
+	0x6f, 0x6e, 0x74, 0x69, 0x6e, 0x75, 0x69, 0x74, 0x79, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x16,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70,
+	0x52, 0x11, 0x64, 0x69, 0x73, 0x63, 0x6f, 0x6e, 0x74, 0x69, 0x6e, 0x75, 0x69, 0x74, 0x79, 0x54,
+	0x69, 0x6d, 0x65, 0x12, 0x2d, 0x0a, 0x12, 0x6d, 0x6f, 0x64, 0x75, 0x6c, 0x65, 0x5f, 0x74, 0x65,
+	0x6d, 0x70, 0x65, 0x72, 0x61, 0x74, 0x75, 0x72, 0x65, 0x18, 0x17, 0x20, 0x01, 0x28, 0x02, 0x52,
+	0x11, 0x6d, 0x6f, 0x64, 0x75, 0x6c, 0x65, 0x54, 0x65, 0x6d, 0x70, 0x65, 0x72, 0x61, 0x74, 0x75,
+	0x72, 0x65, 0x12, 0x25, 0x0a, 0x0e, 0x6d, 0x6f, 0x64, 0x75, 0x6c, 0x65, 0x5f, 0x76, 0x6f, 0x6c,
+	0x74, 0x61, 0x67, 0x65, 0x18, 0x18, 0x20, 0x01, 0x28, 0x02, 0x52, 0x0d, 0x6d, 0x6f, 0x64, 0x75,
+	0x6c, 0x65, 0x56, 0x6f, 0x6c, 0x74, 0x61, 0x67, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x6c, 0x61, 0x6e,
+	0x65, 0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x19, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x09, 0x6c,
+	0x61, 0x6e, 0x65, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x33, 0x0a, 0x05, 0x6c, 0x61, 0x6e, 0x65,
+	0x73, 0x18, 0x1a, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1d, 0x2e, 0x6e, 0x65, 0x74, 0x6f, 0x70, 0x74,
+	0x69, 0x63, 0x6f, 0x6e, 0x2e, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x2e, 0x76,
+	0x31, 0x2e, 0x4c, 0x61, 0x6e, 0x65, 0x52, 0x05, 0x6c, 0x61, 0x6e, 0x65, 0x73, 0x12, 0x2b, 0x0a,
+	0x12, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x5f, 0x72, 0x78, 0x5f, 0x70, 0x6f, 0x77, 0x65, 0x72, 0x5f,
+	0x64, 0x62, 0x6d, 0x18, 0x1b, 0x20, 0x01, 0x28, 0x02, 0x52, 0x0f, 0x74, 0x6f, 0x74, 0x61, 0x6c,
+	0x52, 0x78, 0x50, 0x6f, 0x77, 0x65, 0x72, 0x44, 0x62, 0x6d, 0x12, 0x2b, 0x0a, 0x12, 0x74, 0x6f,
+	0x74, 0x61, 0x6c, 0x5f, 0x74, 0x78, 0x5f, 0x70, 0x6f, 0x77, 0x65, 0x72, 0x5f, 0x64, 0x62, 0x6d,
+	0x18, 0x1c, 0x20, 0x01, 0x28, 0x02, 0x52, 0x0f, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x54, 0x78, 0x50,
+	0x6f, 0x77, 0x65, 0x72, 0x44, 0x62, 0x6d, 0x22, 0xc6, 0x01, 0x0a, 0x04, 0x4c, 0x61, 0x6e, 0x65,
+	0x12, 0x12, 0x0a, 0x04, 0x6c, 0x61, 0x6e, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04,
+	0x6c, 0x61, 0x6e, 0x65, 0x12, 0x2b, 0x0a, 0x11, 0x6c, 0x61, 0x73, 0x65, 0x72, 0x5f, 0x74, 0x65,
+	0x6d, 0x70, 0x65, 0x72, 0x61, 0x74, 0x75, 0x72, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x02, 0x52,
+	0x10, 0x6c, 0x61, 0x73, 0x65, 0x72, 0x54, 0x65, 0x6d, 0x70, 0x65, 0x72, 0x61, 0x74, 0x75, 0x72,
+	0x65, 0x12, 0x24, 0x0a, 0x0e, 0x72, 0x78, 0x5f, 0x6c, 0x61, 0x73, 0x65, 0x72, 0x5f, 0x70, 0x6f,
+	0x77, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x02, 0x52, 0x0c, 0x72, 0x78, 0x4c, 0x61, 0x73,
+	0x65, 0x72, 0x50, 0x6f, 0x77, 0x65, 0x72, 0x12, 0x31, 0x0a, 0x15, 0x74, 0x78, 0x5f, 0x6c, 0x61,
+	0x73, 0x65, 0x72, 0x5f, 0x62, 0x69, 0x61, 0x73, 0x5f, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x02, 0x52, 0x12, 0x74, 0x78, 0x4c, 0x61, 0x73, 0x65, 0x72, 0x42,
+	0x69, 0x61, 0x73, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x12, 0x24, 0x0a, 0x0e, 0x74, 0x78,
+	0x5f, 0x6c, 0x61, 0x73, 0x65, 0x72, 0x5f, 0x70, 0x6f, 0x77, 0x65, 0x72, 0x18, 0x05, 0x20, 0x01,
+	0x28, 0x02, 0x52, 0x0c, 0x74, 0x78, 0x4c, 0x61, 0x73, 0x65, 0x72, 0x50, 0x6f, 0x77, 0x65, 0x72,
+	0x22, 0x29, 0x0a, 0x0b, 0x50, 0x75, 0x73, 0x68, 0x53, 0x75, 0x6d, 0x6d, 0x61, 0x72, 0x79, 0x12,
+	0x1a, 0x0a, 0x08, 0x72, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x08, 0x72, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x64, 0x32, 0x6a, 0x0a, 0x09, 0x43,
+	0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x12, 0x5d, 0x0a, 0x0e, 0x50, 0x75, 0x73, 0x68,
+	0x44, 0x65, 0x76, 0x69, 0x63, 0x65, 0x44, 0x61, 0x74, 0x61, 0x12, 0x23, 0x2e, 0x6e, 0x65, 0x74,
+	0x6f, 0x70, 0x74, 0x69, 0x63, 0x6f, 0x6e, 0x2e, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x6f,
+	0x72, 0x2e, 0x76, 0x31, 0x2e, 0x44, 0x65, 0x76, 0x69, 0x63, 0x65, 0x44, 0x61, 0x74, 0x61, 0x1a,
+	0x24, 0x2e, 0x6e, 0x65, 0x74, 0x6f, 0x70, 0x74, 0x69, 0x63, 0x6f, 0x6e, 0x2e, 0x63, 0x6f, 0x6c,
+	0x6c, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x75, 0x73, 0x68, 0x53, 0x75,
+	0x6d, 0x6d, 0x61, 0x72, 0x79, 0x28, 0x01, 0x42, 0x28, 0x5a, 0x26, 0x67, 0x69, 0x74, 0x68, 0x75,
+	0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x63, 0x72, 0x69, 0x74, 0x65, 0x6f, 0x2f, 0x6e, 0x65, 0x74,
+	0x6f, 0x70, 0x74, 0x69, 0x63, 0x6f, 0x6e, 0x2f, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x6f,
+	0x72, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_collector_collector_proto_rawDescOnce sync.Once
+	file_collector_collector_proto_rawDescData = file_collector_collector_proto_rawDesc
+)
+
+func file_collector_collector_proto_rawDescGZIP() []byte {
+	file_collector_collector_proto_rawDescOnce.Do(func() {
+		file_collector_collector_proto_rawDescData = protoimpl.X.CompressGZIP(file_collector_collector_proto_rawDescData)
+	})
+	return file_collector_collector_proto_rawDescData
+}
+
+var file_collector_collector_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_collector_collector_proto_goTypes = []interface{}{
+	(*DeviceData)(nil),            // 0: netopticon.collector.v1.DeviceData
+	(*Port)(nil),                  // 1: netopticon.collector.v1.Port
+	(*Lane)(nil),                  // 2: netopticon.collector.v1.Lane
+	(*PushSummary)(nil),           // 3: netopticon.collector.v1.PushSummary
+	(*timestamppb.Timestamp)(nil), // 4: google.protobuf.Timestamp
+}
+var file_collector_collector_proto_depIdxs = []int32{
+	1, // 0: netopticon.collector.v1.DeviceData.ports:type_name -> netopticon.collector.v1.Port
+	4, // 1: netopticon.collector.v1.DeviceData.generated_at:type_name -> google.protobuf.Timestamp
+	4, // 2: netopticon.collector.v1.Port.discontinuity_time:type_name -> google.protobuf.Timestamp
+	2, // 3: netopticon.collector.v1.Port.lanes:type_name -> netopticon.collector.v1.Lane
+	0, // 4: netopticon.collector.v1.Collector.PushDeviceData:input_type -> netopticon.collector.v1.DeviceData
+	3, // 5: netopticon.collector.v1.Collector.PushDeviceData:output_type -> netopticon.collector.v1.PushSummary
+	5, // [5:6] is the sub-list for method output_type
+	4, // [4:5] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_collector_collector_proto_init() }
+func file_collector_collector_proto_init() {
+	if File_collector_collector_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_collector_collector_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeviceData); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_collector_collector_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Port); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_collector_collector_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Lane); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_collector_collector_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PushSummary); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_collector_collector_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_collector_collector_proto_goTypes,
+		DependencyIndexes: file_collector_collector_proto_depIdxs,
+		MessageInfos:      file_collector_collector_proto_msgTypes,
+	}.Build()
+	File_collector_collector_proto = out.File
+	file_collector_collector_proto_rawDesc = nil
+	file_collector_collector_proto_goTypes = nil
+	file_collector_collector_proto_depIdxs = nil
+}
@@ -0,0 +1,162 @@
+// Ingest API of the central collector netopticon pushes results to with
+// -grpc-target. Messages mirror DeviceData/OpticsData of the JSON outputs.
+//
+// Regenerate the Go code (collector.pb.go, collector_grpc.pb.go) with:
+//
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//       --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+//       collector/collector.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: collector/collector.proto
+
+package collector
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Collector_PushDeviceData_FullMethodName = "/netopticon.collector.v1.Collector/PushDeviceData"
+)
+
+// CollectorClient is the client API for Collector service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CollectorClient interface {
+	// Streams the data of each device as soon as it has been queried. The
+	// collector replies once the client closes the stream, which it does every
+	// few hundred devices. After a stream failure, devices sent on it may be
+	// sent again on the next stream: they are identified by host and run
+	// timestamp.
+	PushDeviceData(ctx context.Context, opts ...grpc.CallOption) (Collector_PushDeviceDataClient, error)
+}
+
+type collectorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCollectorClient(cc grpc.ClientConnInterface) CollectorClient {
+	return &collectorClient{cc}
+}
+
+func (c *collectorClient) PushDeviceData(ctx context.Context, opts ...grpc.CallOption) (Collector_PushDeviceDataClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Collector_ServiceDesc.Streams[0], Collector_PushDeviceData_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &collectorPushDeviceDataClient{stream}
+	return x, nil
+}
+
+type Collector_PushDeviceDataClient interface {
+	Send(*DeviceData) error
+	CloseAndRecv() (*PushSummary, error)
+	grpc.ClientStream
+}
+
+type collectorPushDeviceDataClient struct {
+	grpc.ClientStream
+}
+
+func (x *collectorPushDeviceDataClient) Send(m *DeviceData) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *collectorPushDeviceDataClient) CloseAndRecv() (*PushSummary, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(PushSummary)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CollectorServer is the server API for Collector service.
+// All implementations must embed UnimplementedCollectorServer
+// for forward compatibility
+type CollectorServer interface {
+	// Streams the data of each device as soon as it has been queried. The
+	// collector replies once the client closes the stream, which it does every
+	// few hundred devices. After a stream failure, devices sent on it may be
+	// sent again on the next stream: they are identified by host and run
+	// timestamp.
+	PushDeviceData(Collector_PushDeviceDataServer) error
+	mustEmbedUnimplementedCollectorServer()
+}
+
+// UnimplementedCollectorServer must be embedded to have forward compatible implementations.
+type UnimplementedCollectorServer struct {
+}
+
+func (UnimplementedCollectorServer) PushDeviceData(Collector_PushDeviceDataServer) error {
+	return status.Errorf(codes.Unimplemented, "method PushDeviceData not implemented")
+}
+func (UnimplementedCollectorServer) mustEmbedUnimplementedCollectorServer() {}
+
+// UnsafeCollectorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CollectorServer will
+// result in compilation errors.
+type UnsafeCollectorServer interface {
+	mustEmbedUnimplementedCollectorServer()
+}
+
+func RegisterCollectorServer(s grpc.ServiceRegistrar, srv CollectorServer) {
+	s.RegisterService(&Collector_ServiceDesc, srv)
+}
+
+func _Collector_PushDeviceData_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CollectorServer).PushDeviceData(&collectorPushDeviceDataServer{stream})
+}
+
+type Collector_PushDeviceDataServer interface {
+	SendAndClose(*PushSummary) error
+	Recv() (*DeviceData, error)
+	grpc.ServerStream
+}
+
+type collectorPushDeviceDataServer struct {
+	grpc.ServerStream
+}
+
+func (x *collectorPushDeviceDataServer) SendAndClose(m *PushSummary) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *collectorPushDeviceDataServer) Recv() (*DeviceData, error) {
+	m := new(DeviceData)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Collector_ServiceDesc is the grpc.ServiceDesc for Collector service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Collector_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "netopticon.collector.v1.Collector",
+	HandlerType: (*CollectorServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "PushDeviceData",
+			Handler:       _Collector_PushDeviceData_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "collector/collector.proto",
+}
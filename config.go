@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Settings loaded with -config, as a JSON object whose keys are flag names.
+// Flags given on the command line take precedence. Durations are strings
+// (e.g. "2s").
+type Config struct {
+	Out              *string  `json:"out"`
+	OutDir           *string  `json:"out-dir"`
+	Format           *string  `json:"format"`
+	Gzip             *bool    `json:"gzip"`
+	GRPCTarget       *string  `json:"grpc-target"`
+	GRPCInsecure     *bool    `json:"grpc-insecure"`
+	Resume           *string  `json:"resume"`
+	IP               *string  `json:"ip"`
+	Hosts            *string  `json:"hosts"`
+	Community        *string  `json:"community"`
+	Version          *string  `json:"version"`
+	V3               *bool    `json:"v3"`
+	User             *string  `json:"user"`
+	AuthProto        *string  `json:"auth-proto"`
+	AuthPass         *string  `json:"auth-pass"`
+	PrivProto        *string  `json:"priv-proto"`
+	PrivPass         *string  `json:"priv-pass"`
+	Timeout          *string  `json:"timeout"`
+	Retries          *int     `json:"retries"`
+	HostRetries      *int     `json:"host-retries"`
+	HostRetryBackoff *string  `json:"host-retry-backoff"`
+	MaxReps          *int     `json:"max-reps"`
+	NonRepeaters     *int     `json:"non-repeaters"`
+	MaxPDUs          *int     `json:"max-pdus"`
+	MIBs             *string  `json:"mibs"`
+	WalkMode         *string  `json:"walk-mode"`
+	RootParallelism  *int     `json:"root-parallelism"`
+	Concurrency      *int     `json:"concurrency"`
+	Serve            *string  `json:"serve"`
+	CacheTTL         *string  `json:"cache-ttl"`
+	ReuseConnections *bool    `json:"reuse-connections"`
+	Deterministic    *bool    `json:"deterministic"`
+	Breakout         *bool    `json:"breakout"`
+	KeepEmptyOptics  *bool    `json:"keep-empty-optics"`
+	Resolve          *bool    `json:"resolve"`
+	ResolvePTR       *bool    `json:"resolve-ptr"`
+	LanesAsArray     *bool    `json:"lanes-as-array"`
+	DebugUnmapped    *bool    `json:"debug-unmapped"`
+	Sanitize         *bool    `json:"sanitize"`
+	SanitizeRanges   *string  `json:"sanitize-ranges"`
+	DBmFloor         *float64 `json:"dbm-floor"`
+	Rate             *float64 `json:"rate"`
+	StartJitter      *string  `json:"start-jitter"`
+	Deadline         *string  `json:"deadline"`
+	MaxFailureRatio  *float64 `json:"max-failure-ratio"`
+	Record           *string  `json:"record"`
+	Replay           *string  `json:"replay"`
+	CheckMIB         *bool    `json:"check-mib"`
+
+	// Options of modes, for the defaults of their own flags.
+	DiffThreshold      *float64 `json:"diff-threshold"`
+	DiffFormat         *string  `json:"diff-format"`
+	CounterRatesFormat *string  `json:"counter-rates-format"`
+}
+
+// Flags that cannot be set in a configuration file: those selecting a mode
+// other than querying hosts (or the configuration itself), which are only
+// given on the command line.
+var cliOnlyFlags = map[string]bool{
+	"config":        true,
+	"cpuprofile":    true,
+	"dry-run":       true,
+	"selftest":      true,
+	"diff":          true,
+	"counter-rates": true,
+	"oid":           true,
+	"oid-tree-dot":  true,
+}
+
+// Loads a configuration file and applies its settings to flags that were not
+// given on the command line.
+func loadConfig(path string) error {
+	fin, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fin.Close()
+
+	var config Config
+	decoder := json.NewDecoder(fin)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return err
+	}
+
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	value := reflect.ValueOf(config)
+	for i := 0; i < value.NumField(); i++ {
+		name := value.Type().Field(i).Tag.Get("json")
+		field := value.Field(i)
+		if field.IsNil() || setFlags[name] {
+			continue
+		}
+
+		if err := flag.Set(name, fmt.Sprint(field.Elem().Interface())); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Checks that SNMPv2c and SNMPv3 settings are not mixed, whether they come
+// from the command line or a configuration file.
+func checkCredentialFlags() error {
+	var v2Flags, v3Flags []string
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "community", "version":
+			v2Flags = append(v2Flags, f.Name)
+		case "user", "auth-proto", "auth-pass", "priv-proto", "priv-pass":
+			v3Flags = append(v3Flags, f.Name)
+		}
+	})
+
+	if snmpV3 && len(v2Flags) > 0 {
+		return fmt.Errorf("-%s cannot be used with -v3", strings.Join(v2Flags, ", -"))
+	}
+	if !snmpV3 && len(v3Flags) > 0 {
+		return fmt.Errorf("SNMPv3 settings (-%s) require -v3", strings.Join(v3Flags, ", -"))
+	}
+	return nil
+}
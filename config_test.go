@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Every flag must be settable in a configuration file, unless command line
+// only.
+func TestConfigCoversFlags(t *testing.T) {
+	configKeys := make(map[string]bool)
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		configKeys[configType.Field(i).Tag.Get("json")] = true
+	}
+
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		// Flags of the testing package
+		if strings.HasPrefix(f.Name, "test.") {
+			return
+		}
+		if configKeys[f.Name] == cliOnlyFlags[f.Name] {
+			t.Errorf("flag -%s must be either in Config or in cliOnlyFlags", f.Name)
+		}
+	})
+	for key := range configKeys {
+		if flag.Lookup(key) == nil {
+			t.Errorf("config key %q is not a flag", key)
+		}
+	}
+	for name := range cliOnlyFlags {
+		if flag.Lookup(name) == nil {
+			t.Errorf("command line only flag -%s does not exist", name)
+		}
+	}
+}
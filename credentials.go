@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+import (
+	"github.com/soniah/gosnmp"
+)
+
+// SNMP credentials used to authenticate against a host. Community is only
+// used with SNMPv2c, the other fields only with SNMPv3 (USM).
+type Credentials struct {
+	Community string
+
+	V3        bool
+	User      string
+	AuthProto gosnmp.SnmpV3AuthProtocol
+	AuthPass  string
+	PrivProto gosnmp.SnmpV3PrivProtocol
+	PrivPass  string
+}
+
+// Builds SNMPv3 credentials from user-provided strings, checking that the
+// protocol names are supported and that the combination is valid.
+func NewV3Credentials(
+	user, authProto, authPass, privProto, privPass string,
+) (*Credentials, error) {
+	if user == "" {
+		return nil, errors.New("SNMPv3 requires a user name")
+	}
+
+	auth, err := parseAuthProtocol(authProto)
+	if err != nil {
+		return nil, err
+	}
+
+	priv, err := parsePrivProtocol(privProto)
+	if err != nil {
+		return nil, err
+	}
+
+	if auth == gosnmp.NoAuth && priv != gosnmp.NoPriv {
+		return nil, errors.New("SNMPv3 privacy requires an authentication protocol")
+	}
+
+	return &Credentials{
+		V3:        true,
+		User:      user,
+		AuthProto: auth,
+		AuthPass:  authPass,
+		PrivProto: priv,
+		PrivPass:  privPass,
+	}, nil
+}
+
+// Returns the SNMPv3 security level matching the configured protocols.
+func (self *Credentials) MsgFlags() gosnmp.SnmpV3MsgFlags {
+	if self.PrivProto != gosnmp.NoPriv {
+		return gosnmp.AuthPriv
+	}
+	if self.AuthProto != gosnmp.NoAuth {
+		return gosnmp.AuthNoPriv
+	}
+	return gosnmp.NoAuthNoPriv
+}
+
+// Configures the given client to use these credentials.
+func (self *Credentials) Apply(client *gosnmp.GoSNMP) {
+	if !self.V3 {
+		client.Version = gosnmp.Version2c
+		client.Community = self.Community
+		return
+	}
+
+	client.Version = gosnmp.Version3
+	client.SecurityModel = gosnmp.UserSecurityModel
+	client.MsgFlags = self.MsgFlags()
+	client.SecurityParameters = &gosnmp.UsmSecurityParameters{
+		UserName:                 self.User,
+		AuthenticationProtocol:   self.AuthProto,
+		AuthenticationPassphrase: self.AuthPass,
+		PrivacyProtocol:          self.PrivProto,
+		PrivacyPassphrase:        self.PrivPass,
+	}
+}
+
+func parseAuthProtocol(name string) (gosnmp.SnmpV3AuthProtocol, error) {
+	switch strings.ToUpper(name) {
+	case "", "NONE":
+		return gosnmp.NoAuth, nil
+	case "MD5":
+		return gosnmp.MD5, nil
+	case "SHA":
+		return gosnmp.SHA, nil
+	}
+
+	return gosnmp.NoAuth, fmt.Errorf("unsupported SNMPv3 auth protocol '%s'", name)
+}
+
+func parsePrivProtocol(name string) (gosnmp.SnmpV3PrivProtocol, error) {
+	switch strings.ToUpper(name) {
+	case "", "NONE":
+		return gosnmp.NoPriv, nil
+	case "DES":
+		return gosnmp.DES, nil
+	case "AES":
+		return gosnmp.AES, nil
+	}
+
+	return gosnmp.NoPriv, fmt.Errorf("unsupported SNMPv3 privacy protocol '%s'", name)
+}
+
+// Returns the credentials to use for a given host, with its own community if
+// it has one (SNMPv2c only).
+func (self *Credentials) ForHost(host HostSpec) *Credentials {
+	if self.V3 || host.Community == "" {
+		return self
+	}
+
+	credentials := *self
+	credentials.Community = host.Community
+	return &credentials
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Change between two outputs (-diff), of a host, port or lane.
+type Change struct {
+	Host string
+	Port *PortID `json:",omitempty"`
+	Lane uint    `json:",omitempty"`
+
+	// "host-added", "host-removed", "host-failed", "host-recovered",
+	// "port-added", "port-removed", "oper-status", "rx-power" or "tx-power".
+	Kind string
+
+	Old   interface{} `json:",omitempty"`
+	New   interface{} `json:",omitempty"`
+	Delta float32     `json:",omitempty"` // dB, for power changes
+}
+
+// Compares two outputs given as arguments (old then new), and prints their
+// changes as a table or JSON. Returns the exit status.
+func runDiff(args []string, thresholdDb float64, format string) int {
+	if len(args) != 2 {
+		fmt.Println("error: -diff takes two outputs to compare, old then new.")
+		return 1
+	}
+	if format != "table" && format != "json" {
+		fmt.Println("error: -diff-format must be 'table' or 'json'.")
+		return 1
+	}
+	if thresholdDb < 0 {
+		fmt.Println("error: -diff-threshold must be positive.")
+		return 1
+	}
+
+	oldResults, err := loadPreviousResults(args[0])
+	if err != nil {
+		fmt.Println("error: could not load old output:", err)
+		return 1
+	}
+	newResults, err := loadPreviousResults(args[1])
+	if err != nil {
+		fmt.Println("error: could not load new output:", err)
+		return 1
+	}
+
+	changes := diffResults(oldResults, newResults, float32(thresholdDb))
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(changes)
+	} else {
+		err = printChanges(os.Stdout, changes)
+	}
+	if err != nil {
+		fmt.Println("error:", err)
+		return 1
+	}
+	return 0
+}
+
+// Returns the changes between the data of two runs, sorted by host, port and
+// lane. Power changes are only reported from the given threshold (dB). Ports of
+// hosts that failed in either run are not compared.
+func diffResults(oldResults, newResults map[string]*DeviceData, thresholdDb float32) []*Change {
+	hosts := make([]string, 0, len(newResults))
+	for host := range newResults {
+		hosts = append(hosts, host)
+	}
+	for host := range oldResults {
+		if newResults[host] == nil {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Slice(hosts, func(i, j int) bool { return lessHost(hosts[i], hosts[j]) })
+
+	changes := []*Change{}
+	for _, host := range hosts {
+		oldData, newData := oldResults[host], newResults[host]
+		switch {
+		case oldData == nil:
+			changes = append(changes, &Change{Host: host, Kind: "host-added"})
+		case newData == nil:
+			changes = append(changes, &Change{Host: host, Kind: "host-removed"})
+		case oldData.Error == "" && newData.Error != "":
+			changes = append(changes, &Change{Host: host, Kind: "host-failed", New: newData.Error})
+		case oldData.Error != "" && newData.Error == "":
+			changes = append(changes, &Change{Host: host, Kind: "host-recovered", Old: oldData.Error})
+		case oldData.Error == "" && newData.Error == "":
+			changes = append(changes, diffPorts(host, oldData, newData, thresholdDb)...)
+		}
+	}
+	return changes
+}
+
+// Returns the changes of the ports of a host between two runs.
+func diffPorts(host string, oldData, newData *DeviceData, thresholdDb float32) []*Change {
+	ports := sortedPorts(newData.OpticsByPort)
+	for port := range oldData.OpticsByPort {
+		if newData.OpticsByPort[port] == nil {
+			ports = append(ports, port)
+		}
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Less(ports[j]) })
+
+	var changes []*Change
+	for i := range ports {
+		port := &ports[i]
+		oldOptics, newOptics := oldData.OpticsByPort[*port], newData.OpticsByPort[*port]
+		if oldOptics == nil {
+			changes = append(changes, &Change{Host: host, Port: port, Kind: "port-added"})
+			continue
+		}
+		if newOptics == nil {
+			changes = append(changes, &Change{Host: host, Port: port, Kind: "port-removed"})
+			continue
+		}
+
+		if oldOptics.OperStatus != newOptics.OperStatus {
+			changes = append(changes, &Change{
+				Host: host, Port: port, Kind: "oper-status",
+				Old: oldOptics.OperStatus, New: newOptics.OperStatus,
+			})
+		}
+
+		// Lanes missing from either run have nothing to compare.
+		for _, lane := range sortedLanes(newOptics.SensorsByLane) {
+			oldSensor := oldOptics.SensorsByLane[lane]
+			newSensor := newOptics.SensorsByLane[lane]
+			if oldSensor == nil || newSensor == nil {
+				continue
+			}
+
+			// Readings missing from either run (or discarded by -sanitize)
+			// have nothing to compare either.
+			powerChange := func(kind string, oldDbm, newDbm float32, present bool) {
+				if !present {
+					return
+				}
+				delta := newDbm - oldDbm
+				if math.Abs(float64(delta)) >= float64(thresholdDb) && delta != 0 {
+					changes = append(changes, &Change{
+						Host: host, Port: port, Lane: lane, Kind: kind,
+						Old: oldDbm, New: newDbm, Delta: delta,
+					})
+				}
+			}
+			powerChange(
+				"rx-power", oldSensor.RxLaserPower, newSensor.RxLaserPower,
+				oldSensor.HasRxLaserPower && newSensor.HasRxLaserPower,
+			)
+			powerChange(
+				"tx-power", oldSensor.TxLaserPower, newSensor.TxLaserPower,
+				oldSensor.HasTxLaserPower && newSensor.HasTxLaserPower,
+			)
+		}
+	}
+	return changes
+}
+
+// Prints changes as a table, one per line.
+func printChanges(w io.Writer, changes []*Change) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "HOST\tPORT\tLANE\tCHANGE\tOLD\tNEW\tDELTA")
+	for _, change := range changes {
+		port, lane, delta := "-", "-", "-"
+		if change.Port != nil {
+			port = change.Port.String()
+		}
+		if change.Lane != 0 {
+			lane = strconv.FormatUint(uint64(change.Lane), 10)
+		}
+		if change.Delta != 0 {
+			delta = fmt.Sprintf("%+.2f", change.Delta)
+		}
+		fmt.Fprintf(
+			table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			change.Host, port, lane, change.Kind,
+			formatChangeValue(change.Old), formatChangeValue(change.New), delta,
+		)
+	}
+	return table.Flush()
+}
+
+// Formats an old or new value of a change for the table.
+func formatChangeValue(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "-"
+	case float32:
+		return fmt.Sprintf("%.2f", value)
+	}
+	return fmt.Sprint(value)
+}
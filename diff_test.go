@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDiffResultsPowerReadings(t *testing.T) {
+	port := PortID{Port: 1}
+	result := func(sensors map[uint]*OpticalSensor) map[string]*DeviceData {
+		return map[string]*DeviceData{
+			"10.0.0.1": {
+				Host:         "10.0.0.1",
+				OpticsByPort: map[PortID]*OpticsData{port: {SensorsByLane: sensors}},
+			},
+		}
+	}
+
+	oldResults := result(map[uint]*OpticalSensor{
+		1: {RxLaserPower: -2, HasRxLaserPower: true, TxLaserPower: -1, HasTxLaserPower: true},
+		// Rx power missing in the old run
+		2: {TxLaserPower: -1, HasTxLaserPower: true},
+		3: {RxLaserPower: -2, HasRxLaserPower: true, TxLaserPower: -1, HasTxLaserPower: true},
+	})
+	newResults := result(map[uint]*OpticalSensor{
+		1: {RxLaserPower: -5, HasRxLaserPower: true, TxLaserPower: -1.5, HasTxLaserPower: true},
+		2: {RxLaserPower: -40, HasRxLaserPower: true, TxLaserPower: -1, HasTxLaserPower: true},
+		// Tx power discarded (e.g. by -sanitize) in the new run
+		3: {RxLaserPower: -2, HasRxLaserPower: true},
+	})
+
+	changes := diffResults(oldResults, newResults, 1)
+	if len(changes) != 1 {
+		t.Fatalf("expected a single change, got %d", len(changes))
+	}
+	change := changes[0]
+	if change.Kind != "rx-power" || change.Lane != 1 || change.Delta != -3 {
+		t.Errorf("unexpected change: %+v", change)
+	}
+}
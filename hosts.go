@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Maximum number of hosts a single CIDR block may expand to.
+const maxCIDRHosts = 65536
+
+// Host to query, with its own SNMPv2c community if it differs from the
+// default one.
+type HostSpec struct {
+	Target    string
+	Community string
+}
+
+// Builds a host list using both the host and hostfile CLI options.
+// Assumes hostfile contains one host per line, optionally followed by its
+// community (separated by a comma or spaces). Blank lines and lines starting
+// with '#' are ignored, and duplicate hosts are only kept once, with their
+// first community. Hosts may be given as host:port, or as CIDR blocks which
+// are expanded. A hostfile of "-" is read from stdin.
+func loadHostList() ([]HostSpec, error) {
+	var hosts []HostSpec
+	seen := make(map[string]int) // Index in hosts
+	addHost := func(entry string) error {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			return nil
+		}
+
+		fields := strings.FieldsFunc(entry, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})
+		if len(fields) > 2 {
+			return fmt.Errorf("invalid host entry '%s'", entry)
+		}
+		community := ""
+		if len(fields) == 2 {
+			community = fields[1]
+		}
+
+		expanded, err := expandHost(fields[0])
+		if err != nil {
+			return err
+		}
+		for _, host := range expanded {
+			index, ok := seen[host]
+			if !ok {
+				seen[host] = len(hosts)
+				hosts = append(hosts, HostSpec{Target: host, Community: community})
+			} else if hosts[index].Community != community {
+				log.Printf(
+					"WARNING: %s is listed several times with different communities, "+
+						"using the first one", host,
+				)
+			}
+		}
+		return nil
+	}
+
+	if snmpIP != "" {
+		if err := addHost(snmpIP); err != nil {
+			return nil, err
+		}
+	}
+
+	if snmpHostFile != "" {
+		// "-" reads the host list from stdin, e.g. from other inventory tools.
+		fin := os.Stdin
+		if snmpHostFile != "-" {
+			var err error
+			if fin, err = os.Open(snmpHostFile); err != nil {
+				return nil, err
+			}
+			defer fin.Close()
+		}
+
+		lines := bufio.NewScanner(fin)
+		for lines.Scan() {
+			if err := addHost(lines.Text()); err != nil {
+				return nil, err
+			}
+		}
+		if err := lines.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(hosts) == 0 && !dryRun {
+		return nil, errors.New("no host to query")
+	}
+
+	return hosts, nil
+}
+
+// Expands a host list entry into hosts: CIDR blocks are expanded to each of
+// their host addresses (excluding network and broadcast addresses for blocks
+// larger than /31), other entries are returned as-is.
+func expandHost(entry string) ([]string, error) {
+	if !strings.ContainsRune(entry, '/') {
+		return []string{entry}, nil
+	}
+
+	ip, ipNet, err := net.ParseCIDR(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	ones, bits := ipNet.Mask.Size()
+	if hostBits := bits - ones; hostBits >= 32 || 1<<uint(hostBits) > maxCIDRHosts {
+		return nil, fmt.Errorf(
+			"CIDR block %s is too large (more than %d hosts)", entry, maxCIDRHosts,
+		)
+	}
+
+	// Bare IP semantics for single-address blocks.
+	if ones == bits {
+		return []string{ip.String()}, nil
+	}
+
+	var hosts []string
+	for curr := ip.Mask(ipNet.Mask); ipNet.Contains(curr); curr = nextIP(curr) {
+		hosts = append(hosts, curr.String())
+	}
+
+	if bits-ones > 1 && ip.To4() != nil {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+
+	return hosts, nil
+}
+
+// Returns the IP address following the given one.
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i] += 1
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// Splits a host:port string. Port is 0 when not specified. IPv6 addresses
+// must be bracketed when followed by a port, and may be bracketed otherwise.
+func splitHostPort(host string) (string, uint16, error) {
+	if isIPv6Literal(host) || !strings.ContainsRune(host, ':') {
+		return host, 0, nil
+	}
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		return host[1 : len(host)-1], 0, nil
+	}
+
+	target, portStr, err := net.SplitHostPort(host)
+	if err != nil {
+		return "", 0, err
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port in '%s'", host)
+	}
+
+	return target, uint16(port), nil
+}
+
+// Checks whether a host is an IPv6 address, possibly with a zone (e.g.
+// fe80::1%eth0).
+func isIPv6Literal(host string) bool {
+	if zoneIdx := strings.IndexByte(host, '%'); zoneIdx > 0 {
+		host = host[:zoneIdx]
+	}
+	return strings.ContainsRune(host, ':') && net.ParseIP(host) != nil
+}
+
+// Orders hosts for stable outputs: IP addresses first, numerically (IPv4
+// before IPv6, then by port), then other hosts lexically.
+func lessHost(a, b string) bool {
+	aTarget, aPort, aErr := splitHostPort(a)
+	bTarget, bPort, bErr := splitHostPort(b)
+	if aErr != nil || bErr != nil {
+		return a < b
+	}
+
+	aIP, bIP := parseHostIP(aTarget), parseHostIP(bTarget)
+	switch {
+	case aIP == nil && bIP == nil:
+		return a < b
+	case aIP == nil || bIP == nil:
+		return aIP != nil
+	}
+
+	if aIsV4, bIsV4 := aIP.To4() != nil, bIP.To4() != nil; aIsV4 != bIsV4 {
+		return aIsV4
+	}
+	if cmp := bytes.Compare(aIP.To16(), bIP.To16()); cmp != 0 {
+		return cmp < 0
+	}
+	if aPort != bPort {
+		return aPort < bPort
+	}
+	return a < b
+}
+
+// Parses a host as an IP address, ignoring any IPv6 zone. Returns nil for host
+// names.
+func parseHostIP(host string) net.IP {
+	if zoneIdx := strings.IndexByte(host, '%'); zoneIdx > 0 {
+		host = host[:zoneIdx]
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Loads the host list from a hostfile with the given content.
+func loadTestHostList(t *testing.T, content string) []HostSpec {
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(ip, hostFile string) { snmpIP, snmpHostFile = ip, hostFile }(snmpIP, snmpHostFile)
+	snmpIP, snmpHostFile = "", path
+	hosts, err := loadHostList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hosts
+}
+
+func TestLoadHostList(t *testing.T) {
+	hosts := loadTestHostList(t, strings.Join([]string{
+		"# Spine switches",
+		"10.0.0.1\r",
+		"",
+		"   ",
+		"10.0.0.2, private\r",
+		"  # Leaf switches, with their own community",
+		"leaf1.example.com\tleaf\r",
+		"[2001:db8::1]:1161",
+		"10.0.0.1",
+	}, "\n"))
+
+	expected := []HostSpec{
+		{Target: "10.0.0.1"},
+		{Target: "10.0.0.2", Community: "private"},
+		{Target: "leaf1.example.com", Community: "leaf"},
+		{Target: "[2001:db8::1]:1161"},
+	}
+	if len(hosts) != len(expected) {
+		t.Fatalf("got hosts %v, expected %v", hosts, expected)
+	}
+	for i := range expected {
+		if hosts[i] != expected[i] {
+			t.Errorf("got host %v, expected %v", hosts[i], expected[i])
+		}
+	}
+}
+
+func TestLoadHostListDuplicateCommunities(t *testing.T) {
+	var hosts []HostSpec
+	output := captureLog(func() {
+		hosts = loadTestHostList(t, "10.0.0.1 public\n10.0.0.1 private\n10.0.0.2\n10.0.0.2\n")
+	})
+
+	if len(hosts) != 2 || hosts[0].Community != "public" {
+		t.Errorf("expected the first community to be kept, got %v", hosts)
+	}
+	// Only conflicting communities are reported
+	if strings.Count(output, "WARNING") != 1 || !strings.Contains(output, "10.0.0.1") {
+		t.Errorf("unexpected log output: %q", output)
+	}
+}
+
+// Returns what fn logs.
+func captureLog(fn func()) string {
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+
+	fn()
+	return output.String()
+}
+
+func TestExpandHost(t *testing.T) {
+	testCases := []struct {
+		entry    string
+		expected []string
+	}{
+		{"10.0.0.1", []string{"10.0.0.1"}},
+		{"switch1.example.com", []string{"switch1.example.com"}},
+		// Network and broadcast addresses are excluded
+		{"10.0.0.0/30", []string{"10.0.0.1", "10.0.0.2"}},
+		{"10.0.0.5/29", []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"}},
+		// Except for point-to-point and single-address blocks
+		{"10.0.0.2/31", []string{"10.0.0.2", "10.0.0.3"}},
+		{"10.0.0.7/32", []string{"10.0.0.7"}},
+		{"10.0.0.255/30", []string{"10.0.0.253", "10.0.0.254"}},
+		{"2001:db8::/126", []string{"2001:db8::", "2001:db8::1", "2001:db8::2", "2001:db8::3"}},
+		{"2001:db8::1/128", []string{"2001:db8::1"}},
+	}
+	for _, testCase := range testCases {
+		hosts, err := expandHost(testCase.entry)
+		if err != nil {
+			t.Errorf("%s: %v", testCase.entry, err)
+		} else if !equalStrings(hosts, testCase.expected) {
+			t.Errorf("%s: got %v, expected %v", testCase.entry, hosts, testCase.expected)
+		}
+	}
+
+	for _, entry := range []string{"10.0.0.0/33", "10.0.0/24", "10.0.0.0/8", "2001:db8::/64"} {
+		if hosts, err := expandHost(entry); err == nil {
+			t.Errorf("%s: expected an error, got %d hosts", entry, len(hosts))
+		}
+	}
+}
+
+func TestSplitHostPort(t *testing.T) {
+	testCases := []struct {
+		host   string
+		target string
+		port   uint16
+	}{
+		{"10.0.0.1", "10.0.0.1", 0},
+		{"10.0.0.1:1161", "10.0.0.1", 1161},
+		{"switch1.example.com:1161", "switch1.example.com", 1161},
+		{"2001:db8::1", "2001:db8::1", 0},
+		{"[2001:db8::1]", "2001:db8::1", 0},
+		{"[2001:db8::1]:1161", "2001:db8::1", 1161},
+		{"fe80::1%eth0", "fe80::1%eth0", 0},
+		{"[fe80::1%eth0]:161", "fe80::1%eth0", 161},
+	}
+	for _, testCase := range testCases {
+		target, port, err := splitHostPort(testCase.host)
+		if err != nil || target != testCase.target || port != testCase.port {
+			t.Errorf(
+				"%s: got %s, %d, %v, expected %s, %d",
+				testCase.host, target, port, err, testCase.target, testCase.port,
+			)
+		}
+	}
+
+	for _, host := range []string{"10.0.0.1:x", "10.0.0.1:70000", "2001:db8::1:x:1161"} {
+		if target, port, err := splitHostPort(host); err == nil {
+			t.Errorf("%s: expected an error, got %s, %d", host, target, port)
+		}
+	}
+}
+
+func TestLessHost(t *testing.T) {
+	expected := []string{
+		"10.0.0.2",
+		"10.0.0.10",
+		"10.0.0.10:1161",
+		"10.0.1.1",
+		"192.0.2.1",
+		"[2001:db8::2]",
+		"2001:db8::10",
+		"[2001:db8::10]:1161",
+		"fe80::1%eth0",
+		"leaf10.example.com",
+		"leaf2.example.com",
+		"spine1",
+	}
+
+	// Sorting any permutation gives the same order.
+	hosts := append([]string(nil), expected...)
+	for i := 0; i < 10; i++ {
+		rand.Shuffle(len(hosts), func(i, j int) { hosts[i], hosts[j] = hosts[j], hosts[i] })
+		sort.Slice(hosts, func(i, j int) bool { return lessHost(hosts[i], hosts[j]) })
+		if !equalStrings(hosts, expected) {
+			t.Fatalf("got order %v, expected %v", hosts, expected)
+		}
+	}
+
+	for _, host := range expected {
+		if lessHost(host, host) {
+			t.Errorf("%s is lower than itself", host)
+		}
+	}
+}
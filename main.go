@@ -2,13 +2,19 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"math/rand"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime/pprof"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -18,57 +24,503 @@ import (
 
 import (
 	"github.com/soniah/gosnmp"
+	"golang.org/x/time/rate"
 )
 
 var (
-	outputPath     string
-	snmpIP         string
-	snmpHostFile   string
-	snmpCommunity  string
-	concurrency    int
-	cpuProfilePath string
+	configPath      string
+	outputPath      string
+	outputDir       string
+	outputFormat    string
+	outputGzip      bool
+	grpcTarget      string
+	grpcInsecure    bool
+	resumePath      string
+	snmpIP          string
+	snmpHostFile    string
+	snmpCommunity   string
+	snmpVersion     string
+	snmpV3          bool
+	snmpUser        string
+	snmpAuthProto   string
+	snmpAuthPass    string
+	snmpPrivProto   string
+	snmpPrivPass    string
+	snmpTimeout     time.Duration
+	snmpRetries     int
+	hostRetries     int
+	hostBackoff     time.Duration
+	rootParallelism int
+	walkModeName    string
+	walkMode        snmpmagic.WalkMode
+	maxRepetitions  int
+	nonRepeaters    int
+	maxPDUs         int
+	concurrency     int
+	hostRate        float64
+	startJitter     time.Duration
+	runDeadline     time.Duration
+	maxFailureRatio float64
+	cpuProfilePath  string
+	dryRun          bool
+	recordDir       string
+	replayDir       string
+	breakoutPorts   bool
+	keepEmptyOptics bool
+	resolveHosts    bool
+	resolvePTR      bool
+	lanesAsArray    bool
+	debugUnmapped   bool
+	deterministic   bool
+	sanitize        bool
+	sanitizeRanges  string
+	sanityRanges    *SanityRanges
+	powerFloor      float64
+	oidTreeDOTPath  string
+	checkMIB        bool
+	selfTest        bool
+	diffMode        bool
+	diffThreshold   float64
+	diffFormat      string
+	counterRates    bool
+	ratesFormat     string
+	walkRoot        string
+	serveAddr       string
+	cacheTTL        time.Duration
+	reuseConns      bool
+	mibList         string
+	mibFields       []string
 )
 
 func init() {
+	flag.StringVar(
+		&configPath, "config", "",
+		"Path to a JSON file of settings keyed by flag name (overridden by flags)",
+	)
 	flag.StringVar(
 		&outputPath, "out", "netopticon-_TS_.json",
 		"Output file path ('_TS_' will be replaced with current timestamp)",
 	)
+	flag.StringVar(
+		&outputDir, "out-dir", "",
+		"Write the data of each host to its own JSON file '<host>.json' in this\n"+
+			"directory as soon as it is collected, instead of -out ('_TS_' will be\n"+
+			"replaced with current timestamp)",
+	)
+	flag.StringVar(
+		&outputFormat, "format", "json",
+		"Output format: 'json' (single object written at the end of the run),\n"+
+			"'json-flat' (same, without the schema version wrapper),\n"+
+			"'ndjson' (one object per host per line, written as results come in),\n"+
+			"'prometheus' (text exposition format),\n"+
+			"'influx' (InfluxDB line protocol, stamped with the run timestamp) or\n"+
+			"'csv' (one row per lane per port, written as results come in)",
+	)
+	flag.BoolVar(
+		&outputGzip, "gzip", false,
+		"Compress the output file with gzip (implied by a '.gz' suffix on -out)",
+	)
+	flag.StringVar(
+		&grpcTarget, "grpc-target", "",
+		"Stream the data of each host to a collector service at this gRPC target\n"+
+			"(e.g. 'collector:4317') as soon as it is collected, instead of -out",
+	)
+	flag.BoolVar(
+		&grpcInsecure, "grpc-insecure", false,
+		"Connect to -grpc-target in plaintext instead of TLS",
+	)
+	flag.StringVar(
+		&resumePath, "resume", "",
+		"Path to the output of a previous run (JSON file or -out-dir directory):\n"+
+			"hosts successfully queried then are not queried again, and their data is\n"+
+			"carried over to the output",
+	)
 	flag.StringVar(
 		&snmpIP, "ip", "",
-		"Adress of host to query",
+		"Adress of host to query (host, host:port or CIDR block)",
 	)
 	flag.StringVar(
 		&snmpHostFile, "hosts", "",
-		"Path to list of hosts to query",
+		"Path to list of hosts to query (one host, host:port or CIDR block per line),\n"+
+			"'-' for stdin",
 	)
 	flag.StringVar(
 		&snmpCommunity, "community", "public",
-		"SNMP community to use for query",
+		"SNMP community to use for query (ignored with -v3)",
+	)
+	flag.StringVar(
+		&snmpVersion, "version", "2c",
+		"SNMP version without -v3: '2c', '1', or 'auto' (probe each host with\n"+
+			"SNMPv2c, falling back to SNMPv1)",
+	)
+	flag.BoolVar(
+		&snmpV3, "v3", false,
+		"Use SNMPv3 (USM) instead of SNMPv2c",
+	)
+	flag.StringVar(
+		&snmpUser, "user", "",
+		"SNMPv3 user name",
+	)
+	flag.StringVar(
+		&snmpAuthProto, "auth-proto", "",
+		"SNMPv3 authentication protocol (MD5, SHA), empty for none",
+	)
+	flag.StringVar(
+		&snmpAuthPass, "auth-pass", "",
+		"SNMPv3 authentication passphrase",
+	)
+	flag.StringVar(
+		&snmpPrivProto, "priv-proto", "",
+		"SNMPv3 privacy protocol (DES, AES), empty for none",
+	)
+	flag.StringVar(
+		&snmpPrivPass, "priv-pass", "",
+		"SNMPv3 privacy passphrase",
+	)
+	flag.DurationVar(
+		&snmpTimeout, "timeout", 2*time.Second,
+		"Timeout of each SNMP request",
+	)
+	flag.IntVar(
+		&snmpRetries, "retries", 3,
+		"Number of retries of each SNMP request after a timeout",
+	)
+	flag.IntVar(
+		&hostRetries, "host-retries", 0,
+		"Number of times a host is queried again from scratch after a transient\n"+
+			"failure (e.g. timeout, connection refused)",
+	)
+	flag.DurationVar(
+		&hostBackoff, "host-retry-backoff", 5*time.Second,
+		"Delay before the first query retry of a host, doubled on each retry",
+	)
+	flag.IntVar(
+		&maxRepetitions, "max-reps", 50,
+		"GETBULK max-repetitions (1-255), lower it if large responses get dropped",
+	)
+	flag.IntVar(
+		&nonRepeaters, "non-repeaters", 0,
+		"GETBULK non-repeaters",
+	)
+	flag.IntVar(
+		&maxPDUs, "max-pdus", 0,
+		"Maximum number of PDUs handled per host, beyond which the query is stopped\n"+
+			"and the host reported as truncated (0 for no limit)",
+	)
+	flag.StringVar(
+		&mibList, "mibs", "",
+		"Comma-separated list of MIB groups to query, among System, Interface,\n"+
+			"InterfaceHC, Entity, Sensor, JuniperDOM, JuniperLaneDOM, CiscoSensor\n"+
+			"and NokiaDDM (case-insensitive), instead of all of them",
+	)
+	flag.StringVar(
+		&walkModeName, "walk-mode", "bulk",
+		"Walk requests: 'bulk' (GETBULK), 'next' (GETNEXT, for devices that do not\n"+
+			"support GETBULK) or 'auto' (GETBULK, falling back to GETNEXT on errors)",
+	)
+	flag.IntVar(
+		&rootParallelism, "root-parallelism", 4,
+		"Maximum number of MIB roots walked concurrently per host, each on its own\n"+
+			"connection (1 to use a single connection, for devices that reject\n"+
+			"concurrent sessions)",
 	)
 	flag.IntVar(
 		&concurrency, "concurrency", 8,
 		"Concurrency level (maximum number of hosts to contact at a given time)",
 	)
+	flag.BoolVar(
+		&reuseConns, "reuse-connections", false,
+		"Query hosts behind the same agent (same address and credentials) over\n"+
+			"the same connection, rather than opening one per host",
+	)
+	flag.BoolVar(
+		&deterministic, "deterministic", false,
+		"Query hosts in input order, each by the same worker across runs, and write\n"+
+			"results sorted by host once all are collected (for debugging)",
+	)
+	flag.BoolVar(
+		&breakoutPorts, "breakout", false,
+		"Report breakout (channelized) ports separately, keyed by 'port/subport',\n"+
+			"instead of summing them by physical port",
+	)
+	flag.BoolVar(
+		&keepEmptyOptics, "keep-empty-optics", false,
+		"Keep ports without optical data (e.g. direct-attach cables) in the output",
+	)
+	flag.BoolVar(
+		&resolveHosts, "resolve", false,
+		"Record the IP address each host resolves to (ResolvedIP), so that outputs\n"+
+			"can be cross-referenced whether hosts are listed by name or by IP",
+	)
+	flag.BoolVar(
+		&resolvePTR, "resolve-ptr", false,
+		"Also record the reverse DNS name of each host (PTR), implies -resolve",
+	)
+	flag.BoolVar(
+		&lanesAsArray, "lanes-as-array", false,
+		"In JSON outputs, write the lanes of each port as an array sorted by lane\n"+
+			"number instead of an object keyed by lane number",
+	)
+	flag.BoolVar(
+		&debugUnmapped, "debug-unmapped", false,
+		"Report the number of PDUs received that could not be mapped to the MIB,\n"+
+			"along with a sample of their OIDs and types",
+	)
+	flag.BoolVar(
+		&sanitize, "sanitize", false,
+		"Discard implausible sensor readings (e.g. +40 dBm) from buggy agents",
+	)
+	flag.StringVar(
+		&sanitizeRanges, "sanitize-ranges", "",
+		"Override plausible ranges used by -sanitize, as kind=min:max items\n"+
+			"separated by commas (kinds: power, temperature, voltage, bias)",
+	)
+	flag.Float64Var(
+		&powerFloor, "dbm-floor", -40,
+		"Optical power (dBm) reported for no signal or weaker readings",
+	)
+	flag.Float64Var(
+		&hostRate, "rate", 0,
+		"Maximum number of host queries started per second, across all workers\n"+
+			"(0 for no limit)",
+	)
+	flag.DurationVar(
+		&startJitter, "start-jitter", 0,
+		"Maximum random delay before querying each host, to spread load on shared\n"+
+			"devices (0 for none)",
+	)
+	flag.DurationVar(
+		&runDeadline, "deadline", 0,
+		"Maximum duration of the run, after which queries are stopped and partial\n"+
+			"results saved (0 for none)",
+	)
+	flag.Float64Var(
+		&maxFailureRatio, "max-failure-ratio", 1,
+		"Exit with a non-zero status if the ratio of failed hosts exceeds it (0-1)",
+	)
 	flag.StringVar(
 		&cpuProfilePath, "cpuprofile", "",
 		"Write CPU profile to path",
 	)
+	flag.BoolVar(
+		&dryRun, "dry-run", false,
+		"Print the query plan and host list, then exit without contacting hosts",
+	)
+	flag.StringVar(
+		&recordDir, "record", "",
+		"Record PDUs received from each host to a file in directory, for -replay",
+	)
+	flag.StringVar(
+		&replayDir, "replay", "",
+		"Read PDUs of each host from files in directory written by -record,\n"+
+			"instead of querying hosts",
+	)
+	flag.StringVar(
+		&oidTreeDOTPath, "oid-tree-dot", "",
+		"Write the OID tree as a Graphviz graph to path ('-' for stdout), then exit",
+	)
+	flag.BoolVar(
+		&selfTest, "selftest", false,
+		"Run the query and decoding pipeline on canned device data, print the\n"+
+			"result and PASS or FAIL, then exit",
+	)
+	flag.BoolVar(
+		&diffMode, "diff", false,
+		"Compare two outputs given as arguments after flags (old then new JSON\n"+
+			"file or -out-dir directory), print changes of optical power, link state\n"+
+			"and ports, then exit without contacting hosts",
+	)
+	flag.Float64Var(
+		&diffThreshold, "diff-threshold", 1,
+		"Minimum change of Rx/Tx power (dB) reported by -diff",
+	)
+	flag.StringVar(
+		&diffFormat, "diff-format", "table",
+		"Output format of -diff: 'table' or 'json'",
+	)
+	flag.BoolVar(
+		&counterRates, "counter-rates", false,
+		"Compute traffic and error rates of ports from the counters of two outputs\n"+
+			"given as arguments after flags (old then new), print them, then exit",
+	)
+	flag.StringVar(
+		&ratesFormat, "counter-rates-format", "table",
+		"Output format of -counter-rates: 'table' or 'json'",
+	)
+	flag.StringVar(
+		&walkRoot, "oid", "",
+		"Walk the subtree of an OID on hosts and print the raw PDUs received, then\n"+
+			"exit without mapping them to the optics MIB",
+	)
+	flag.StringVar(
+		&serveAddr, "serve", "",
+		"Serve HTTP on address (e.g. ':9116') instead of querying hosts once:\n"+
+			"'/query?target=HOST&format=FORMAT' queries a host on demand, and\n"+
+			"'/metrics' exposes metrics about netopticon itself",
+	)
+	flag.DurationVar(
+		&cacheTTL, "cache-ttl", 0,
+		"With -serve, answer queries of a host from its last result for this long\n"+
+			"instead of walking it again (0 to disable)",
+	)
+	flag.BoolVar(
+		&checkMIB, "check-mib", false,
+		"Check the MIB definition for mistakes first, and exit if any is found",
+	)
 }
 
 func main() {
 	// Take time at run start, absolute value rounded to closest 5 minutes
 	// Mon Jan 2 15:04:05 -0700 MST 2006
-	timestampStr := time.Now().Round(5 * time.Minute).Format("2006-01-02-1504")
+	timestamp := time.Now().Round(5 * time.Minute)
+	timestampStr := timestamp.Format("2006-01-02-1504")
 
 	flag.Parse()
-	if snmpIP == "" && snmpHostFile == "" {
+	if configPath != "" {
+		if err := loadConfig(configPath); err != nil {
+			fmt.Println("error: could not load config:", err)
+			os.Exit(1)
+		}
+	}
+	if err := checkCredentialFlags(); err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+
+	if checkMIB {
+		if errs := snmpmagic.ValidateMIBType(&OpticsMIB{}); len(errs) > 0 {
+			fmt.Println("error: invalid MIB definition:")
+			for _, err := range errs {
+				fmt.Println("-", err)
+			}
+			os.Exit(1)
+		}
+	}
+
+	if oidTreeDOTPath != "" {
+		if err := writeOIDTreeDOT(oidTreeDOTPath); err != nil {
+			log.Fatal("could not write OID tree: ", err)
+		}
+		return
+	}
+
+	if selfTest {
+		os.Exit(runSelfTest())
+	}
+
+	if diffMode {
+		os.Exit(runDiff(flag.Args(), diffThreshold, diffFormat))
+	}
+
+	if counterRates {
+		os.Exit(runCounterRates(flag.Args(), ratesFormat))
+	}
+
+	if snmpIP == "" && snmpHostFile == "" && !dryRun && serveAddr == "" {
 		fmt.Println("error: please provide a host IP or a host list file.")
 		fmt.Println()
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	if maxRepetitions < 1 || maxRepetitions > 255 {
+		fmt.Println("error: -max-reps must be between 1 and 255.")
+		os.Exit(1)
+	}
+	if nonRepeaters < 0 {
+		fmt.Println("error: -non-repeaters must be positive.")
+		os.Exit(1)
+	}
+	if concurrency < 1 {
+		fmt.Println("error: -concurrency must be at least 1.")
+		os.Exit(1)
+	}
+	if snmpVersion != "1" && snmpVersion != "2c" && snmpVersion != "auto" {
+		fmt.Println("error: -version must be '1', '2c' or 'auto'.")
+		os.Exit(1)
+	}
+	if hostRate < 0 {
+		fmt.Println("error: -rate must be positive.")
+		os.Exit(1)
+	}
+	if hostRate > 0 {
+		hostLimiter = rate.NewLimiter(rate.Limit(hostRate), 1)
+	}
+	if reuseConns {
+		connectionPool = newClientPool(concurrency)
+		defer connectionPool.close()
+	}
+	if hostRetries < 0 {
+		fmt.Println("error: -host-retries must be positive.")
+		os.Exit(1)
+	}
+	if outputDir != "" && outputFormat != "json" {
+		fmt.Println("error: -out-dir writes JSON files, -format cannot be used with it.")
+		os.Exit(1)
+	}
+	if grpcTarget != "" && (outputDir != "" || outputFormat != "json") {
+		fmt.Println("error: -grpc-target streams messages of its own, -out-dir and -format cannot be used with it.")
+		os.Exit(1)
+	}
+	if maxPDUs < 0 {
+		fmt.Println("error: -max-pdus must be positive.")
+		os.Exit(1)
+	}
+	if maxFailureRatio < 0 || maxFailureRatio > 1 {
+		fmt.Println("error: -max-failure-ratio must be between 0 and 1.")
+		os.Exit(1)
+	}
+	if resolveHosts || resolvePTR {
+		targetResolver = newHostResolver()
+	}
+
+	powerFloorDBm = float32(powerFloor)
+	jsonLanesAsArray = lanesAsArray
+
+	if sanitize {
+		ranges := defaultSanityRanges
+		if err := ranges.Parse(sanitizeRanges); err != nil {
+			fmt.Println("error: -sanitize-ranges:", err)
+			os.Exit(1)
+		}
+		sanityRanges = &ranges
+	}
+
+	var err error
+	if walkMode, err = snmpmagic.ParseWalkMode(walkModeName); err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+
+	for _, name := range strings.Split(mibList, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			mibFields = append(mibFields, name)
+		}
+	}
+	if err := checkMIBFields(mibFields); err != nil {
+		fmt.Println("error: -mibs:", err)
+		os.Exit(1)
+	}
+
+	if walkRoot != "" {
+		if _, err := snmpmagic.ParseOID(walkRoot); err != nil {
+			fmt.Println("error: -oid:", err)
+			os.Exit(1)
+		}
+	}
+
+	// Validate credentials before contacting any host
+	credentials := &Credentials{Community: snmpCommunity}
+	if snmpV3 {
+		credentials, err = NewV3Credentials(
+			snmpUser, snmpAuthProto, snmpAuthPass, snmpPrivProto, snmpPrivPass,
+		)
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+	}
+
 	if cpuProfilePath != "" {
 		f, err := os.Create(cpuProfilePath)
 		if err != nil {
@@ -80,117 +532,540 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	if serveAddr != "" {
+		if err := serve(serveAddr, credentials); err != nil {
+			log.Fatal("could not serve: ", err)
+		}
+		return
+	}
+
 	// Load hosts list from argument and possible file
 	hosts, err := loadHostList()
 	if err != nil {
 		log.Fatal("could not load host list: ", err)
 	}
 
-	// Check we can create and write to output file
-	outputPath = strings.Replace(outputPath, "_TS_", timestampStr, -1)
-	fout, err := os.Create(outputPath)
-	if err != nil {
-		log.Fatal("could not create output file: ", err)
+	if walkRoot != "" {
+		os.Exit(walkSubtree(hosts, credentials, walkRoot))
 	}
-	defer fout.Close()
 
-	// Use buffered channels to reduce blocking
-	work := make(chan string, concurrency)
-	results := make(chan *DeviceData, concurrency)
+	// Skip hosts successfully queried by a previous run
+	var resumed []*DeviceData
+	if resumePath != "" {
+		previous, err := loadPreviousResults(resumePath)
+		if err != nil {
+			log.Fatal("could not load previous results: ", err)
+		}
+		hosts, resumed = splitResumedHosts(hosts, previous)
+		log.Printf("resuming: %d hosts already queried, %d left", len(resumed), len(hosts))
+	}
 
-	// Spawn requested quantity of workers
+	if dryRun {
+		printQueryPlan(hosts)
+		return
+	}
+
+	// Validate the MIB structure once, as queries are built lazily by workers
+	if _, err := snmpmagic.BuildOIDTree(&OpticsMIB{}); err != nil {
+		log.Fatal("invalid MIB structure: ", err)
+	}
+
+	// Cancel queries on first SIGINT/SIGTERM, a second one kills the process
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if runDeadline > 0 {
+		ctx, cancel = context.WithTimeout(ctx, runDeadline)
+		defer cancel()
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Println("received", sig, "- stopping queries and saving partial results")
+		signal.Stop(signals)
+		cancel()
+	}()
+
+	// Check we can create and write to output file, or directory with -out-dir,
+	// or reach the collector with -grpc-target
+	var writer OutputWriter
+	var fout *outputFile
+	abort := func() {
+		if fout != nil {
+			fout.Abort()
+		}
+	}
+	if grpcTarget != "" {
+		writer, err = newGRPCOutputWriter(ctx, grpcTarget, grpcInsecure, timestamp)
+		if err != nil {
+			log.Fatal("could not connect to collector: ", err)
+		}
+	} else if outputDir != "" {
+		outputDir = strings.Replace(outputDir, "_TS_", timestampStr, -1)
+		writer, err = newDirOutputWriter(outputDir, outputGzip)
+		if err != nil {
+			log.Fatal("could not create output directory: ", err)
+		}
+	} else {
+		outputPath = strings.Replace(outputPath, "_TS_", timestampStr, -1)
+		compress := outputGzip || strings.HasSuffix(outputPath, ".gz")
+		fout, err = createOutputFile(outputPath, compress)
+		if err != nil {
+			log.Fatal("could not create output file: ", err)
+		}
+
+		writer, err = NewOutputWriter(outputFormat, fout, timestamp)
+		if err != nil {
+			fout.Abort()
+			log.Fatal("could not create output writer: ", err)
+		}
+	}
+
+	// Queue all hosts upfront so that workers never wait for the dispatcher.
+	// Workers share a single queue, unless in deterministic mode where each
+	// worker has its own queue of every concurrency-th host, in input order.
+	workQueues := make([]chan HostSpec, 1)
+	if deterministic {
+		workQueues = make([]chan HostSpec, concurrency)
+	}
+	for i := range workQueues {
+		workQueues[i] = make(chan HostSpec, len(hosts))
+	}
+	for i, host := range hosts {
+		workQueues[i%len(workQueues)] <- host
+	}
+	for _, work := range workQueues {
+		close(work)
+	}
+
+	// Spawn requested quantity of workers, and close results once all are done
+	results := make(chan *DeviceData, concurrency)
+	var workers sync.WaitGroup
 	for i := 0; i < concurrency; i++ {
-		// Dumb worker grabs tasks from a channel and outputs results in another
+		workers.Add(1)
+
+		// Dumb worker grabs tasks from a channel and outputs results in another,
+		// stops picking up tasks on cancellation.
+		work := workQueues[i%len(workQueues)]
 		go func() {
+			defer workers.Done()
 			for host := range work {
-				results <- fetch(host, snmpCommunity)
+				if ctx.Err() != nil {
+					return
+				}
+
+				query := opticsQueryPool.Get().(*opticsQuery)
+				results <- fetch(ctx, host.Target, credentials.ForHost(host), query)
+				query.magic.Reset()
+				opticsQueryPool.Put(query)
 			}
 		}()
 	}
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
 
-	// Continue looping as long as one of there are tasks that either:
-	// - have to be distributed
-	// - are waiting to be picked up
-	// - are being processed (in-flight)
-	// - have results waiting to be picked up
-	output := make(map[string]*DeviceData)
-	currTask := 0
-	inFlight := 0
-	for currTask < len(hosts) || len(work) > 0 || inFlight > 0 || len(results) > 0 {
-		select {
-		case unit := <-results:
-			output[unit.Host] = unit
-			inFlight -= 1
-		default:
-			time.Sleep(50 * time.Millisecond)
+	// Write results as they arrive, so that streaming formats can be followed,
+	// or once all are there in deterministic mode, sorted by host.
+	var sortedUnits []*DeviceData
+	write := func(unit *DeviceData) {
+		if deterministic {
+			sortedUnits = append(sortedUnits, unit)
+			return
+		}
+		if err := writer.Write(unit); err != nil {
+			abort()
+			log.Fatal("could not write output: ", err)
 		}
+	}
+
+	for _, unit := range resumed {
+		write(unit)
+	}
 
-		// Send more work as we make progress
-		if currTask < len(hosts) && len(work) < cap(work) {
-			work <- hosts[currTask]
-			currTask += 1
-			inFlight += 1
+	queried := make(map[string]bool)
+	errorCounts := make(map[string]int)
+	for unit := range results {
+		queried[unit.Host] = true
+		if unit.Error != "" {
+			errorCounts[unit.Error]++
 		}
+		write(unit)
 	}
-	close(work)
 
-	// Serialize data to output file
-	jsonEncoder := json.NewEncoder(fout)
-	if err := jsonEncoder.Encode(output); err != nil {
-		log.Fatal(err)
+	// Mark hosts we did not get to because of cancellation or deadline
+	notQueriedMsg := "not queried: run interrupted"
+	if ctx.Err() == context.DeadlineExceeded {
+		notQueriedMsg = "not queried: run deadline exceeded"
+	}
+	for _, host := range hosts {
+		if !queried[host.Target] {
+			unit := NewDeviceDataError(host.Target, notQueriedMsg)
+			errorCounts[unit.Error]++
+			write(unit)
+		}
 	}
 
-	fout.Sync()
-	fout.Close()
+	sort.Slice(sortedUnits, func(i, j int) bool {
+		return lessHost(sortedUnits[i].Host, sortedUnits[j].Host)
+	})
+	for _, unit := range sortedUnits {
+		if err := writer.Write(unit); err != nil {
+			abort()
+			log.Fatal("could not write output: ", err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		abort()
+		log.Fatal("could not write output: ", err)
+	}
+	if fout != nil {
+		if err := fout.Close(); err != nil {
+			log.Fatal("could not write output: ", err)
+		}
+	}
+
+	hostCount := len(hosts) + len(resumed)
+	failureCount := printErrorSummary(errorCounts, hostCount)
+	if float64(failureCount) > maxFailureRatio*float64(hostCount) {
+		os.Exit(2)
+	}
 }
 
-// Builds a host list using both the host and hostfile CLI options.
-// Assumes hostfile contains one host per line.
-func loadHostList() ([]string, error) {
-	var hosts []string
+// Reports on stderr how many hosts failed, grouping errors by message, most
+// frequent first. Returns the number of failed hosts.
+func printErrorSummary(errorCounts map[string]int, hostCount int) int {
+	messages := make([]string, 0, len(errorCounts))
+	failureCount := 0
+	for message, count := range errorCounts {
+		messages = append(messages, message)
+		failureCount += count
+	}
+	if failureCount == 0 {
+		return 0
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		if errorCounts[messages[i]] != errorCounts[messages[j]] {
+			return errorCounts[messages[i]] > errorCounts[messages[j]]
+		}
+		return messages[i] < messages[j]
+	})
+
+	fmt.Fprintf(os.Stderr, "%d/%d hosts failed:\n", failureCount, hostCount)
+	for _, message := range messages {
+		fmt.Fprintf(os.Stderr, "  %d× %s\n", errorCounts[message], message)
+	}
+
+	return failureCount
+}
+
+// Prints what would be queried, without any network call.
+func printQueryPlan(hosts []HostSpec) {
+	var MIBData OpticsMIB
+	magic, err := snmpmagic.NewSNMPMagic(&MIBData)
+	if err != nil {
+		log.Fatal("could not build query plan: ", err)
+	}
+
+	if err := magic.SelectFields(mibFields); err != nil {
+		log.Fatal("could not build query plan: ", err)
+	}
 
-	if snmpIP != "" {
-		hosts = append(hosts, snmpIP)
+	fmt.Print(magic)
+	fmt.Println()
+	fmt.Println("Hosts:")
+	for _, host := range hosts {
+		fmt.Println("-", host.Target)
 	}
+}
+
+// Checks that the given MIB groups (-mibs) are fields of OpticsMIB.
+func checkMIBFields(names []string) error {
+	magic, err := snmpmagic.NewSNMPMagic(&OpticsMIB{})
+	if err != nil {
+		return err
+	}
+	return magic.SelectFields(names)
+}
+
+// Writes the OID tree of OpticsMIB as a Graphviz graph.
+func writeOIDTreeDOT(path string) error {
+	oidTree, err := snmpmagic.BuildOIDTree(&OpticsMIB{})
+	if err != nil {
+		return err
+	}
+
+	if path == "-" {
+		return oidTree.WriteDOT(os.Stdout)
+	}
+
+	fout, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer fout.Close()
+
+	if err := oidTree.WriteDOT(fout); err != nil {
+		return err
+	}
+	return fout.Close()
+}
+
+// Limits the rate of host queries across workers, if set.
+var hostLimiter *rate.Limiter
 
-	if snmpHostFile != "" {
-		fin, err := os.Open(snmpHostFile)
+// Idle connections shared by workers (with -reuse-connections), or nil.
+var connectionPool *clientPool
+
+// Optics MIB destination along with its SNMPMagic, reused across hosts.
+type opticsQuery struct {
+	mib   OpticsMIB
+	magic *snmpmagic.SNMPMagic
+}
+
+var opticsQueryPool = sync.Pool{
+	New: func() interface{} {
+		query := &opticsQuery{}
+		magic, err := snmpmagic.NewSNMPMagic(&query.mib)
 		if err != nil {
-			return nil, err
+			// The MIB structure is validated at startup.
+			panic(err)
+		}
+		query.magic = magic
+		return query
+	},
+}
+
+// Fetches and parses device data from a given host. May encounter errors which
+// will be stored in the DeviceData, including panics caused by unexpected
+// device data, so that other hosts can still be collected.
+func fetch(
+	ctx context.Context,
+	host string,
+	credentials *Credentials,
+	query *opticsQuery,
+) (data *DeviceData) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg := fmt.Sprintf("panic: %v [%s]", r, panicStack(5))
+			log.Println("ERROR:", host, msg)
+			data = NewDeviceDataError(host, msg)
+		}
+	}()
+
+	client, err := newClient(host, credentials)
+	if err != nil {
+		return NewDeviceDataError(host, err.Error())
+	}
+	// The client target may be replaced with its address (see clientPoolKey).
+	target := client.Target
+
+	options := DeviceDataOptions{
+		Breakout:        breakoutPorts,
+		KeepEmptyOptics: keepEmptyOptics,
+		SanityRanges:    sanityRanges,
+	}
+
+	MIBData := &query.mib
+	magic := query.magic
+	magic.Parallelism = rootParallelism
+	magic.WalkMode = walkMode
+	magic.TrackUnmapped = debugUnmapped
+	magic.MaxPDUs = maxPDUs
+	if err := magic.SelectFields(mibFields); err != nil {
+		return NewDeviceDataError(host, err.Error())
+	}
+
+	// Set once the version used to query the host is known.
+	version := ""
+	defer func() {
+		if data != nil {
+			// Replays were collected when recorded.
+			collectedAt := time.Now()
+			if recordedAt := magic.RecordedAt(); !recordedAt.IsZero() {
+				collectedAt = recordedAt
+			}
+			data.CollectedAt = &collectedAt
+			data.QueryDurationMs = int64(magic.QueryDuration() / time.Millisecond)
+			data.PDUCount = magic.PDUCount()
+			if targetResolver != nil {
+				data.ResolvedIP, data.PTR = targetResolver.resolve(ctx, target)
+			}
+			data.SNMPVersion = version
+			if debugUnmapped {
+				count, sample := magic.Unmapped()
+				data.UnmappedPDUCount = count
+				for _, pdu := range sample {
+					data.UnmappedPDUSample = append(
+						data.UnmappedPDUSample, fmt.Sprintf("%s (%v)", pdu.Name, pdu.Type),
+					)
+				}
+			}
+		}
+	}()
+
+	if replayDir != "" {
+		fin, err := os.Open(recordPath(replayDir, host))
+		if err != nil {
+			return NewDeviceDataError(host, err.Error())
 		}
 		defer fin.Close()
 
-		lines := bufio.NewScanner(fin)
-		for lines.Scan() {
-			hosts = append(hosts, lines.Text())
+		if err := magic.Replay(fin); err != nil {
+			if err == snmpmagic.ErrTooManyPDUs {
+				return newTruncatedDeviceData(host, MIBData, options)
+			}
+			return NewDeviceDataError(host, err.Error())
 		}
-		if err := lines.Err(); err != nil {
-			return nil, err
+		return NewDeviceData(host, MIBData, options)
+	}
+
+	if hostLimiter != nil {
+		if err := hostLimiter.Wait(ctx); err != nil {
+			return NewDeviceDataError(host, "not queried: "+err.Error())
 		}
 	}
 
-	return hosts, nil
-}
+	if startJitter > 0 {
+		select {
+		case <-ctx.Done():
+			return NewDeviceDataError(host, "not queried: "+ctx.Err().Error())
+		case <-time.After(time.Duration(rand.Int63n(int64(startJitter)))):
+		}
+	}
 
-// Fetches and parses device data from a given host. May encounter errors which
-// will be stored in the DeviceData.
-func fetch(host string, snmpCommunity string) *DeviceData {
-	// Copy default client settings to avoid data races between concurrent workers
-	client := *gosnmp.Default
-	client.Target = host
-	client.Community = snmpCommunity
-	client.Version = gosnmp.Version2c
+	if err := selectSNMPVersion(client, credentials); err != nil {
+		if isTimeoutError(err) {
+			return NewDeviceDataError(host, "timeout: "+err.Error())
+		}
+		return NewDeviceDataError(host, err.Error())
+	}
+	// GETBULK does not exist in SNMPv1.
+	if client.Version == gosnmp.Version1 {
+		magic.WalkMode = snmpmagic.WalkNext
+	}
+	version = snmpVersionName(client.Version)
 
-	var MIBData OpticsMIB
-	magic, err := snmpmagic.NewSNMPMagic(&MIBData)
+	// Reuse an idle connection to the same agent with the same credentials.
+	// Targets that cannot be resolved are left for the query to fail.
+	poolKey := ""
+	if connectionPool != nil {
+		poolKey, err = clientPoolKey(ctx, client, credentials)
+		if pooled := connectionPool.get(poolKey); err == nil && pooled != nil {
+			client = pooled
+		}
+	}
+	magic.KeepConnection = poolKey != ""
+
+	if recordDir != "" {
+		frecord, err := os.Create(recordPath(recordDir, host))
+		if err != nil {
+			return NewDeviceDataError(host, err.Error())
+		}
+		defer frecord.Close()
+
+		recorder := bufio.NewWriter(frecord)
+		defer recorder.Flush()
+		magic.Recorder = recorder
+	}
 
+	err = queryWithRetries(ctx, magic, client)
+	if poolKey != "" {
+		// Connections are only reused after successful queries, as failures
+		// may leave late responses behind.
+		if err == nil {
+			connectionPool.put(poolKey, client)
+		} else if client.Conn != nil {
+			client.Conn.Close()
+		}
+	}
 	if err != nil {
+		if err == snmpmagic.ErrTooManyPDUs {
+			return newTruncatedDeviceData(host, MIBData, options)
+		}
+
+		// Keep data of successfully walked roots along with the error.
+		if queryErr, ok := err.(*snmpmagic.QueryError); ok && queryErr.IsPartial() {
+			data := NewDeviceData(host, MIBData, options)
+			data.Error = err.Error()
+			return data
+		}
+
+		if isTimeoutError(err) {
+			return NewDeviceDataError(host, "timeout: "+err.Error())
+		}
 		return NewDeviceDataError(host, err.Error())
 	}
 
-	if err := magic.Query(&client); err != nil {
-		return NewDeviceDataError(host, err.Error())
+	return NewDeviceData(host, MIBData, options)
+}
+
+// Builds device data from the PDUs handled before -max-pdus was reached, with
+// an error noting the truncation.
+func newTruncatedDeviceData(host string, MIBData *OpticsMIB, options DeviceDataOptions) *DeviceData {
+	log.Printf("WARNING: %s returned more than %d PDUs, query truncated", host, maxPDUs)
+	data := NewDeviceData(host, MIBData, options)
+	data.Error = fmt.Sprintf("truncated: more than %d PDUs (-max-pdus)", maxPDUs)
+	return data
+}
+
+// Builds a client for a given host, with settings from the command line.
+func newClient(host string, credentials *Credentials) (*gosnmp.GoSNMP, error) {
+	// Copy default client settings to avoid data races between concurrent workers
+	client := *gosnmp.Default
+	target, port, err := splitHostPort(host)
+	if err != nil {
+		return nil, err
+	}
+	client.Target = target
+	if port != 0 {
+		client.Port = port
+	}
+	if isIPv6Literal(target) {
+		client.Transport = "udp6"
+	}
+	client.Timeout = snmpTimeout
+	client.Retries = snmpRetries
+	client.MaxRepetitions = uint8(maxRepetitions)
+	client.NonRepeaters = nonRepeaters
+	credentials.Apply(&client)
+
+	return &client, nil
+}
+
+// Queries a host, querying it again from scratch after transient failures,
+// with exponential backoff.
+func queryWithRetries(
+	ctx context.Context,
+	magic *snmpmagic.SNMPMagic,
+	client *gosnmp.GoSNMP,
+) error {
+	backoff := hostBackoff
+	for attempt := 0; ; attempt++ {
+		err := magic.QueryContext(ctx, client)
+		if err == nil || attempt >= hostRetries || !isTransientError(err) {
+			return err
+		}
+
+		log.Printf("WARNING: query of %s failed (%v), retrying in %v", client.Target, err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+
+		// Data of the failed attempt is discarded, but not the recorder.
+		recorder := magic.Recorder
+		magic.Reset()
+		magic.Recorder = recorder
 	}
+}
 
-	return NewDeviceData(host, &MIBData)
+// Returns the path of the PDU record of a host in a given directory.
+func recordPath(dir string, host string) string {
+	return filepath.Join(dir, hostFileName(host)+".ndjson")
 }
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"fmt"
 	"math"
+	"strconv"
+	"time"
 )
 
 // Describes the hierarchy of MIBs we need to obtain from hosts.
 // Keys in maps are the value of the last component of the OID for array/maps.
 // (See snmpmagic package for details)
 type OpticsMIB struct {
+	System SystemGroup `snmp:".1.3.6.1.2.1.1"`
+
 	Interface   map[uint]*InterfaceEntry      `snmp:".1.3.6.1.2.1.2.2.1"`
 	InterfaceHC map[uint]*InterfaceHCEntry    `snmp:".1.3.6.1.2.1.31.1.1.1"`
 	Entity      map[uint]*EntityPhysicalEntry `snmp:".1.3.6.1.2.1.47.1.1.1.1"`
@@ -15,26 +20,71 @@ type OpticsMIB struct {
 
 	JuniperDOM     map[uint]*JuniperModuleDOMEntry     `snmp:".1.3.6.1.4.1.2636.3.60.1.1.1.1"`
 	JuniperLaneDOM map[uint]*JuniperModuleLaneDOMEntry `snmp:".1.3.6.1.4.1.2636.3.60.1.2.1"`
+
+	CiscoSensor map[uint]*CiscoSensorEntry `snmp:".1.3.6.1.4.1.9.9.91.1.1.1.1"`
+
+	NokiaDDM map[[2]uint]*NokiaDDMEntry `snmp:".1.3.6.1.4.1.6527.3.1.2.2.4.31.1"`
+}
+
+// SNMPv2-MIB system group.
+type SystemGroup struct {
+	Descr    string `snmp:"1"`
+	ObjectID string `snmp:"2"`
+	UpTime   uint32 `snmp:"3"` // TimeTicks (hundredths of a second)
+	Name     string `snmp:"5"`
 }
 
 type EntityPhysicalEntry struct {
-	Descr        string `snmp:"2"`
-	VendorType   string `snmp:"3"`
-	ContainedIn  int32  `snmp:"4"`
-	Class        int32  `snmp:"5"`
-	ParentRelPos int32  `snmp:"6"`
-	Name         string `snmp:"7"`
-	HardwareRev  string `snmp:"8"`
-	FirmwareRev  string `snmp:"9"`
-	SoftwareRev  string `snmp:"10"`
-	SerialNum    string `snmp:"11"`
-	MfgName      string `snmp:"12"`
-	ModelName    string `snmp:"13"`
-	Alias        string `snmp:"14"`
-	AssetID      string `snmp:"15"`
-	IsFRU        bool   `snmp:"16"`
-	MfgDate      string `snmp:"17"`
-	Uris         string `snmp:"18"`
+	Descr        string      `snmp:"2"`
+	VendorType   string      `snmp:"3"`
+	ContainedIn  int32       `snmp:"4"`
+	Class        EntityClass `snmp:"5"`
+	ParentRelPos int32       `snmp:"6"`
+	Name         string      `snmp:"7"`
+	HardwareRev  string      `snmp:"8"`
+	FirmwareRev  string      `snmp:"9"`
+	SoftwareRev  string      `snmp:"10"`
+	SerialNum    string      `snmp:"11"`
+	MfgName      string      `snmp:"12"`
+	ModelName    string      `snmp:"13"`
+	Alias        string      `snmp:"14"`
+	AssetID      string      `snmp:"15"`
+	IsFRU        bool        `snmp:"16"`
+	MfgDate      time.Time   `snmp:"17"`
+	Uris         string      `snmp:"18"`
+}
+
+type EntityClass int32
+
+const (
+	ClassOther EntityClass = iota + 1
+	ClassUnknown
+	ClassChassis
+	ClassBackplane
+	ClassContainer
+	ClassPowerSupply
+	ClassFan
+	ClassSensor
+	ClassModule
+	ClassPort
+	ClassStack
+	ClassCPU
+)
+
+var entityClassNames = [...]string{
+	"", "other", "unknown", "chassis", "backplane", "container", "powerSupply",
+	"fan", "sensor", "module", "port", "stack", "cpu",
+}
+
+func (self EntityClass) IsKnown() bool {
+	return self > 0 && int(self) < len(entityClassNames)
+}
+
+func (self EntityClass) String() string {
+	if !self.IsKnown() {
+		return strconv.Itoa(int(self))
+	}
+	return entityClassNames[self]
 }
 
 type SensorDataType int32
@@ -54,6 +104,24 @@ const (
 	TypeTruthvalue
 )
 
+var sensorDataTypeNames = [...]string{
+	"", "other", "unknown", "voltsAC", "voltsDC", "amperes", "watts", "hertz",
+	"celsius", "percentRH", "rpm", "cmm", "truthvalue",
+	// Cisco extensions
+	"specialEnum", "dBm",
+}
+
+func (self SensorDataType) IsKnown() bool {
+	return self > 0 && int(self) < len(sensorDataTypeNames)
+}
+
+func (self SensorDataType) String() string {
+	if !self.IsKnown() {
+		return strconv.Itoa(int(self))
+	}
+	return sensorDataTypeNames[self]
+}
+
 type SensorDataScale int32
 
 const (
@@ -76,23 +144,70 @@ const (
 	Yotta
 )
 
+var sensorDataScaleNames = [...]string{
+	"", "yocto", "zepto", "atto", "femto", "pico", "nano", "micro", "milli",
+	"units", "kilo", "mega", "giga", "tera", "exa", "peta", "zetta", "yotta",
+}
+
+func (self SensorDataScale) IsKnown() bool {
+	return self > 0 && int(self) < len(sensorDataScaleNames)
+}
+
+func (self SensorDataScale) String() string {
+	if !self.IsKnown() {
+		return strconv.Itoa(int(self))
+	}
+	return sensorDataScaleNames[self]
+}
+
 type SensorEntry struct {
 	Type            SensorDataType  `snmp:"1"`
 	Scale           SensorDataScale `snmp:"2"`
-	Precision       int32           `snmp:"3"`
+	Precision       int32           `snmp:"3"` // Number of decimal places
 	Value           int32           `snmp:"4"`
-	OperStatus      int32           `snmp:"5"`
+	OperStatus      SensorStatus    `snmp:"5"`
 	UnitsDisplay    string          `snmp:"6"`
 	ValueTimeStamp  uint32          `snmp:"7"`
 	ValueUpdateRate uint32          `snmp:"8"`
 }
 
+type SensorStatus int32
+
+const (
+	SensorOk SensorStatus = iota + 1
+	SensorUnavailable
+	SensorNonOperational
+)
+
+var sensorStatusNames = [...]string{
+	"", "ok", "unavailable", "nonoperational",
+}
+
+func (self SensorStatus) IsKnown() bool {
+	return self > 0 && int(self) < len(sensorStatusNames)
+}
+
+func (self SensorStatus) String() string {
+	if !self.IsKnown() {
+		return strconv.Itoa(int(self))
+	}
+	return sensorStatusNames[self]
+}
+
+// Converts the value to base SI units: per ENTITY-SENSOR-MIB, the value is
+// scaled by the SI prefix and has Precision decimal places.
 func (self *SensorEntry) Float32() float32 {
-	scalePower := (self.Scale - 9) * 3
+	scalePower := (self.Scale-9)*3 - SensorDataScale(self.Precision)
 	scaleFactor := math.Pow(10, float64(scalePower))
 	return float32(float64(self.Value) * scaleFactor)
 }
 
+// Returns the value in base SI units (or dBm for Cisco sensors) along with its
+// physical dimension, so that extractors can dispatch on the latter.
+func (self *SensorEntry) Normalized() (float32, SensorDataType) {
+	return self.Float32(), self.Type
+}
+
 type InterfaceAdminStatus int32
 
 const (
@@ -101,6 +216,43 @@ const (
 	AdminTesting
 )
 
+func (self InterfaceAdminStatus) IsKnown() bool {
+	return self >= AdminUp && self <= AdminTesting
+}
+
+func (self InterfaceAdminStatus) String() string {
+	switch self {
+	case AdminUp:
+		return "up"
+	case AdminDown:
+		return "down"
+	case AdminTesting:
+		return "testing"
+	}
+	return strconv.Itoa(int(self))
+}
+
+func (self InterfaceAdminStatus) MarshalText() ([]byte, error) {
+	return []byte(self.String()), nil
+}
+
+// Parses a status as written by MarshalText.
+func (self *InterfaceAdminStatus) UnmarshalText(text []byte) error {
+	for status := AdminUp; status <= AdminTesting; status++ {
+		if string(text) == status.String() {
+			*self = status
+			return nil
+		}
+	}
+
+	value, err := strconv.ParseInt(string(text), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid admin status '%s'", text)
+	}
+	*self = InterfaceAdminStatus(value)
+	return nil
+}
+
 type InterfaceOperStatus int32
 
 const (
@@ -113,6 +265,51 @@ const (
 	OperLowerLayerDown
 )
 
+func (self InterfaceOperStatus) IsKnown() bool {
+	return self >= OperUp && self <= OperLowerLayerDown
+}
+
+func (self InterfaceOperStatus) String() string {
+	switch self {
+	case OperUp:
+		return "up"
+	case OperDown:
+		return "down"
+	case OperTesting:
+		return "testing"
+	case OperUnknown:
+		return "unknown"
+	case OperDormant:
+		return "dormant"
+	case OperNotPresent:
+		return "notPresent"
+	case OperLowerLayerDown:
+		return "lowerLayerDown"
+	}
+	return strconv.Itoa(int(self))
+}
+
+func (self InterfaceOperStatus) MarshalText() ([]byte, error) {
+	return []byte(self.String()), nil
+}
+
+// Parses a status as written by MarshalText.
+func (self *InterfaceOperStatus) UnmarshalText(text []byte) error {
+	for status := OperUp; status <= OperLowerLayerDown; status++ {
+		if string(text) == status.String() {
+			*self = status
+			return nil
+		}
+	}
+
+	value, err := strconv.ParseInt(string(text), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid oper status '%s'", text)
+	}
+	*self = InterfaceOperStatus(value)
+	return nil
+}
+
 type InterfaceEntry struct {
 	Descr           string               `snmp:"2"`
 	Type            int32                `snmp:"3"`
@@ -121,7 +318,7 @@ type InterfaceEntry struct {
 	PhysAddress     []byte               `snmp:"6"`
 	AdminStatus     InterfaceAdminStatus `snmp:"7"`
 	OperStatus      InterfaceOperStatus  `snmp:"8"`
-	LastChange      uint32               `snmp:"9"`
+	LastChange      time.Time            `snmp:"9"`
 	InOctets        uint32               `snmp:"10"`
 	InUcastPkts     uint32               `snmp:"11"`
 	InDiscards      uint32               `snmp:"13"`
@@ -134,31 +331,31 @@ type InterfaceEntry struct {
 }
 
 type InterfaceHCEntry struct {
-	Name                     string `snmp:"1"`
-	InMulticastPkts          uint32 `snmp:"2"`
-	InBroadcastPkts          uint32 `snmp:"3"`
-	OutMulticastPkts         uint32 `snmp:"4"`
-	OutBroadcastPkts         uint32 `snmp:"5"`
-	HCInOctets               uint64 `snmp:"6"`
-	HCInUcastPkts            uint64 `snmp:"7"`
-	HCInMulticastPkts        uint64 `snmp:"8"`
-	HCInBroadcastPkts        uint64 `snmp:"9"`
-	HCOutOctets              uint64 `snmp:"10"`
-	HCOutUcastPkts           uint64 `snmp:"11"`
-	HCOutMulticastPkts       uint64 `snmp:"12"`
-	HCOutBroadcastPkts       uint64 `snmp:"13"`
-	LinkUpDownTrapEnable     bool   `snmp:"14"`
-	HighSpeed                uint64 `snmp:"15"`
-	PromiscuousMode          bool   `snmp:"16"`
-	ConnectorPresent         bool   `snmp:"17"`
-	Alias                    string `snmp:"18"`
-	CounterDiscontinuityTime uint64 `snmp:"19"`
+	Name                     string    `snmp:"1"`
+	InMulticastPkts          uint32    `snmp:"2"`
+	InBroadcastPkts          uint32    `snmp:"3"`
+	OutMulticastPkts         uint32    `snmp:"4"`
+	OutBroadcastPkts         uint32    `snmp:"5"`
+	HCInOctets               uint64    `snmp:"6"`
+	HCInUcastPkts            uint64    `snmp:"7"`
+	HCInMulticastPkts        uint64    `snmp:"8"`
+	HCInBroadcastPkts        uint64    `snmp:"9"`
+	HCOutOctets              uint64    `snmp:"10"`
+	HCOutUcastPkts           uint64    `snmp:"11"`
+	HCOutMulticastPkts       uint64    `snmp:"12"`
+	HCOutBroadcastPkts       uint64    `snmp:"13"`
+	LinkUpDownTrapEnable     bool      `snmp:"14"`
+	HighSpeed                uint64    `snmp:"15"`
+	PromiscuousMode          bool      `snmp:"16"`
+	ConnectorPresent         bool      `snmp:"17"`
+	Alias                    string    `snmp:"18"`
+	CounterDiscontinuityTime time.Time `snmp:"19"`
 }
 
 type JuniperModuleDOMEntry struct {
-	Temperature int32 `snmp:"8"`  // Celsius × 10^0
-	Voltage     int32 `snmp:"25"` // Volts × 10^3
-	LaneCount   int32 `snmp:"30"`
+	Temperature float32 `snmp:"8"`             // Celsius
+	Voltage     float32 `snmp:"25,scale=1e-3"` // Volts
+	LaneCount   int32   `snmp:"30"`
 }
 
 type JuniperModuleLaneDOMEntry struct {
@@ -166,8 +363,40 @@ type JuniperModuleLaneDOMEntry struct {
 }
 
 type JuniperLaneDOMEntry struct {
-	RxLaserPower       int32 `snmp:"6"` // dBm × 10^2
-	TxLaserBiasCurrent int32 `snmp:"7"` // Amperes × 10^-6
-	TxLaserPower       int32 `snmp:"8"` // dBm × 10^2
-	LaserTemperature   int32 `snmp:"9"` // Celsius × 10^0
+	RxLaserPower       float32 `snmp:"6,scale=1e-2"` // dBm
+	TxLaserBiasCurrent float32 `snmp:"7,scale=1e-6"` // Amperes
+	TxLaserPower       float32 `snmp:"8,scale=1e-2"` // dBm
+	LaserTemperature   float32 `snmp:"9"`            // Celsius
+}
+
+// Cisco extensions to SensorDataType.
+const (
+	CiscoTypeSpecialEnum SensorDataType = iota + 13
+	CiscoTypeDBm
+)
+
+// Indexed by the entPhysicalIndex of the sensor. Columns up to the status are
+// those of ENTITY-SENSOR-MIB, and fields those of SensorEntry, so that entries
+// convert to *SensorEntry for decoding. The update rate is an Integer32 here,
+// and is not read.
+type CiscoSensorEntry struct {
+	Type            SensorDataType  `snmp:"1"`
+	Scale           SensorDataScale `snmp:"2"`
+	Precision       int32           `snmp:"3"` // Number of decimal places
+	Value           int32           `snmp:"4"`
+	OperStatus      SensorStatus    `snmp:"5"`
+	UnitsDisplay    string
+	ValueTimeStamp  uint32 `snmp:"6"`
+	ValueUpdateRate uint32
+}
+
+// TIMETRA-PORT-MIB tmnxDDMEntry, indexed by (tmnxChassisIndex, tmnxPortPortID).
+// Values are module-level: per-lane values of multi-lane modules are in
+// another table.
+type NokiaDDMEntry struct {
+	Temperature    float32 `snmp:"1"`             // Celsius
+	SupplyVoltage  float32 `snmp:"6,scale=1e-4"`  // Volts
+	TxBiasCurrent  float32 `snmp:"11,scale=1e-6"` // Amperes
+	TxOutputPower  float32 `snmp:"16,scale=1e-7"` // Watts
+	RxOpticalPower float32 `snmp:"21,scale=1e-7"` // Watts
 }
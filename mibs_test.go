@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSensorEntryFloat32(t *testing.T) {
+	testCases := []struct {
+		name     string
+		entry    SensorEntry
+		expected float32
+	}{
+		// Arista DOM sensors
+		{"Arista temperature", SensorEntry{Type: TypeCelsius, Scale: Units, Precision: 1, Value: 385}, 38.5},
+		{"Arista voltage", SensorEntry{Type: TypeVoltsDC, Scale: Units, Precision: 2, Value: 329}, 3.29},
+		{"Arista bias current", SensorEntry{Type: TypeAmperes, Scale: Milli, Precision: 2, Value: 650}, 0.0065},
+		{"Arista power", SensorEntry{Type: TypeWatts, Scale: Milli, Precision: 4, Value: 5012}, 0.0005012},
+		// Cisco sensors
+		{"Cisco power", SensorEntry{Type: CiscoTypeDBm, Scale: Units, Precision: 1, Value: -25}, -2.5},
+		{"Cisco temperature", SensorEntry{Type: TypeCelsius, Scale: Units, Precision: 0, Value: 40}, 40},
+		{"Cisco bias current", SensorEntry{Type: TypeAmperes, Scale: Micro, Precision: 0, Value: 6500}, 0.0065},
+		{"Cisco power in microwatts", SensorEntry{Type: TypeWatts, Scale: Micro, Precision: 1, Value: 5012}, 0.0005012},
+		// Negative precisions are trailing zeros
+		{"negative precision", SensorEntry{Type: TypeWatts, Scale: Units, Precision: -2, Value: 5}, 500},
+		{"kilo scale", SensorEntry{Type: TypeWatts, Scale: Kilo, Precision: 3, Value: 1500}, 1500},
+	}
+	for _, testCase := range testCases {
+		value, unit := testCase.entry.Normalized()
+		if !approxEqual(value, testCase.expected) || unit != testCase.entry.Type {
+			t.Errorf("%s: got %v %v, expected %v", testCase.name, value, unit, testCase.expected)
+		}
+	}
+}
+
+func TestExtractAristaData(t *testing.T) {
+	// Sensor IDs are 1003PP2LS: port 3, module (lane 0) or lane 1 sensors.
+	mib := &OpticsMIB{
+		Interface: map[uint]*InterfaceEntry{3: {Descr: "Ethernet3"}},
+		Sensor: map[uint]*SensorEntry{
+			100303201: {Type: TypeCelsius, Scale: Units, Precision: 1, Value: 385, OperStatus: SensorOk},
+			100303211: {Type: TypeAmperes, Scale: Milli, Precision: 2, Value: 650, OperStatus: SensorOk},
+			100303213: {Type: TypeWatts, Scale: Milli, Precision: 4, Value: 5012, OperStatus: SensorOk},
+		},
+	}
+
+	data := NewDeviceData("10.0.0.1", mib, DeviceDataOptions{})
+	optics := data.OpticsByPort[PortID{Port: 3}]
+	if optics == nil || !approxEqual(optics.ModuleTemperature, 38.5) {
+		t.Fatalf("unexpected module values: %+v", optics)
+	}
+	sensor := optics.SensorsByLane[1]
+	if sensor == nil || !approxEqual(sensor.TxLaserBiasCurrent, 0.0065) || !approxEqual(sensor.RxLaserPower, -2.9999) {
+		t.Errorf("unexpected lane values: %+v", sensor)
+	}
+}
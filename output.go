@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Serializes device data to an output stream, possibly as results come in.
+type OutputWriter interface {
+	// Adds a device's data to the output.
+	Write(data *DeviceData) error
+	// Flushes any buffered data. Must be called once all devices are written.
+	Close() error
+}
+
+// Version of the structure of JSON outputs, to be bumped on incompatible
+// changes of DeviceData/OpticsData.
+const outputSchemaVersion = "1"
+
+// Builds the OutputWriter for a given format name. Formats with timestamps
+// use the given run timestamp.
+func NewOutputWriter(format string, w io.Writer, timestamp time.Time) (OutputWriter, error) {
+	switch format {
+	case "json", "json-flat":
+		return &jsonOutputWriter{
+			encoder:   json.NewEncoder(w),
+			output:    make(hostMap),
+			flat:      format == "json-flat",
+			timestamp: timestamp,
+		}, nil
+
+	case "ndjson":
+		return &ndjsonOutputWriter{
+			w:       w,
+			encoder: json.NewEncoder(w),
+		}, nil
+
+	case "prometheus":
+		return &prometheusOutputWriter{
+			w: w,
+		}, nil
+
+	case "influx":
+		return newInfluxOutputWriter(w, timestamp), nil
+
+	case "csv":
+		return newCSVOutputWriter(w), nil
+	}
+
+	return nil, fmt.Errorf("unknown output format '%s'", format)
+}
+
+// Writes a single JSON object once all devices are collected, holding the
+// schema version and the data keyed by host (or only the latter when flat).
+type jsonOutputWriter struct {
+	encoder   *json.Encoder
+	output    hostMap
+	flat      bool
+	timestamp time.Time
+}
+
+// Top-level object of the JSON output.
+type jsonOutput struct {
+	SchemaVersion string    `json:"schema_version"`
+	GeneratedAt   time.Time `json:"generated_at"`
+	Hosts         hostMap   `json:"hosts"`
+}
+
+// Device data keyed by host, serialized with hosts in the order of lessHost
+// (e.g. 10.0.0.2 before 10.0.0.10) so that outputs of successive runs can be
+// diffed.
+type hostMap map[string]*DeviceData
+
+func (self hostMap) MarshalJSON() ([]byte, error) {
+	hosts := make([]string, 0, len(self))
+	for host := range self {
+		hosts = append(hosts, host)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return lessHost(hosts[i], hosts[j]) })
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, host := range hosts {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(host)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(self[host])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+func (self *jsonOutputWriter) Write(data *DeviceData) error {
+	self.output[data.Host] = data
+	return nil
+}
+
+func (self *jsonOutputWriter) Close() error {
+	if self.flat {
+		return self.encoder.Encode(self.output)
+	}
+
+	return self.encoder.Encode(&jsonOutput{
+		SchemaVersion: outputSchemaVersion,
+		GeneratedAt:   self.timestamp,
+		Hosts:         self.output,
+	})
+}
+
+// Writes one JSON object per line (newline-delimited JSON) as soon as each
+// device is collected.
+type ndjsonOutputWriter struct {
+	w       io.Writer
+	encoder *json.Encoder
+}
+
+func (self *ndjsonOutputWriter) Write(data *DeviceData) error {
+	if err := self.encoder.Encode(data); err != nil {
+		return err
+	}
+
+	// Push each record through buffering layers (e.g. compression), so that
+	// the output can be followed.
+	if flusher, ok := self.w.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+func (self *ndjsonOutputWriter) Close() error {
+	return nil
+}
+
+// Whether JSON outputs hold lanes as an array sorted by lane number, rather
+// than as an object keyed by lane number.
+var jsonLanesAsArray = false
+
+// Lane sensor data, as an element of the lane array of JSON outputs.
+type laneSensorJSON struct {
+	Lane uint
+	OpticalSensor
+}
+
+func (self *OpticsData) MarshalJSON() ([]byte, error) {
+	// Conversion to a type without methods avoids recursing on MarshalJSON.
+	type opticsDataJSON OpticsData
+	if !jsonLanesAsArray {
+		return json.Marshal((*opticsDataJSON)(self))
+	}
+
+	lanes := make([]laneSensorJSON, 0, len(self.SensorsByLane))
+	for _, lane := range sortedLanes(self.SensorsByLane) {
+		lanes = append(lanes, laneSensorJSON{lane, *self.SensorsByLane[lane]})
+	}
+
+	// The outer SensorsByLane field takes precedence over the embedded one.
+	return json.Marshal(struct {
+		*opticsDataJSON
+		SensorsByLane []laneSensorJSON
+	}{(*opticsDataJSON)(self), lanes})
+}
+
+// Decodes port data as written by MarshalJSON, with lanes as an object or as an
+// array (whatever jsonLanesAsArray).
+func (self *OpticsData) UnmarshalJSON(data []byte) error {
+	type opticsDataJSON OpticsData
+	var lanes struct {
+		SensorsByLane json.RawMessage
+	}
+	if err := json.Unmarshal(data, &lanes); err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(lanes.SensorsByLane), []byte("[")) {
+		return json.Unmarshal(data, (*opticsDataJSON)(self))
+	}
+
+	var fields struct {
+		*opticsDataJSON
+		SensorsByLane []laneSensorJSON
+	}
+	fields.opticsDataJSON = (*opticsDataJSON)(self)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	self.SensorsByLane = make(map[uint]*OpticalSensor, len(fields.SensorsByLane))
+	for i := range fields.SensorsByLane {
+		lane := &fields.SensorsByLane[i]
+		self.SensorsByLane[lane.Lane] = &lane.OpticalSensor
+	}
+	return nil
+}
+
+// Returns the ports of a device in ascending order, for stable outputs.
+func sortedPorts(opticsByPort map[PortID]*OpticsData) []PortID {
+	ports := make([]PortID, 0, len(opticsByPort))
+	for port := range opticsByPort {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Less(ports[j]) })
+	return ports
+}
+
+// Returns the lanes of a port in ascending order, for stable outputs.
+func sortedLanes(sensorsByLane map[uint]*OpticalSensor) []uint {
+	lanes := make([]uint, 0, len(sensorsByLane))
+	for lane := range sensorsByLane {
+		lanes = append(lanes, lane)
+	}
+	sort.Slice(lanes, func(i, j int) bool { return lanes[i] < lanes[j] })
+	return lanes
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// Columns of the CSV output. Port columns are repeated on each lane row.
+var csvHeader = []string{
+	"host", "port", "lane", "speed", "description", "oper_status",
+	"rx_dbm", "tx_dbm", "bias_a", "laser_temp_c",
+	"module_temp_c", "module_voltage_v",
+	"in_octets", "out_octets", "in_errors", "out_errors",
+	"error",
+}
+
+// Writes a CSV file with a header row and one row per lane per port, as
+// results come in. Ports without lanes get a single row with empty lane
+// columns, and hosts without any port a single row with their error.
+type csvOutputWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func newCSVOutputWriter(w io.Writer) *csvOutputWriter {
+	return &csvOutputWriter{w: csv.NewWriter(w)}
+}
+
+func (self *csvOutputWriter) Write(data *DeviceData) error {
+	self.writeHeader()
+
+	if len(data.OpticsByPort) == 0 {
+		row := make([]string, len(csvHeader))
+		row[0] = data.Host
+		row[len(row)-1] = data.Error
+		self.w.Write(row)
+	}
+
+	for _, port := range sortedPorts(data.OpticsByPort) {
+		optics := data.OpticsByPort[port]
+		operStatus := ""
+		if optics.OperStatus != 0 {
+			operStatus = optics.OperStatus.String()
+		}
+		portColumns := []string{
+			strconv.FormatUint(optics.Speed, 10),
+			optics.Description,
+			operStatus,
+		}
+		moduleColumns := []string{
+			formatCSVFloat(optics.ModuleTemperature),
+			formatCSVFloat(optics.ModuleVoltage),
+			strconv.FormatUint(optics.InOctets, 10),
+			strconv.FormatUint(optics.OutOctets, 10),
+			strconv.FormatUint(optics.InErrors, 10),
+			strconv.FormatUint(optics.OutErrors, 10),
+			data.Error,
+		}
+
+		if len(optics.SensorsByLane) == 0 {
+			row := []string{data.Host, port.String(), ""}
+			row = append(row, portColumns...)
+			row = append(row, "", "", "", "")
+			self.w.Write(append(row, moduleColumns...))
+			continue
+		}
+
+		for _, lane := range sortedLanes(optics.SensorsByLane) {
+			sensor := optics.SensorsByLane[lane]
+			row := []string{data.Host, port.String(), strconv.FormatUint(uint64(lane), 10)}
+			row = append(row, portColumns...)
+			row = append(row,
+				formatCSVFloat(sensor.RxLaserPower),
+				formatCSVFloat(sensor.TxLaserPower),
+				formatCSVFloat(sensor.TxLaserBiasCurrent),
+				formatCSVFloat(sensor.LaserTemperature),
+			)
+			self.w.Write(append(row, moduleColumns...))
+		}
+	}
+
+	self.w.Flush()
+	return self.w.Error()
+}
+
+func (self *csvOutputWriter) Close() error {
+	// Runs without any host still get a header.
+	self.writeHeader()
+	self.w.Flush()
+	return self.w.Error()
+}
+
+func (self *csvOutputWriter) writeHeader() {
+	if !self.headerWritten {
+		self.w.Write(csvHeader)
+		self.headerWritten = true
+	}
+}
+
+func formatCSVFloat(value float32) string {
+	return strconv.FormatFloat(float64(value), 'g', -1, 32)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Writes the data of each device to its own JSON file in a directory (-out-dir)
+// as soon as it is collected, e.g. for per-device archival or upload. Each file
+// is written to a temporary file first, like -out.
+type dirOutputWriter struct {
+	dir      string
+	compress bool
+}
+
+// Creates the output directory if needed.
+func newDirOutputWriter(dir string, compress bool) (*dirOutputWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &dirOutputWriter{dir: dir, compress: compress}, nil
+}
+
+func (self *dirOutputWriter) Write(data *DeviceData) error {
+	path := filepath.Join(self.dir, hostFileName(data.Host)+".json")
+	if self.compress {
+		path += ".gz"
+	}
+
+	fout, err := createOutputFile(path, self.compress)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(fout).Encode(data); err != nil {
+		fout.Abort()
+		return err
+	}
+	return fout.Close()
+}
+
+func (self *dirOutputWriter) Close() error {
+	return nil
+}
+
+// Returns the base name of files holding data of a given host. Colons of IPv6
+// addresses and ports, and other characters that are not portable in file
+// names, are replaced with underscores.
+func hostFileName(host string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`:/\<>"|?*`, r) {
+			return '_'
+		}
+		return r
+	}, host)
+}
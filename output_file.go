@@ -0,0 +1,77 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+)
+
+// Output file, optionally gzip-compressed. Data is written to a temporary file
+// which only replaces the target once complete, so that a crashed or killed
+// run never leaves a truncated result in place of a previous one.
+type outputFile struct {
+	path string
+	file *os.File
+	gzip *gzip.Writer
+	w    io.Writer
+}
+
+// Creates the temporary output file for a given path.
+func createOutputFile(path string, compress bool) (*outputFile, error) {
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	out := &outputFile{path: path, file: file, w: file}
+	if compress {
+		out.gzip = gzip.NewWriter(file)
+		out.w = out.gzip
+	}
+	return out, nil
+}
+
+func (self *outputFile) Write(p []byte) (int, error) {
+	return self.w.Write(p)
+}
+
+// Pushes buffered compressed data to the file, so that records written so far
+// can be read (e.g. with zcat) while the run goes on.
+func (self *outputFile) Flush() error {
+	if self.gzip == nil {
+		return nil
+	}
+	return self.gzip.Flush()
+}
+
+// Terminates the compressed stream if any, syncs and closes the file, then
+// moves it into place. The temporary file is removed on error.
+func (self *outputFile) Close() error {
+	if self.gzip != nil {
+		if err := self.gzip.Close(); err != nil {
+			self.Abort()
+			return err
+		}
+	}
+
+	if err := self.file.Sync(); err != nil {
+		self.Abort()
+		return err
+	}
+	if err := self.file.Close(); err != nil {
+		os.Remove(self.file.Name())
+		return err
+	}
+
+	if err := os.Rename(self.file.Name(), self.path); err != nil {
+		os.Remove(self.file.Name())
+		return err
+	}
+	return nil
+}
+
+// Discards the output, leaving any previous file at the target path as is.
+func (self *outputFile) Abort() {
+	self.file.Close()
+	os.Remove(self.file.Name())
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"time"
+)
+
+import (
+	"github.com/criteo/netopticon/collector"
+)
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Number of times a broken stream to the collector is opened again before
+// giving up, waiting grpcRetryBackoff before the first attempt and twice as
+// long before each of the next ones.
+const (
+	grpcStreamRetries = 5
+	grpcRetryBackoff  = time.Second
+)
+
+// Number of devices sent on a stream before closing it, so that the collector
+// acknowledges them and they no longer need to be kept.
+const grpcStreamDevices = 256
+
+// Streams the data of each device to a collector service (-grpc-target) as
+// soon as it is collected. Devices sent on a stream are kept until the stream
+// is successfully closed, and sent again on a new stream if it breaks, as
+// gRPC does not tell which of them the collector received. Streams are closed
+// every grpcStreamDevices devices, which bounds both.
+type grpcOutputWriter struct {
+	conn      *grpc.ClientConn
+	client    collector.CollectorClient
+	timestamp *timestamppb.Timestamp
+	backoff   time.Duration
+	batchSize int
+
+	// Retries stop waiting once the run is cancelled.
+	runCtx context.Context
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stream  collector.Collector_PushDeviceDataClient
+	pending []*collector.DeviceData
+}
+
+// Connects to the collector and opens the stream, so that an unreachable
+// collector is reported before hosts are queried. The connection is in
+// plaintext if insecureConn is set, over TLS otherwise.
+func newGRPCOutputWriter(
+	runCtx context.Context,
+	target string,
+	insecureConn bool,
+	timestamp time.Time,
+) (*grpcOutputWriter, error) {
+	creds := credentials.NewClientTLSFromCert(nil, "")
+	if insecureConn {
+		creds = insecure.NewCredentials()
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+
+	writer := newGRPCOutputWriterForConn(runCtx, conn, timestamp)
+	if err := writer.withRetries(writer.open); err != nil {
+		writer.cancel()
+		conn.Close()
+		return nil, err
+	}
+	return writer, nil
+}
+
+// Streams are not bound to runCtx, so that partial results of a cancelled run
+// are still sent.
+func newGRPCOutputWriterForConn(
+	runCtx context.Context,
+	conn *grpc.ClientConn,
+	timestamp time.Time,
+) *grpcOutputWriter {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &grpcOutputWriter{
+		conn:      conn,
+		client:    collector.NewCollectorClient(conn),
+		timestamp: timestamppb.New(timestamp),
+		backoff:   grpcRetryBackoff,
+		batchSize: grpcStreamDevices,
+		runCtx:    runCtx,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+func (self *grpcOutputWriter) Write(data *DeviceData) error {
+	message := deviceDataToProto(data, self.timestamp)
+	self.pending = append(self.pending, message)
+
+	if self.stream != nil {
+		err := self.stream.Send(message)
+		if err == nil {
+			return self.commitFull()
+		}
+		if err = self.streamError(err); !isTransientGRPCError(err) {
+			return err
+		}
+		log.Printf("WARNING: stream to collector broken (%v), reopening it", err)
+	}
+	if err := self.withRetries(self.open); err != nil {
+		return err
+	}
+	return self.commitFull()
+}
+
+func (self *grpcOutputWriter) Close() error {
+	defer self.conn.Close()
+	defer self.cancel()
+
+	err := self.commit()
+	self.pending = nil
+	return err
+}
+
+// Commits the current stream once it holds batchSize devices.
+func (self *grpcOutputWriter) commitFull() error {
+	if len(self.pending) < self.batchSize {
+		return nil
+	}
+	return self.commit()
+}
+
+// Closes the current stream, and forgets its devices once the collector
+// acknowledged them. The next device is sent on a new stream.
+func (self *grpcOutputWriter) commit() error {
+	if self.stream == nil && len(self.pending) == 0 {
+		return nil
+	}
+
+	return self.withRetries(func() error {
+		if self.stream == nil {
+			if err := self.open(); err != nil {
+				return err
+			}
+		}
+
+		summary, err := self.stream.CloseAndRecv()
+		self.stream = nil
+		if err != nil {
+			return err
+		}
+		if summary.Received < int64(len(self.pending)) {
+			log.Printf(
+				"WARNING: collector received %d devices, %d were sent",
+				summary.Received, len(self.pending),
+			)
+		}
+		self.pending = self.pending[:0]
+		return nil
+	})
+}
+
+// Opens a new stream, and sends devices that were pending on the previous one.
+func (self *grpcOutputWriter) open() error {
+	stream, err := self.client.PushDeviceData(self.ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, message := range self.pending {
+		if err := stream.Send(message); err != nil {
+			return self.streamErrorOf(stream, err)
+		}
+	}
+	self.stream = stream
+	return nil
+}
+
+// Calls fn again after transient errors, with exponential backoff, until the
+// run is cancelled.
+func (self *grpcOutputWriter) withRetries(fn func() error) error {
+	backoff := self.backoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= grpcStreamRetries || !isTransientGRPCError(err) {
+			return err
+		}
+
+		log.Printf("WARNING: could not stream to collector (%v), retrying in %v", err, backoff)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-self.runCtx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// Returns the actual error of a failed send on the current stream, and drops
+// the stream.
+func (self *grpcOutputWriter) streamError(err error) error {
+	err = self.streamErrorOf(self.stream, err)
+	self.stream = nil
+	return err
+}
+
+// Sends fail with io.EOF once the stream is aborted: its status is then only
+// known by receiving from it.
+func (self *grpcOutputWriter) streamErrorOf(stream collector.Collector_PushDeviceDataClient, err error) error {
+	if err != io.EOF {
+		return err
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// Checks whether a gRPC error may not happen again on a new stream, e.g. a
+// restarting collector, as opposed to e.g. a rejected message.
+func isTransientGRPCError(err error) bool {
+	if err == io.ErrUnexpectedEOF {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Aborted, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// Converts a device's data to its collector message, stamped with the run
+// timestamp.
+func deviceDataToProto(data *DeviceData, timestamp *timestamppb.Timestamp) *collector.DeviceData {
+	message := &collector.DeviceData{
+		Host:              data.Host,
+		Error:             data.Error,
+		GeneratedAt:       timestamp,
+		ResolvedIp:        data.ResolvedIP,
+		Ptr:               data.PTR,
+		SysName:           data.SysName,
+		SysDescr:          data.SysDescr,
+		SysObjectId:       data.SysObjectID,
+		QueryDurationMs:   data.QueryDurationMs,
+		PduCount:          int64(data.PDUCount),
+		SnmpVersion:       data.SNMPVersion,
+		SuspectReadings:   int64(data.SuspectReadings),
+		UnmappedPduCount:  int64(data.UnmappedPDUCount),
+		UnmappedPduSample: data.UnmappedPDUSample,
+	}
+	for _, port := range data.DroppedPorts {
+		message.DroppedPorts = append(message.DroppedPorts, port.String())
+	}
+	for _, port := range sortedPorts(data.OpticsByPort) {
+		message.Ports = append(message.Ports, portToProto(port, data.OpticsByPort[port]))
+	}
+	return message
+}
+
+func portToProto(port PortID, optics *OpticsData) *collector.Port {
+	message := &collector.Port{
+		Port:              uint32(port.Port),
+		Subport:           uint32(port.Subport),
+		Speed:             optics.Speed,
+		Description:       optics.Description,
+		Vendor:            optics.Vendor,
+		Model:             optics.Model,
+		SerialNum:         optics.SerialNum,
+		HardwareRev:       optics.HardwareRev,
+		InErrors:          optics.InErrors,
+		InOctets:          optics.InOctets,
+		InUnicastPkts:     optics.InUnicastPkts,
+		InMulticastPkts:   optics.InMulticastPkts,
+		InBroadcastPkts:   optics.InBroadcastPkts,
+		OutErrors:         optics.OutErrors,
+		OutOctets:         optics.OutOctets,
+		OutUnicastPkts:    optics.OutUnicastPkts,
+		OutMulticastPkts:  optics.OutMulticastPkts,
+		OutBroadcastPkts:  optics.OutBroadcastPkts,
+		UsingHcCounters:   optics.UsingHCCounters,
+		ModuleTemperature: optics.ModuleTemperature,
+		ModuleVoltage:     optics.ModuleVoltage,
+		LaneCount:         optics.LaneCount,
+		TotalRxPowerDbm:   optics.TotalRxPowerDbm,
+		TotalTxPowerDbm:   optics.TotalTxPowerDbm,
+	}
+	if optics.AdminStatus != 0 {
+		message.AdminStatus = optics.AdminStatus.String()
+	}
+	if optics.OperStatus != 0 {
+		message.OperStatus = optics.OperStatus.String()
+	}
+	if optics.DiscontinuityTime != nil {
+		message.DiscontinuityTime = timestamppb.New(*optics.DiscontinuityTime)
+	}
+
+	for _, lane := range sortedLanes(optics.SensorsByLane) {
+		sensor := optics.SensorsByLane[lane]
+		message.Lanes = append(message.Lanes, &collector.Lane{
+			Lane:               uint32(lane),
+			LaserTemperature:   sensor.LaserTemperature,
+			RxLaserPower:       sensor.RxLaserPower,
+			TxLaserBiasCurrent: sensor.TxLaserBiasCurrent,
+			TxLaserPower:       sensor.TxLaserPower,
+		})
+	}
+	return message
+}
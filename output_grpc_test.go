@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/criteo/netopticon/collector"
+)
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Collector recording the hosts it receives, which aborts its first streams
+// after receiving a given number of devices on each, with failCode (or
+// Unavailable if unset).
+type fakeCollector struct {
+	collector.UnimplementedCollectorServer
+
+	mutex     sync.Mutex
+	hosts     []string
+	failures  int
+	failAfter int
+	failCode  codes.Code
+}
+
+func (self *fakeCollector) PushDeviceData(stream collector.Collector_PushDeviceDataServer) error {
+	var hosts []string
+	for {
+		message, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		hosts = append(hosts, message.Host)
+
+		self.mutex.Lock()
+		fail := self.failures > 0 && len(hosts) > self.failAfter
+		if fail {
+			self.failures--
+		}
+		self.mutex.Unlock()
+		if fail && self.failCode != codes.OK {
+			return status.Error(self.failCode, "collector failure")
+		}
+		if fail {
+			return status.Error(codes.Unavailable, "collector restarting")
+		}
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.hosts = append(self.hosts, hosts...)
+	return stream.SendAndClose(&collector.PushSummary{Received: int64(len(hosts))})
+}
+
+func startFakeCollector(t *testing.T, fake *fakeCollector) *grpc.ClientConn {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	collector.RegisterCollectorServer(server, fake)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func newTestGRPCOutputWriter(t *testing.T, fake *fakeCollector) *grpcOutputWriter {
+	return newTestGRPCOutputWriterWithContext(t, context.Background(), fake)
+}
+
+func newTestGRPCOutputWriterWithContext(
+	t *testing.T,
+	runCtx context.Context,
+	fake *fakeCollector,
+) *grpcOutputWriter {
+	writer := newGRPCOutputWriterForConn(runCtx, startFakeCollector(t, fake), time.Unix(1700000000, 0))
+	writer.backoff = time.Millisecond
+	if err := writer.open(); err != nil {
+		t.Fatal(err)
+	}
+	return writer
+}
+
+func TestGRPCOutputWriterStreamsDevices(t *testing.T) {
+	fake := &fakeCollector{}
+	writer := newTestGRPCOutputWriter(t, fake)
+
+	for _, host := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		if err := writer.Write(&DeviceData{Host: host}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+	if !equalStrings(fake.hosts, expected) {
+		t.Errorf("collector received %v, expected %v", fake.hosts, expected)
+	}
+}
+
+func TestGRPCOutputWriterReconnects(t *testing.T) {
+	fake := &fakeCollector{failures: 2, failAfter: 1}
+	writer := newTestGRPCOutputWriter(t, fake)
+
+	hosts := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"}
+	for _, host := range hosts {
+		if err := writer.Write(&DeviceData{Host: host}); err != nil {
+			t.Fatal(err)
+		}
+		// Let the collector abort the stream before the next send
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Devices of aborted streams are sent again on the next one
+	if !equalStrings(fake.hosts, hosts) {
+		t.Errorf("collector received %v, expected %v", fake.hosts, hosts)
+	}
+}
+
+func TestGRPCOutputWriterCommitsBatches(t *testing.T) {
+	fake := &fakeCollector{}
+	writer := newTestGRPCOutputWriter(t, fake)
+	writer.batchSize = 2
+
+	hosts := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"}
+	for _, host := range hosts {
+		if err := writer.Write(&DeviceData{Host: host}); err != nil {
+			t.Fatal(err)
+		}
+		// Devices acknowledged by the collector are not kept
+		if len(writer.pending) >= writer.batchSize {
+			t.Errorf("expected at most %d pending devices, got %d", writer.batchSize-1, len(writer.pending))
+		}
+	}
+
+	// Only the first 4 devices were committed before closing
+	fake.mutex.Lock()
+	committed := append([]string(nil), fake.hosts...)
+	fake.mutex.Unlock()
+	if !equalStrings(committed, hosts[:4]) {
+		t.Errorf("collector received %v before close, expected %v", committed, hosts[:4])
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !equalStrings(fake.hosts, hosts) {
+		t.Errorf("collector received %v, expected %v", fake.hosts, hosts)
+	}
+}
+
+func TestGRPCOutputWriterRetriesStopOnCancel(t *testing.T) {
+	runCtx, cancel := context.WithCancel(context.Background())
+	fake := &fakeCollector{failures: 10}
+	writer := newTestGRPCOutputWriterWithContext(t, runCtx, fake)
+	writer.backoff = time.Hour
+	cancel()
+
+	// The collector aborts the stream, which would otherwise be retried in an
+	// hour.
+	closed := make(chan error, 1)
+	go func() {
+		if err := writer.Write(&DeviceData{Host: "10.0.0.1"}); err != nil {
+			closed <- err
+			return
+		}
+		closed <- writer.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		if status.Code(err) != codes.Unavailable {
+			t.Errorf("expected an Unavailable error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("retries did not stop once the run was cancelled")
+	}
+}
+
+func TestGRPCOutputWriterPermanentError(t *testing.T) {
+	fake := &fakeCollector{failures: 1, failCode: codes.InvalidArgument}
+	writer := newTestGRPCOutputWriter(t, fake)
+
+	// The error shows up on the next send or once the stream is closed, and
+	// the stream is not opened again.
+	err := writer.Write(&DeviceData{Host: "10.0.0.1"})
+	time.Sleep(10 * time.Millisecond)
+	if err == nil {
+		err = writer.Write(&DeviceData{Host: "10.0.0.2"})
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected an InvalidArgument error, got %v", err)
+	}
+	if fake.failures != 0 || len(fake.hosts) != 0 {
+		t.Errorf("collector should have rejected the only stream, got %v", fake.hosts)
+	}
+}
+
+func TestDeviceDataToProto(t *testing.T) {
+	discontinuity := time.Unix(1600000000, 0)
+	data := &DeviceData{
+		Host:         "10.0.0.1",
+		PDUCount:     42,
+		DroppedPorts: []PortID{{Port: 3}, {Port: 4, Subport: 1}},
+		OpticsByPort: map[PortID]*OpticsData{
+			{Port: 2}: {OperStatus: OperUp},
+			{Port: 1}: {
+				Speed:             100000000000,
+				AdminStatus:       AdminUp,
+				InOctets:          1234,
+				DiscontinuityTime: &discontinuity,
+				SensorsByLane: map[uint]*OpticalSensor{
+					2: {RxLaserPower: -3},
+					1: {RxLaserPower: -2.5, TxLaserBiasCurrent: 0.007},
+				},
+			},
+		},
+	}
+
+	message := deviceDataToProto(data, nil)
+	if message.Host != "10.0.0.1" || message.PduCount != 42 {
+		t.Errorf("unexpected device fields: %v", message)
+	}
+	if !equalStrings(message.DroppedPorts, []string{"3", "4/1"}) {
+		t.Errorf("unexpected dropped ports: %v", message.DroppedPorts)
+	}
+	if len(message.Ports) != 2 || message.Ports[0].Port != 1 || message.Ports[1].Port != 2 {
+		t.Fatalf("expected ports 1 and 2 in order, got %v", message.Ports)
+	}
+
+	port := message.Ports[0]
+	if port.Speed != 100000000000 || port.InOctets != 1234 || port.AdminStatus != "up" || port.OperStatus != "" {
+		t.Errorf("unexpected port fields: %v", port)
+	}
+	if !port.DiscontinuityTime.AsTime().Equal(discontinuity) {
+		t.Errorf("unexpected discontinuity time: %v", port.DiscontinuityTime.AsTime())
+	}
+	if len(port.Lanes) != 2 || port.Lanes[0].Lane != 1 || port.Lanes[0].RxLaserPower != -2.5 ||
+		port.Lanes[1].Lane != 2 || port.Lanes[1].RxLaserPower != -3 {
+		t.Errorf("unexpected lanes: %v", port.Lanes)
+	}
+	if message.Ports[1].OperStatus != "up" {
+		t.Errorf("unexpected oper status: %q", message.Ports[1].OperStatus)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Writes InfluxDB line protocol records, one per port and one per lane, all
+// stamped with the run timestamp. Records are written as results come in.
+type influxOutputWriter struct {
+	w         *bufio.Writer
+	timestamp string
+}
+
+func newInfluxOutputWriter(w io.Writer, timestamp time.Time) *influxOutputWriter {
+	return &influxOutputWriter{
+		w:         bufio.NewWriter(w),
+		timestamp: strconv.FormatInt(timestamp.UnixNano(), 10),
+	}
+}
+
+func (self *influxOutputWriter) Write(data *DeviceData) error {
+	for _, port := range sortedPorts(data.OpticsByPort) {
+		optics := data.OpticsByPort[port]
+		portStr := port.String()
+
+		var fields influxFields
+		fields.addUint("speed", optics.Speed)
+		fields.addUint("in_errors", optics.InErrors)
+		fields.addUint("in_octets", optics.InOctets)
+		fields.addUint("in_unicast_pkts", optics.InUnicastPkts)
+		fields.addUint("in_multicast_pkts", optics.InMulticastPkts)
+		fields.addUint("in_broadcast_pkts", optics.InBroadcastPkts)
+		fields.addUint("out_errors", optics.OutErrors)
+		fields.addUint("out_octets", optics.OutOctets)
+		fields.addUint("out_unicast_pkts", optics.OutUnicastPkts)
+		fields.addUint("out_multicast_pkts", optics.OutMulticastPkts)
+		fields.addUint("out_broadcast_pkts", optics.OutBroadcastPkts)
+		fields.addFloat("module_temperature", optics.ModuleTemperature)
+		fields.addFloat("module_voltage", optics.ModuleVoltage)
+		self.writeRecord(fields, "host", data.Host, "port", portStr)
+
+		for _, lane := range sortedLanes(optics.SensorsByLane) {
+			sensor := optics.SensorsByLane[lane]
+
+			var fields influxFields
+			fields.addFloat("laser_temperature", sensor.LaserTemperature)
+			fields.addFloat("rx_power", sensor.RxLaserPower)
+			fields.addFloat("tx_power", sensor.TxLaserPower)
+			fields.addFloat("tx_bias_current", sensor.TxLaserBiasCurrent)
+			self.writeRecord(
+				fields,
+				"host", data.Host,
+				"port", portStr,
+				"lane", strconv.FormatUint(uint64(lane), 10),
+			)
+		}
+	}
+
+	return nil
+}
+
+func (self *influxOutputWriter) Close() error {
+	return self.w.Flush()
+}
+
+// Writes an "optics" record. Tags are given as alternating names and values.
+// Records without any valid field are skipped, as Influx rejects them.
+func (self *influxOutputWriter) writeRecord(fields influxFields, tags ...string) {
+	if len(fields) == 0 {
+		return
+	}
+
+	self.w.WriteString("optics")
+	for i := 0; i+1 < len(tags); i += 2 {
+		self.w.WriteRune(',')
+		self.w.WriteString(influxTagEscaper.Replace(tags[i]))
+		self.w.WriteRune('=')
+		self.w.WriteString(influxTagEscaper.Replace(tags[i+1]))
+	}
+	self.w.WriteRune(' ')
+	self.w.WriteString(strings.Join(fields, ","))
+	self.w.WriteRune(' ')
+	self.w.WriteString(self.timestamp)
+	self.w.WriteRune('\n')
+}
+
+var influxTagEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, `=`, `\=`)
+
+// Serialized "key=value" fields of a record.
+type influxFields []string
+
+// Adds an integer field. Influx integers are signed, and lines with larger
+// values are rejected: those are clamped rather than written as unsigned
+// integers ("u"), which would conflict with the type of existing fields.
+func (self *influxFields) addUint(key string, value uint64) {
+	if value > math.MaxInt64 {
+		log.Printf("WARNING: influx field %s: %d clamped to %d", key, value, int64(math.MaxInt64))
+		value = math.MaxInt64
+	}
+	*self = append(*self, key+"="+strconv.FormatUint(value, 10)+"i")
+}
+
+// Adds a float field, unless it is NaN or infinite as Influx rejects those.
+func (self *influxFields) addFloat(key string, value float32) {
+	if math.IsNaN(float64(value)) || math.IsInf(float64(value), 0) {
+		return
+	}
+	*self = append(*self, key+"="+strconv.FormatFloat(float64(value), 'g', -1, 32))
+}
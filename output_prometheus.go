@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Description of a metric exported for each port.
+type portMetric struct {
+	name  string
+	help  string
+	kind  string
+	value func(*OpticsData) float64
+}
+
+// Description of a metric exported for each lane of a port.
+type laneMetric struct {
+	name  string
+	help  string
+	kind  string
+	value func(*OpticalSensor) float64
+}
+
+var prometheusPortMetrics = []portMetric{
+	{"netopticon_speed_megabits", "Interface speed in megabits/sec.", "gauge",
+		func(d *OpticsData) float64 { return float64(d.Speed) }},
+	{"netopticon_in_errors_total", "Inbound packets with errors.", "counter",
+		func(d *OpticsData) float64 { return float64(d.InErrors) }},
+	{"netopticon_in_octets_total", "Inbound octets.", "counter",
+		func(d *OpticsData) float64 { return float64(d.InOctets) }},
+	{"netopticon_in_unicast_packets_total", "Inbound unicast packets.", "counter",
+		func(d *OpticsData) float64 { return float64(d.InUnicastPkts) }},
+	{"netopticon_in_multicast_packets_total", "Inbound multicast packets.", "counter",
+		func(d *OpticsData) float64 { return float64(d.InMulticastPkts) }},
+	{"netopticon_in_broadcast_packets_total", "Inbound broadcast packets.", "counter",
+		func(d *OpticsData) float64 { return float64(d.InBroadcastPkts) }},
+	{"netopticon_out_errors_total", "Outbound packets with errors.", "counter",
+		func(d *OpticsData) float64 { return float64(d.OutErrors) }},
+	{"netopticon_out_octets_total", "Outbound octets.", "counter",
+		func(d *OpticsData) float64 { return float64(d.OutOctets) }},
+	{"netopticon_out_unicast_packets_total", "Outbound unicast packets.", "counter",
+		func(d *OpticsData) float64 { return float64(d.OutUnicastPkts) }},
+	{"netopticon_out_multicast_packets_total", "Outbound multicast packets.", "counter",
+		func(d *OpticsData) float64 { return float64(d.OutMulticastPkts) }},
+	{"netopticon_out_broadcast_packets_total", "Outbound broadcast packets.", "counter",
+		func(d *OpticsData) float64 { return float64(d.OutBroadcastPkts) }},
+	{"netopticon_module_temperature_celsius", "Optical module temperature.", "gauge",
+		func(d *OpticsData) float64 { return float64(d.ModuleTemperature) }},
+	{"netopticon_module_voltage_volts", "Optical module supply voltage.", "gauge",
+		func(d *OpticsData) float64 { return float64(d.ModuleVoltage) }},
+}
+
+var prometheusLaneMetrics = []laneMetric{
+	{"netopticon_laser_temperature_celsius", "Laser temperature.", "gauge",
+		func(s *OpticalSensor) float64 { return float64(s.LaserTemperature) }},
+	{"netopticon_rx_laser_power_dbm", "Received optical power.", "gauge",
+		func(s *OpticalSensor) float64 { return float64(s.RxLaserPower) }},
+	{"netopticon_tx_laser_power_dbm", "Transmitted optical power.", "gauge",
+		func(s *OpticalSensor) float64 { return float64(s.TxLaserPower) }},
+	{"netopticon_tx_laser_bias_current_amperes", "Laser bias current.", "gauge",
+		func(s *OpticalSensor) float64 { return float64(s.TxLaserBiasCurrent) }},
+}
+
+// Writes metrics in the Prometheus text exposition format. All samples of a
+// metric must be grouped together, so devices are buffered until Close.
+type prometheusOutputWriter struct {
+	w       io.Writer
+	devices []*DeviceData
+}
+
+func (self *prometheusOutputWriter) Write(data *DeviceData) error {
+	self.devices = append(self.devices, data)
+	return nil
+}
+
+func (self *prometheusOutputWriter) Close() error {
+	sort.Slice(self.devices, func(i, j int) bool {
+		return self.devices[i].Host < self.devices[j].Host
+	})
+
+	bw := bufio.NewWriter(self.w)
+
+	writePrometheusHeader(bw, "netopticon_up", "Whether the host was successfully queried.", "gauge")
+	for _, device := range self.devices {
+		up := 1.0
+		if device.Error != "" {
+			up = 0
+		}
+		writePrometheusSample(bw, "netopticon_up", up, "host", device.Host)
+	}
+
+	for _, metric := range prometheusPortMetrics {
+		writePrometheusHeader(bw, metric.name, metric.help, metric.kind)
+		for _, device := range self.devices {
+			for _, port := range sortedPorts(device.OpticsByPort) {
+				writePrometheusSample(
+					bw, metric.name, metric.value(device.OpticsByPort[port]),
+					"host", device.Host,
+					"port", port.String(),
+				)
+			}
+		}
+	}
+
+	for _, metric := range prometheusLaneMetrics {
+		writePrometheusHeader(bw, metric.name, metric.help, metric.kind)
+		for _, device := range self.devices {
+			for _, port := range sortedPorts(device.OpticsByPort) {
+				optics := device.OpticsByPort[port]
+				for _, lane := range sortedLanes(optics.SensorsByLane) {
+					writePrometheusSample(
+						bw, metric.name, metric.value(optics.SensorsByLane[lane]),
+						"host", device.Host,
+						"port", port.String(),
+						"lane", strconv.FormatUint(uint64(lane), 10),
+					)
+				}
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+func writePrometheusHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// Writes a sample line. Labels are given as alternating names and values.
+func writePrometheusSample(w io.Writer, name string, value float64, labels ...string) {
+	var sb strings.Builder
+
+	sb.WriteString(name)
+	sb.WriteRune('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			sb.WriteRune(',')
+		}
+		sb.WriteString(labels[i])
+		sb.WriteString(`="`)
+		sb.WriteString(prometheusLabelEscaper.Replace(labels[i+1]))
+		sb.WriteRune('"')
+	}
+	sb.WriteString("} ")
+	sb.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	sb.WriteRune('\n')
+
+	io.WriteString(w, sb.String())
+}
+
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
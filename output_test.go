@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestHostMapMarshalJSON(t *testing.T) {
+	hosts := hostMap{
+		"spine1":        {Host: "spine1"},
+		"10.0.0.10":     {Host: "10.0.0.10"},
+		"2001:db8::1":   {Host: "2001:db8::1", Error: "timeout"},
+		"10.0.0.2":      {Host: "10.0.0.2"},
+		"leaf1.example": {Host: "leaf1.example"},
+	}
+
+	encoded, err := json.Marshal(hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys are in lessHost order, rather than lexical order.
+	var keys []string
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.Token() // {
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key.(string))
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []string{"10.0.0.2", "10.0.0.10", "2001:db8::1", "leaf1.example", "spine1"}
+	if !equalStrings(keys, expected) {
+		t.Errorf("got keys %v, expected %v", keys, expected)
+	}
+
+	// The output is still a regular JSON object.
+	var decoded map[string]*DeviceData
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(hosts) || decoded["2001:db8::1"].Error != "timeout" {
+		t.Errorf("unexpected decoded hosts: %v", decoded)
+	}
+}
+
+func TestInfluxFieldsAddUint(t *testing.T) {
+	var fields influxFields
+	output := captureLog(func() {
+		fields.addUint("in_octets", 42)
+		fields.addUint("out_octets", math.MaxInt64)
+		fields.addUint("in_errors", math.MaxUint64)
+	})
+
+	expected := []string{
+		"in_octets=42i",
+		"out_octets=9223372036854775807i",
+		"in_errors=9223372036854775807i",
+	}
+	if !equalStrings(fields, expected) {
+		t.Errorf("got fields %v, expected %v", fields, expected)
+	}
+	if strings.Count(output, "\n") != 1 || !strings.Contains(output, "in_errors") {
+		t.Errorf("expected a warning for in_errors only, got %q", output)
+	}
+}
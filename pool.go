@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+import (
+	"github.com/soniah/gosnmp"
+)
+
+// Connected clients left idle by queries (with -reuse-connections), so that
+// hosts behind the same agent are queried over the same connection. Clients
+// are borrowed exclusively, as gosnmp connections cannot be used for parallel
+// requests. At most maxIdle clients are kept, the oldest being closed first.
+type clientPool struct {
+	mutex   sync.Mutex
+	maxIdle int
+	idle    []pooledClient // Oldest first
+}
+
+type pooledClient struct {
+	key    string
+	client *gosnmp.GoSNMP
+}
+
+func newClientPool(maxIdle int) *clientPool {
+	return &clientPool{maxIdle: maxIdle}
+}
+
+// Identifies the agent endpoint and credentials of a client: only clients with
+// the same key are interchangeable. The endpoint is the address the target
+// resolves to, so that host names of logical devices behind the same agent
+// share connections: the target of the client is replaced with that address,
+// for its connection to match the key. Lookups are bounded by -timeout.
+func clientPoolKey(ctx context.Context, client *gosnmp.GoSNMP, credentials *Credentials) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, snmpTimeout)
+	defer cancel()
+	ip, err := lookupIP(ctx, client.Target)
+	if err != nil {
+		return "", err
+	}
+	client.Target = ip
+
+	return fmt.Sprintf(
+		"%s|%s|%d|%d|%s|%s|%d|%s|%d|%s",
+		client.Transport, ip, client.Port, client.Version,
+		credentials.Community, credentials.User,
+		credentials.AuthProto, credentials.AuthPass,
+		credentials.PrivProto, credentials.PrivPass,
+	), nil
+}
+
+// Takes an idle client with the given key, if any. It must be given back with
+// put, or closed.
+func (self *clientPool) get(key string) *gosnmp.GoSNMP {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for i := len(self.idle) - 1; i >= 0; i-- {
+		if self.idle[i].key == key {
+			client := self.idle[i].client
+			self.idle = append(self.idle[:i], self.idle[i+1:]...)
+			return client
+		}
+	}
+	return nil
+}
+
+// Gives back a connected client for later queries.
+func (self *clientPool) put(key string, client *gosnmp.GoSNMP) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.maxIdle < 1 {
+		client.Conn.Close()
+		return
+	}
+	if len(self.idle) >= self.maxIdle {
+		self.idle[0].client.Conn.Close()
+		self.idle = self.idle[1:]
+	}
+	self.idle = append(self.idle, pooledClient{key, client})
+}
+
+// Closes all idle clients.
+func (self *clientPool) close() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for _, idle := range self.idle {
+		idle.client.Conn.Close()
+	}
+	self.idle = nil
+}
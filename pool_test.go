@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+import (
+	"github.com/soniah/gosnmp"
+)
+
+func TestClientPoolKey(t *testing.T) {
+	community := &Credentials{Community: "public"}
+	testCases := []struct {
+		a, b        string
+		credentials *Credentials
+		same        bool
+	}{
+		{"10.0.0.1", "10.0.0.1", community, true},
+		// Equivalent spellings of an address share connections
+		{"2001:db8::1", "2001:0db8:0:0::1", community, true},
+		{"10.0.0.1", "10.0.0.2", community, false},
+		{"10.0.0.1", "10.0.0.1", &Credentials{Community: "private"}, false},
+	}
+
+	for _, testCase := range testCases {
+		clientA := &gosnmp.GoSNMP{Target: testCase.a, Port: 161, Version: gosnmp.Version2c}
+		clientB := &gosnmp.GoSNMP{Target: testCase.b, Port: 161, Version: gosnmp.Version2c}
+		keyA, err := clientPoolKey(context.Background(), clientA, community)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyB, err := clientPoolKey(context.Background(), clientB, testCase.credentials)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if (keyA == keyB) != testCase.same {
+			t.Errorf("%s and %s: got keys %q and %q", testCase.a, testCase.b, keyA, keyB)
+		}
+		// Clients connect to the address their key was built from
+		if clientA.Target != clientB.Target && testCase.same {
+			t.Errorf("%s and %s: got targets %s and %s", testCase.a, testCase.b, clientA.Target, clientB.Target)
+		}
+	}
+}
+
+func TestClientPoolGetPut(t *testing.T) {
+	pool := newClientPool(2)
+	first, second := &gosnmp.GoSNMP{}, &gosnmp.GoSNMP{}
+	pool.put("a", first)
+	pool.put("b", second)
+
+	if client := pool.get("c"); client != nil {
+		t.Errorf("unexpected client for an unknown key")
+	}
+	if client := pool.get("a"); client != first {
+		t.Errorf("expected the client put with key a")
+	}
+	// Clients are borrowed exclusively
+	if client := pool.get("a"); client != nil {
+		t.Errorf("client with key a was returned twice")
+	}
+	if client := pool.get("b"); client != second {
+		t.Errorf("expected the client put with key b")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+import (
+	"github.com/soniah/gosnmp"
+)
+
+// sysObjectID instance, served by all agents: GETting it is a cheap way to
+// check that an agent answers to a given SNMP version.
+const sysObjectIDInstance = ".1.3.6.1.2.1.1.2.0"
+
+var errNoSuchName = errors.New("noSuchName")
+
+// Sets the SNMP version of a client from -version, probing the host with
+// "auto". SNMPv3 clients are left as is.
+func selectSNMPVersion(client *gosnmp.GoSNMP, credentials *Credentials) error {
+	if credentials.V3 {
+		return nil
+	}
+
+	switch snmpVersion {
+	case "1":
+		client.Version = gosnmp.Version1
+	case "auto":
+		version, err := probeSNMPVersion(client)
+		if err != nil {
+			return err
+		}
+		client.Version = version
+	}
+	return nil
+}
+
+// Finds the SNMP version (v2c or v1) a host answers to, with a single GET per
+// version. SNMPv1 is only tried if SNMPv2c times out or fails with noSuchName,
+// as SNMPv1-only agents do.
+func probeSNMPVersion(client *gosnmp.GoSNMP) (gosnmp.SnmpVersion, error) {
+	err := probeGet(client, gosnmp.Version2c)
+	if err == nil {
+		return gosnmp.Version2c, nil
+	}
+	if !isTimeoutError(err) && err != errNoSuchName {
+		return client.Version, err
+	}
+
+	if err := probeGet(client, gosnmp.Version1); err != nil {
+		return client.Version, fmt.Errorf("no answer to SNMPv2c nor SNMPv1: %v", err)
+	}
+	return gosnmp.Version1, nil
+}
+
+// GETs sysObjectID with a given SNMP version, on its own connection.
+func probeGet(client *gosnmp.GoSNMP, version gosnmp.SnmpVersion) error {
+	probe := *client
+	probe.Version = version
+	probe.Conn = nil
+	if err := probe.Connect(); err != nil {
+		return err
+	}
+	defer probe.Conn.Close()
+
+	packet, err := probe.Get([]string{sysObjectIDInstance})
+	if err != nil {
+		return err
+	}
+
+	switch packet.Error {
+	case gosnmp.NoError:
+		return nil
+	case gosnmp.NoSuchName:
+		return errNoSuchName
+	}
+	return fmt.Errorf("error status %d", packet.Error)
+}
+
+// Returns the name of an SNMP version, as reported in DeviceData.
+func snmpVersionName(version gosnmp.SnmpVersion) string {
+	switch version {
+	case gosnmp.Version1:
+		return "1"
+	case gosnmp.Version2c:
+		return "2c"
+	case gosnmp.Version3:
+		return "3"
+	}
+	return ""
+}
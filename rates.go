@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Traffic and error rates of a port between two runs (-counter-rates).
+type PortRates struct {
+	Host string
+	Port PortID
+
+	InBitsPerSec    float64
+	OutBitsPerSec   float64
+	InErrorsPerSec  float64
+	OutErrorsPerSec float64
+
+	// Percentage of the speed of the port, if known.
+	InUtilization  *float64 `json:",omitempty"`
+	OutUtilization *float64 `json:",omitempty"`
+
+	// Why rates could not be computed, in which case they are zero.
+	Error string `json:",omitempty"`
+}
+
+// Computes rates from the counters of two outputs given as arguments (old
+// then new), and prints them as a table or JSON. Returns the exit status.
+func runCounterRates(args []string, format string) int {
+	if len(args) != 2 {
+		fmt.Println("error: -counter-rates takes two outputs, old then new.")
+		return 1
+	}
+	if format != "table" && format != "json" {
+		fmt.Println("error: -counter-rates-format must be 'table' or 'json'.")
+		return 1
+	}
+
+	var results [2]map[string]*DeviceData
+	for i, path := range args {
+		var err error
+		if results[i], err = loadPreviousResults(path); err != nil {
+			fmt.Println("error: could not load output:", err)
+			return 1
+		}
+	}
+
+	// Interval between the runs, for hosts without collection time (outputs
+	// of earlier versions).
+	var runInterval time.Duration
+	if oldTimestamp, err := loadRunTimestamp(args[0]); err == nil {
+		if newTimestamp, err := loadRunTimestamp(args[1]); err == nil {
+			runInterval = newTimestamp.Sub(oldTimestamp)
+		}
+	}
+
+	rates := computeRates(results[0], results[1], runInterval)
+	var err error
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(rates)
+	} else {
+		err = printRates(os.Stdout, rates)
+	}
+	if err != nil {
+		fmt.Println("error:", err)
+		return 1
+	}
+	return 0
+}
+
+// Returns the rates of ports found in both runs, sorted by host and port.
+// Hosts that failed in either run are skipped. Rates are computed over the
+// interval between the collection times of each host, or runInterval if
+// unknown.
+func computeRates(oldResults, newResults map[string]*DeviceData, runInterval time.Duration) []*PortRates {
+	hosts := make([]string, 0, len(newResults))
+	for host, newData := range newResults {
+		oldData := oldResults[host]
+		if oldData != nil && oldData.Error == "" && newData.Error == "" {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Slice(hosts, func(i, j int) bool { return lessHost(hosts[i], hosts[j]) })
+
+	rates := []*PortRates{}
+	for _, host := range hosts {
+		oldData, newData := oldResults[host], newResults[host]
+		interval := runInterval
+		if oldData.CollectedAt != nil && newData.CollectedAt != nil {
+			interval = newData.CollectedAt.Sub(*oldData.CollectedAt)
+		}
+
+		for _, port := range sortedPorts(newData.OpticsByPort) {
+			if oldOptics := oldData.OpticsByPort[port]; oldOptics != nil {
+				portRates := computePortRates(oldOptics, newData.OpticsByPort[port], interval)
+				portRates.Host = host
+				portRates.Port = port
+				rates = append(rates, portRates)
+			}
+		}
+	}
+	return rates
+}
+
+// Computes the rates of a port from its counters in two runs.
+func computePortRates(oldOptics, newOptics *OpticsData, interval time.Duration) *PortRates {
+	rates := &PortRates{}
+
+	// Unknown collection and run times, or outputs given in the wrong order.
+	if interval <= 0 {
+		rates.Error = "no interval between runs"
+		return rates
+	}
+
+	// Counters restarted in between (e.g. agent restart), if collected.
+	if oldOptics.DiscontinuityTime != nil && newOptics.DiscontinuityTime != nil &&
+		!sameDiscontinuity(*oldOptics.DiscontinuityTime, *newOptics.DiscontinuityTime) {
+		rates.Error = "counter discontinuity"
+		return rates
+	}
+	if oldOptics.UsingHCCounters != newOptics.UsingHCCounters {
+		rates.Error = "counter width changed"
+		return rates
+	}
+
+	// Octets come from 64-bit counters if available, errors always from
+	// 32-bit ones.
+	octetBits := uint(32)
+	if newOptics.UsingHCCounters {
+		octetBits = 64
+	}
+	inOctets, inOk := counterDelta(oldOptics.InOctets, newOptics.InOctets, octetBits)
+	outOctets, outOk := counterDelta(oldOptics.OutOctets, newOptics.OutOctets, octetBits)
+	inErrors, _ := counterDelta(oldOptics.InErrors, newOptics.InErrors, 32)
+	outErrors, _ := counterDelta(oldOptics.OutErrors, newOptics.OutErrors, 32)
+	if !inOk || !outOk {
+		rates.Error = "counter reset"
+		return rates
+	}
+
+	seconds := interval.Seconds()
+	rates.InBitsPerSec = float64(inOctets) * 8 / seconds
+	rates.OutBitsPerSec = float64(outOctets) * 8 / seconds
+	rates.InErrorsPerSec = float64(inErrors) / seconds
+	rates.OutErrorsPerSec = float64(outErrors) / seconds
+
+	// Speed is in Mb/s.
+	if newOptics.Speed > 0 {
+		speed := float64(newOptics.Speed) * 1e6
+		inUtilization := rates.InBitsPerSec / speed * 100
+		outUtilization := rates.OutBitsPerSec / speed * 100
+		rates.InUtilization = &inUtilization
+		rates.OutUtilization = &outUtilization
+	}
+
+	return rates
+}
+
+// Discontinuity times are estimated from the agent uptime at query time, so
+// that those of successive runs differ by the latency of the queries even
+// when counters were not reset.
+const discontinuityTolerance = 5 * time.Second
+
+// Checks whether two discontinuity times are the same, within
+// discontinuityTolerance.
+func sameDiscontinuity(a, b time.Time) bool {
+	delta := a.Sub(b)
+	return delta <= discontinuityTolerance && delta >= -discontinuityTolerance
+}
+
+// Returns the increase of a counter of a given width (32 or 64 bits) between
+// two readings, assuming it wrapped at most once. Returns false if a 64-bit
+// counter went backwards, which means it was reset rather than wrapped.
+func counterDelta(oldValue, newValue uint64, bits uint) (uint64, bool) {
+	if newValue >= oldValue {
+		return newValue - oldValue, true
+	}
+	if bits == 64 {
+		return 0, false
+	}
+	return newValue + 1<<32 - oldValue, true
+}
+
+// Prints rates as a table, one port per line.
+func printRates(w io.Writer, rates []*PortRates) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "HOST\tPORT\tIN_BPS\tOUT_BPS\tIN_UTIL\tOUT_UTIL\tIN_ERR/S\tOUT_ERR/S\tERROR")
+	for _, portRates := range rates {
+		if portRates.Error != "" {
+			fmt.Fprintf(
+				table, "%s\t%s\t-\t-\t-\t-\t-\t-\t%s\n",
+				portRates.Host, portRates.Port, portRates.Error,
+			)
+			continue
+		}
+
+		fmt.Fprintf(
+			table, "%s\t%s\t%.0f\t%.0f\t%s\t%s\t%.3f\t%.3f\t-\n",
+			portRates.Host, portRates.Port,
+			portRates.InBitsPerSec, portRates.OutBitsPerSec,
+			formatUtilization(portRates.InUtilization),
+			formatUtilization(portRates.OutUtilization),
+			portRates.InErrorsPerSec, portRates.OutErrorsPerSec,
+		)
+	}
+	return table.Flush()
+}
+
+func formatUtilization(utilization *float64) string {
+	if utilization == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", *utilization)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		oldValue, newValue uint64
+		bits               uint
+		expected           uint64
+		ok                 bool
+	}{
+		{100, 250, 32, 150, true},
+		{100, 100, 64, 0, true},
+		// 32-bit counters wrap at 2^32
+		{1<<32 - 10, 5, 32, 15, true},
+		{1<<32 - 1, 0, 32, 1, true},
+		// 64-bit counters going backwards were reset
+		{1000, 10, 64, 0, false},
+		{1<<64 - 1, 0, 64, 0, false},
+		{1 << 40, 1<<40 + 5, 64, 5, true},
+	}
+
+	for _, test := range tests {
+		delta, ok := counterDelta(test.oldValue, test.newValue, test.bits)
+		if delta != test.expected || ok != test.ok {
+			t.Errorf(
+				"counterDelta(%d, %d, %d) = %d, %v, expected %d, %v",
+				test.oldValue, test.newValue, test.bits, delta, ok, test.expected, test.ok,
+			)
+		}
+	}
+}
+
+func TestComputePortRates(t *testing.T) {
+	interval := 100 * time.Second
+	restart := time.Unix(1700000000, 0)
+	jitteredRestart := restart.Add(-time.Second)
+	laterRestart := restart.Add(time.Hour)
+
+	tests := []struct {
+		name          string
+		oldOptics     OpticsData
+		newOptics     OpticsData
+		expectedIn    float64
+		expectedErr   float64
+		expectedError string
+	}{
+		{
+			name:        "32-bit",
+			oldOptics:   OpticsData{InOctets: 1000, InErrors: 10},
+			newOptics:   OpticsData{InOctets: 2000, InErrors: 60},
+			expectedIn:  80,
+			expectedErr: 0.5,
+		},
+		{
+			name:       "32-bit wrap",
+			oldOptics:  OpticsData{InOctets: 1<<32 - 500},
+			newOptics:  OpticsData{InOctets: 500},
+			expectedIn: 80,
+		},
+		{
+			name:       "64-bit",
+			oldOptics:  OpticsData{InOctets: 1 << 40, UsingHCCounters: true},
+			newOptics:  OpticsData{InOctets: 1<<40 + 1000, UsingHCCounters: true},
+			expectedIn: 80,
+		},
+		{
+			// Errors are 32-bit counters, even along 64-bit octet counters
+			name:        "64-bit with 32-bit error wrap",
+			oldOptics:   OpticsData{InOctets: 5000, InErrors: 1<<32 - 25, UsingHCCounters: true},
+			newOptics:   OpticsData{InOctets: 6000, InErrors: 25, UsingHCCounters: true},
+			expectedIn:  80,
+			expectedErr: 0.5,
+		},
+		{
+			name:          "64-bit reset",
+			oldOptics:     OpticsData{InOctets: 1 << 40, UsingHCCounters: true},
+			newOptics:     OpticsData{InOctets: 1000, UsingHCCounters: true},
+			expectedError: "counter reset",
+		},
+		{
+			name:          "counter width changed",
+			oldOptics:     OpticsData{InOctets: 1000},
+			newOptics:     OpticsData{InOctets: 2000, UsingHCCounters: true},
+			expectedError: "counter width changed",
+		},
+		{
+			name:          "discontinuity",
+			oldOptics:     OpticsData{InOctets: 1000, DiscontinuityTime: &restart},
+			newOptics:     OpticsData{InOctets: 2000, DiscontinuityTime: &laterRestart},
+			expectedError: "counter discontinuity",
+		},
+		{
+			name:       "same discontinuity",
+			oldOptics:  OpticsData{InOctets: 1000, DiscontinuityTime: &restart},
+			newOptics:  OpticsData{InOctets: 2000, DiscontinuityTime: &restart},
+			expectedIn: 80,
+		},
+		{
+			// Boot times estimated from the uptime vary with query latency
+			name:       "discontinuity jitter",
+			oldOptics:  OpticsData{InOctets: 1000, DiscontinuityTime: &restart},
+			newOptics:  OpticsData{InOctets: 2000, DiscontinuityTime: &jitteredRestart},
+			expectedIn: 80,
+		},
+		{
+			// Discontinuity times are only compared when collected in both runs
+			name:       "discontinuity not collected",
+			oldOptics:  OpticsData{InOctets: 1000},
+			newOptics:  OpticsData{InOctets: 2000, DiscontinuityTime: &laterRestart},
+			expectedIn: 80,
+		},
+	}
+
+	for _, test := range tests {
+		rates := computePortRates(&test.oldOptics, &test.newOptics, interval)
+		if rates.Error != test.expectedError {
+			t.Errorf("%s: expected error %q, got %q", test.name, test.expectedError, rates.Error)
+			continue
+		}
+		if rates.InBitsPerSec != test.expectedIn || rates.InErrorsPerSec != test.expectedErr {
+			t.Errorf(
+				"%s: expected %v b/s and %v errors/s, got %v and %v",
+				test.name, test.expectedIn, test.expectedErr, rates.InBitsPerSec, rates.InErrorsPerSec,
+			)
+		}
+	}
+}
+
+func TestComputePortRatesUtilization(t *testing.T) {
+	// 1 Gb/s over 10 Gb/s (speed is in Mb/s)
+	oldOptics := &OpticsData{InOctets: 0, OutOctets: 0, Speed: 10000}
+	newOptics := &OpticsData{InOctets: 125000000, OutOctets: 12500000, Speed: 10000}
+
+	rates := computePortRates(oldOptics, newOptics, time.Second)
+	if rates.InUtilization == nil || !approxEqual(float32(*rates.InUtilization), 10) ||
+		rates.OutUtilization == nil || !approxEqual(float32(*rates.OutUtilization), 1) {
+		t.Errorf("unexpected utilization: %v, %v", rates.InUtilization, rates.OutUtilization)
+	}
+
+	// Unknown speed
+	newOptics.Speed = 0
+	rates = computePortRates(oldOptics, newOptics, time.Second)
+	if rates.InUtilization != nil || rates.OutUtilization != nil {
+		t.Errorf("expected no utilization without speed, got %v, %v", rates.InUtilization, rates.OutUtilization)
+	}
+}
+
+func TestComputeRatesCollectionTimes(t *testing.T) {
+	collected := time.Unix(1700000000, 0)
+	later := collected.Add(100 * time.Second)
+	port := PortID{Port: 1}
+	result := func(host string, inOctets uint64, collectedAt *time.Time) *DeviceData {
+		return &DeviceData{
+			Host:         host,
+			CollectedAt:  collectedAt,
+			OpticsByPort: map[PortID]*OpticsData{port: {InOctets: inOctets}},
+		}
+	}
+
+	oldResults := map[string]*DeviceData{
+		"10.0.0.1": result("10.0.0.1", 1000, &collected),
+		"10.0.0.2": result("10.0.0.2", 1000, nil),
+		"10.0.0.3": result("10.0.0.3", 1000, &later),
+	}
+	newResults := map[string]*DeviceData{
+		"10.0.0.1": result("10.0.0.1", 2000, &later),
+		"10.0.0.2": result("10.0.0.2", 2000, &later),
+		"10.0.0.3": result("10.0.0.3", 2000, &collected),
+	}
+
+	// Hosts with collection times in both runs do not use the run interval,
+	// which is rounded.
+	rates := computeRates(oldResults, newResults, 200*time.Second)
+	if len(rates) != 3 {
+		t.Fatalf("expected 3 ports, got %d", len(rates))
+	}
+	if rates[0].InBitsPerSec != 80 {
+		t.Errorf("expected 80 b/s over the collection interval, got %v", rates[0].InBitsPerSec)
+	}
+	if rates[1].InBitsPerSec != 40 {
+		t.Errorf("expected 40 b/s over the run interval, got %v", rates[1].InBitsPerSec)
+	}
+	if rates[2].Error != "no interval between runs" {
+		t.Errorf("expected an interval error, got %q", rates[2].Error)
+	}
+
+	// Without run timestamps
+	rates = computeRates(oldResults, newResults, 0)
+	if rates[0].InBitsPerSec != 80 || rates[1].Error != "no interval between runs" {
+		t.Errorf("unexpected rates without run interval: %+v, %+v", rates[0], rates[1])
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Resolves the targets of hosts (-resolve), each at most once per run, so that
+// outputs can be cross-referenced whether hosts were listed by name or by IP.
+type hostResolver struct {
+	mutex   sync.Mutex
+	targets map[string]*resolvedTarget
+}
+
+// Addresses of a target, set once resolved.
+type resolvedTarget struct {
+	once sync.Once
+	ip   string
+	ptr  string
+}
+
+// Shared by all workers, nil unless -resolve is set.
+var targetResolver *hostResolver
+
+func newHostResolver() *hostResolver {
+	return &hostResolver{targets: make(map[string]*resolvedTarget)}
+}
+
+// Returns the IP address of a target (host name or IP), and its PTR name with
+// -resolve-ptr. Lookups are bounded by -timeout, and leave the results empty
+// on failure.
+func (self *hostResolver) resolve(ctx context.Context, target string) (ip, ptr string) {
+	self.mutex.Lock()
+	resolved, ok := self.targets[target]
+	if !ok {
+		resolved = &resolvedTarget{}
+		self.targets[target] = resolved
+	}
+	self.mutex.Unlock()
+
+	resolved.once.Do(func() {
+		ctx, cancel := context.WithTimeout(ctx, snmpTimeout)
+		defer cancel()
+		resolved.ip, resolved.ptr = lookupTarget(ctx, target)
+	})
+	return resolved.ip, resolved.ptr
+}
+
+func lookupTarget(ctx context.Context, target string) (ip, ptr string) {
+	ip, err := lookupIP(ctx, target)
+	if err != nil {
+		log.Printf("WARNING: could not resolve %s: %v", target, err)
+		return "", ""
+	}
+
+	if resolvePTR {
+		names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+		if err != nil {
+			log.Printf("WARNING: could not resolve PTR of %s: %v", ip, err)
+			return ip, ""
+		}
+		ptr = strings.TrimSuffix(names[0], ".")
+	}
+	return ip, ptr
+}
+
+// Returns the IP address of a target, in canonical form. IP literals only need
+// to be canonicalized, keeping their zone if any.
+func lookupIP(ctx context.Context, target string) (string, error) {
+	addr, zone := target, ""
+	if zoneIdx := strings.IndexByte(target, '%'); zoneIdx > 0 {
+		addr, zone = target[:zoneIdx], target[zoneIdx:]
+	}
+	if parsed := net.ParseIP(addr); parsed != nil {
+		return parsed.String() + zone, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, target)
+	if err != nil {
+		return "", err
+	}
+	return addrs[0].String(), nil
+}
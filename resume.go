@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Loads the data of hosts from the output of a previous run (-resume): either
+// a file written with -format json, json-flat or ndjson (possibly compressed,
+// or the temporary file of a crashed run), or a directory written with
+// -out-dir.
+func loadPreviousResults(path string) (map[string]*DeviceData, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]*DeviceData)
+	if !info.IsDir() {
+		return results, loadResultsFile(path, results)
+	}
+
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	names, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".json") && !strings.HasSuffix(name, ".json.gz") {
+			continue
+		}
+		if err := loadResultsFile(filepath.Join(path, name), results); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// Adds the data of hosts found in a JSON output file to results. Files may hold
+// a sequence of JSON values: the top-level object of -format json, data keyed
+// by host (json-flat), or the data of a single host (ndjson lines, -out-dir).
+func loadResultsFile(path string, results map[string]*DeviceData) error {
+	r, err := openOutput(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	decoder := json.NewDecoder(r)
+	for {
+		var value json.RawMessage
+		err := decoder.Decode(&value)
+		// The last line of a crashed ndjson run may be incomplete.
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(value, &members); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+
+		var hosts map[string]*DeviceData
+		if _, ok := members["Host"]; ok {
+			var data DeviceData
+			err = json.Unmarshal(value, &data)
+			hosts = map[string]*DeviceData{data.Host: &data}
+		} else if rawHosts, ok := members["hosts"]; ok {
+			err = json.Unmarshal(rawHosts, &hosts)
+		} else {
+			err = json.Unmarshal(value, &hosts)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+
+		for host, data := range hosts {
+			if data != nil {
+				data.Host = host
+				results[host] = data
+			}
+		}
+	}
+}
+
+// Output file being read, decompressed if needed.
+type outputReader struct {
+	io.Reader
+	file *os.File
+}
+
+func (self *outputReader) Close() error {
+	return self.file.Close()
+}
+
+// Opens an output file, decompressing it if it is gzip-compressed.
+func openOutput(path string) (*outputReader, error) {
+	fin, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	buffered := bufio.NewReader(fin)
+	out := &outputReader{Reader: buffered, file: fin}
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			fin.Close()
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		out.Reader = gzipReader
+	}
+	return out, nil
+}
+
+// Run timestamp in output paths, as substituted for '_TS_'.
+var runTimestampRegexp = regexp.MustCompile(`\d{4}-\d{2}-\d{2}-\d{4}`)
+
+// Returns the timestamp of the run that wrote an output: its generated_at with
+// -format json, or else the timestamp in its file or directory name (e.g. with
+// -out netopticon-_TS_.ndjson).
+func loadRunTimestamp(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if !info.IsDir() {
+		r, err := openOutput(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		defer r.Close()
+
+		var output struct {
+			GeneratedAt *time.Time `json:"generated_at"`
+		}
+		if json.NewDecoder(r).Decode(&output) == nil && output.GeneratedAt != nil {
+			return *output.GeneratedAt, nil
+		}
+	}
+
+	match := runTimestampRegexp.FindString(filepath.Base(path))
+	if match == "" {
+		return time.Time{}, fmt.Errorf("%s: no run timestamp (generated_at or in name)", path)
+	}
+	return time.ParseInLocation("2006-01-02-1504", match, time.Local)
+}
+
+// Splits hosts between those left to query, and the data of those that were
+// successfully queried according to previous results, in input order. Hosts
+// that failed, even partially, are queried again.
+func splitResumedHosts(
+	hosts []HostSpec,
+	previous map[string]*DeviceData,
+) (pending []HostSpec, resumed []*DeviceData) {
+	for _, host := range hosts {
+		if data := previous[host.Target]; data != nil && data.Error == "" {
+			resumed = append(resumed, data)
+		} else {
+			pending = append(pending, host)
+		}
+	}
+	return pending, resumed
+}
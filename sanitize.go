@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Plausible range of a kind of sensor reading, bounds included.
+type sensorRange struct {
+	Min float32
+	Max float32
+}
+
+func (self sensorRange) contains(value float32) bool {
+	return value >= self.Min && value <= self.Max
+}
+
+// Ranges of sensor readings considered plausible with -sanitize. Readings out
+// of them come from buggy agents, and are discarded.
+type SanityRanges struct {
+	Power       sensorRange // dBm
+	Temperature sensorRange // Celsius
+	Voltage     sensorRange // Volts
+	BiasCurrent sensorRange // Amperes
+}
+
+var defaultSanityRanges = SanityRanges{
+	Power:       sensorRange{-40, 10},
+	Temperature: sensorRange{-40, 125},
+	Voltage:     sensorRange{0, 6},
+	BiasCurrent: sensorRange{0, 0.2},
+}
+
+// Overrides ranges from a comma-separated list of kind=min:max items, e.g.
+// "power=-30:5,temperature=-10:90".
+func (self *SanityRanges) Parse(spec string) error {
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid range '%s' (expected kind=min:max)", item)
+		}
+
+		var target *sensorRange
+		switch parts[0] {
+		case "power":
+			target = &self.Power
+		case "temperature":
+			target = &self.Temperature
+		case "voltage":
+			target = &self.Voltage
+		case "bias":
+			target = &self.BiasCurrent
+		default:
+			return fmt.Errorf(
+				"unknown sensor kind '%s' (expected power, temperature, voltage or bias)",
+				parts[0],
+			)
+		}
+
+		bounds := strings.SplitN(parts[1], ":", 2)
+		if len(bounds) != 2 {
+			return fmt.Errorf("invalid range '%s' (expected kind=min:max)", item)
+		}
+		min, err := strconv.ParseFloat(bounds[0], 32)
+		if err != nil {
+			return fmt.Errorf("invalid minimum in '%s': %v", item, err)
+		}
+		max, err := strconv.ParseFloat(bounds[1], 32)
+		if err != nil {
+			return fmt.Errorf("invalid maximum in '%s': %v", item, err)
+		}
+		if min > max {
+			return fmt.Errorf("invalid range '%s' (minimum above maximum)", item)
+		}
+		*target = sensorRange{float32(min), float32(max)}
+	}
+
+	return nil
+}
+
+// Unsets sensor readings out of their plausible range, and returns how many
+// there were. Unset (zero) readings are not checked.
+func sanitizeOpticsData(opticsByPort map[PortID]*OpticsData, ranges *SanityRanges) int {
+	suspect := 0
+	// Returns false if the value was discarded.
+	check := func(value *float32, valid sensorRange) bool {
+		if *value != 0 && !valid.contains(*value) {
+			*value = 0
+			suspect += 1
+			return false
+		}
+		return true
+	}
+
+	for _, optics := range opticsByPort {
+		check(&optics.ModuleTemperature, ranges.Temperature)
+		check(&optics.ModuleVoltage, ranges.Voltage)
+
+		for _, sensor := range optics.SensorsByLane {
+			check(&sensor.LaserTemperature, ranges.Temperature)
+			if !check(&sensor.RxLaserPower, ranges.Power) {
+				sensor.HasRxLaserPower = false
+			}
+			if !check(&sensor.TxLaserPower, ranges.Power) {
+				sensor.HasTxLaserPower = false
+			}
+			check(&sensor.TxLaserBiasCurrent, ranges.BiasCurrent)
+		}
+	}
+
+	return suspect
+}
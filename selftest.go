@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+import (
+	"github.com/criteo/netopticon/snmpmagic"
+)
+
+import (
+	"github.com/soniah/gosnmp"
+)
+
+// Canned data of an Arista device with a single 100G port, as served by an
+// agent. Sensor indexes follow the Arista layout (see extractAristaData).
+var selfTestPDUs = snmpmagic.PDUSlice{
+	// SNMPv2-MIB system group
+	{Name: ".1.3.6.1.2.1.1.1.0", Type: gosnmp.OctetString, Value: []byte("Arista Networks EOS (self-test)")},
+	{Name: ".1.3.6.1.2.1.1.2.0", Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.30065.1.3011.7050.3741.32"},
+	{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: []byte("selftest")},
+
+	// IF-MIB ifTable
+	{Name: ".1.3.6.1.2.1.2.2.1.2.1", Type: gosnmp.OctetString, Value: []byte("Ethernet1")},
+	{Name: ".1.3.6.1.2.1.2.2.1.7.1", Type: gosnmp.Integer, Value: 1},
+	{Name: ".1.3.6.1.2.1.2.2.1.8.1", Type: gosnmp.Integer, Value: 1},
+	{Name: ".1.3.6.1.2.1.2.2.1.14.1", Type: gosnmp.Counter32, Value: uint(3)},
+
+	// IF-MIB ifXTable
+	{Name: ".1.3.6.1.2.1.31.1.1.1.1.1", Type: gosnmp.OctetString, Value: []byte("Ethernet1")},
+	{Name: ".1.3.6.1.2.1.31.1.1.1.6.1", Type: gosnmp.Counter64, Value: uint64(123456789012)},
+	{Name: ".1.3.6.1.2.1.31.1.1.1.10.1", Type: gosnmp.Counter64, Value: uint64(987654321)},
+	{Name: ".1.3.6.1.2.1.31.1.1.1.15.1", Type: gosnmp.Gauge32, Value: uint(100000)},
+	{Name: ".1.3.6.1.2.1.31.1.1.1.18.1", Type: gosnmp.OctetString, Value: []byte("to-spine-01")},
+
+	// ENTITY-SENSOR-MIB: module temperature (35.2 °C), then TX bias (6.5 mA),
+	// TX power (0.794 mW) and RX power (0.501 mW) of lane 1.
+	{Name: ".1.3.6.1.2.1.99.1.1.1.1.100301201", Type: gosnmp.Integer, Value: int(TypeCelsius)},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.1.100301211", Type: gosnmp.Integer, Value: int(TypeAmperes)},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.1.100301212", Type: gosnmp.Integer, Value: int(TypeWatts)},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.1.100301213", Type: gosnmp.Integer, Value: int(TypeWatts)},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.2.100301201", Type: gosnmp.Integer, Value: int(Units)},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.2.100301211", Type: gosnmp.Integer, Value: int(Milli)},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.2.100301212", Type: gosnmp.Integer, Value: int(Milli)},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.2.100301213", Type: gosnmp.Integer, Value: int(Milli)},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.3.100301201", Type: gosnmp.Integer, Value: 1},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.3.100301211", Type: gosnmp.Integer, Value: 1},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.3.100301212", Type: gosnmp.Integer, Value: 3},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.3.100301213", Type: gosnmp.Integer, Value: 3},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.4.100301201", Type: gosnmp.Integer, Value: 352},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.4.100301211", Type: gosnmp.Integer, Value: 65},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.4.100301212", Type: gosnmp.Integer, Value: 794},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.4.100301213", Type: gosnmp.Integer, Value: 501},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.5.100301201", Type: gosnmp.Integer, Value: int(SensorOk)},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.5.100301211", Type: gosnmp.Integer, Value: int(SensorOk)},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.5.100301212", Type: gosnmp.Integer, Value: int(SensorOk)},
+	{Name: ".1.3.6.1.2.1.99.1.1.1.5.100301213", Type: gosnmp.Integer, Value: int(SensorOk)},
+}
+
+// Runs the query and compilation pipeline on canned device data, and prints
+// the result along with PASS or FAIL. Returns the exit status.
+func runSelfTest() int {
+	query := opticsQueryPool.Get().(*opticsQuery)
+	defer opticsQueryPool.Put(query)
+	defer query.magic.Reset()
+
+	if err := query.magic.QueryWalker(context.Background(), selfTestPDUs); err != nil {
+		fmt.Println("FAIL: query:", err)
+		return 1
+	}
+	data := NewDeviceData("selftest", &query.mib, DeviceDataOptions{})
+
+	result, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		fmt.Println("FAIL: could not serialize result:", err)
+		return 1
+	}
+	fmt.Println(string(result))
+
+	problems := checkSelfTestData(data)
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Println("FAIL:", problem)
+		}
+		return 1
+	}
+
+	fmt.Println("PASS")
+	return 0
+}
+
+// Compares the result of the self-test with the expected one, and returns the
+// differences.
+func checkSelfTestData(data *DeviceData) []string {
+	var problems []string
+	expect := func(name string, got, want interface{}) {
+		if got != want {
+			problems = append(problems, fmt.Sprintf("%s is %v, expected %v", name, got, want))
+		}
+	}
+	expectFloat := func(name string, got, want float32) {
+		if math.Abs(float64(got-want)) > 0.01 {
+			problems = append(problems, fmt.Sprintf("%s is %v, expected %v", name, got, want))
+		}
+	}
+
+	expect("SysName", data.SysName, "selftest")
+	optics, ok := data.OpticsByPort[PortID{Port: 1}]
+	if !ok {
+		return append(problems, "port 1 is missing")
+	}
+	expect("Speed", optics.Speed, uint64(100000))
+	expect("Description", optics.Description, "to-spine-01")
+	expect("OperStatus", optics.OperStatus, OperUp)
+	expect("InOctets", optics.InOctets, uint64(123456789012))
+	expect("InErrors", optics.InErrors, uint64(3))
+	expectFloat("ModuleTemperature", optics.ModuleTemperature, 35.2)
+
+	sensor, ok := optics.SensorsByLane[1]
+	if !ok {
+		return append(problems, "lane 1 of port 1 is missing")
+	}
+	expectFloat("TxLaserBiasCurrent", sensor.TxLaserBiasCurrent, 0.0065)
+	expectFloat("TxLaserPower", sensor.TxLaserPower, -1.0)
+	expectFloat("RxLaserPower", sensor.RxLaserPower, -3.0)
+
+	return problems
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Content type of the response of /query, for each output format.
+var queryContentTypes = map[string]string{
+	"json":       "application/json",
+	"json-flat":  "application/json",
+	"ndjson":     "application/x-ndjson",
+	"prometheus": "text/plain; version=0.0.4",
+	"influx":     "text/plain",
+	"csv":        "text/csv",
+}
+
+// HTTP server querying hosts on demand (-serve), in the manner of Prometheus
+// exporters, and exposing metrics about itself.
+type queryServer struct {
+	credentials *Credentials
+	startTime   time.Time
+
+	// Bounds the number of hosts queried at once to -concurrency.
+	slots chan struct{}
+
+	// Recent results (with -cache-ttl), or nil.
+	cache *resultCache
+
+	// Instrumentation of on-demand queries, guarded by the mutex.
+	mutex         sync.Mutex
+	queryCount    uint64
+	failureCount  uint64
+	inFlight      int
+	queryDuration time.Duration
+}
+
+func newQueryServer(credentials *Credentials) *queryServer {
+	server := &queryServer{
+		credentials: credentials,
+		startTime:   time.Now(),
+		slots:       make(chan struct{}, concurrency),
+	}
+	if cacheTTL > 0 {
+		server.cache = newResultCache(cacheTTL)
+	}
+	return server
+}
+
+// Serves /query and /metrics on a given address until SIGINT/SIGTERM, which
+// lets queries in flight complete.
+func serve(addr string, credentials *Credentials) error {
+	server := newQueryServer(credentials)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/query", server.handleQuery)
+	mux.HandleFunc("/metrics", server.handleMetrics)
+	httpServer := &http.Server{Addr: addr, Handler: mux}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Println("received", sig, "- shutting down")
+		signal.Stop(signals)
+		httpServer.Shutdown(context.Background())
+	}()
+
+	log.Println("serving on", addr)
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Queries the host given as "target", and writes its data in the output format
+// given as "format" (default json).
+func (self *queryServer) handleQuery(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "missing target", http.StatusBadRequest)
+		return
+	}
+	if _, _, err := splitHostPort(target); err != nil {
+		http.Error(w, "invalid target: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	var buf bytes.Buffer
+	writer, err := NewOutputWriter(format, &buf, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := self.query(r.Context(), target)
+	if err := writer.Write(data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := writer.Close(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", queryContentTypes[format])
+	w.Write(buf.Bytes())
+}
+
+// Returns device data of a host, from the cache if enabled.
+func (self *queryServer) query(ctx context.Context, host string) *DeviceData {
+	if self.cache == nil {
+		return self.fetch(ctx, host)
+	}
+
+	// The fetch is shared by concurrent queries, so it must not be canceled
+	// along with the query that started it.
+	key := host + "|" + self.credentials.Community + "|" + snmpVersion
+	return self.cache.get(key, func() *DeviceData {
+		return self.fetch(context.Background(), host)
+	})
+}
+
+// Fetches device data from a host once a query slot is free, keeping track of
+// query metrics.
+func (self *queryServer) fetch(ctx context.Context, host string) *DeviceData {
+	select {
+	case self.slots <- struct{}{}:
+		defer func() { <-self.slots }()
+	case <-ctx.Done():
+		return NewDeviceDataError(host, "not queried: "+ctx.Err().Error())
+	}
+
+	self.mutex.Lock()
+	self.inFlight += 1
+	self.mutex.Unlock()
+
+	start := time.Now()
+	query := opticsQueryPool.Get().(*opticsQuery)
+	data := fetch(ctx, host, self.credentials, query)
+	query.magic.Reset()
+	opticsQueryPool.Put(query)
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.inFlight -= 1
+	self.queryCount += 1
+	if data.Error != "" {
+		self.failureCount += 1
+	}
+	self.queryDuration += time.Since(start)
+
+	return data
+}
+
+// Metric about the server process.
+type serverMetric struct {
+	name  string
+	help  string
+	kind  string
+	value float64
+}
+
+// Writes metrics about the server process in the Prometheus text format.
+func (self *queryServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	self.mutex.Lock()
+	metrics := []serverMetric{
+		{"netopticon_queries_total", "On-demand host queries.", "counter",
+			float64(self.queryCount)},
+		{"netopticon_query_failures_total", "On-demand host queries that failed.", "counter",
+			float64(self.failureCount)},
+		{"netopticon_queries_in_flight", "On-demand host queries in progress.", "gauge",
+			float64(self.inFlight)},
+		{"netopticon_query_duration_seconds_total", "Time spent in on-demand host queries.", "counter",
+			self.queryDuration.Seconds()},
+		{"netopticon_start_time_seconds", "Start time of the server since the Unix epoch.", "gauge",
+			float64(self.startTime.UnixNano()) / 1e9},
+		{"netopticon_goroutines", "Number of goroutines.", "gauge",
+			float64(runtime.NumGoroutine())},
+		{"netopticon_memory_alloc_bytes", "Bytes of allocated heap objects.", "gauge",
+			float64(memStats.HeapAlloc)},
+		{"netopticon_memory_sys_bytes", "Bytes of memory obtained from the OS.", "gauge",
+			float64(memStats.Sys)},
+	}
+	self.mutex.Unlock()
+
+	if self.cache != nil {
+		metrics = append(metrics, serverMetric{
+			"netopticon_cache_hits_total", "On-demand host queries answered from the cache.", "counter",
+			float64(self.cache.hitCount()),
+		})
+	}
+
+	w.Header().Set("Content-Type", queryContentTypes["prometheus"])
+	for _, metric := range metrics {
+		writePrometheusHeader(w, metric.name, metric.help, metric.kind)
+		writePrometheusSample(w, metric.name, metric.value)
+	}
+}
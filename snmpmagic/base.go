@@ -1,26 +1,122 @@
 package snmpmagic
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 import (
 	"github.com/soniah/gosnmp"
 )
 
+// Kind of requests used to walk root OIDs.
+type WalkMode int
+
+const (
+	// GETBULK requests.
+	WalkBulk WalkMode = iota
+	// GETNEXT requests, for devices that do not support GETBULK.
+	WalkNext
+	// GETBULK requests, falling back to GETNEXT when a bulk walk fails.
+	WalkAuto
+)
+
+func ParseWalkMode(name string) (WalkMode, error) {
+	switch name {
+	case "bulk":
+		return WalkBulk, nil
+	case "next":
+		return WalkNext, nil
+	case "auto":
+		return WalkAuto, nil
+	}
+
+	return WalkBulk, fmt.Errorf("snmpmagic: unknown walk mode '%s'", name)
+}
+
 type SNMPMagic struct {
-	// TODO: do we want concurrent run of bulkwalks when possible?
+	// Kind of requests used to walk root OIDs.
+	WalkMode WalkMode
+
+	// Custom decoders of PDU values, DefaultConverters unless replaced.
+	Converters *ConverterRegistry
+
+	// Time the agent booted, used to decode uptime values (e.g. TimeTicks) in
+	// time.Time fields. Fetched from sysUpTime by Query when zero.
+	BootTime time.Time
+
+	// Maximum number of root OIDs walked concurrently, each on its own
+	// connection. Values below 2 walk all roots on a single connection.
+	Parallelism int
+
+	// Receives every PDU handled (and the sysUpTime fetched for BootTime) as
+	// JSON lines, for later use with Replay. Must not be changed during Query.
+	Recorder io.Writer
+
+	// Keeps track of PDUs that could not be mapped to any field, see Unmapped.
+	TrackUnmapped bool
+
+	// Leaves the connection of the client given to Query open, for the caller
+	// to reuse it or close it, and only connects the client if it is not
+	// connected yet. The connection is still closed when the context is done.
+	// Extra connections (see Parallelism) are always closed.
+	KeepConnection bool
+
+	// Maximum number of PDUs handled per query (0 for no limit), beyond which
+	// walks are stopped and ErrTooManyPDUs returned, keeping the data filled
+	// so far. Protects against agents returning endless data.
+	MaxPDUs int
 
 	oidTree     *OIDTree
 	destination interface{}
 	isFilled    int32
+
+	// OIDs of the top-level fields queried, or nil for all of them.
+	fieldRoots []OID
+
+	// Instrumentation of the last query.
+	queryDuration time.Duration
+	pduCount      int
+
+	// PDUs not mapped to any field (with TrackUnmapped), and the first of them.
+	unmappedCount  int
+	unmappedSample []UnmappedPDU
+
+	// Whether uptime values left unset for lack of BootTime were reported.
+	bootTimeWarned bool
+
+	// Time the data filled by Replay was recorded at, if known.
+	recordedAt time.Time
+
+	// Guards the destination (and PDU count), which is filled by concurrent
+	// walks.
+	mutex sync.Mutex
+
+	// Storage of the path of the PDU being handled, and of map keys, reused
+	// across PDUs.
+	pathBuffer OID
+	mapKeys    mapKeyBuffers
 }
 
+// PDU received while walking a root that could not be mapped to any field:
+// either its OID matches no leaf, or its type cannot be decoded.
+type UnmappedPDU struct {
+	Name string
+	Type gosnmp.Asn1BER
+}
+
+// Maximum number of unmapped PDUs kept as a sample.
+const unmappedSampleSize = 10
+
 func NewSNMPMagic(dst interface{}) (*SNMPMagic, error) {
 	oidTree, err := BuildOIDTree(dst)
 	if err != nil {
@@ -28,17 +124,91 @@ func NewSNMPMagic(dst interface{}) (*SNMPMagic, error) {
 	}
 
 	magic := &SNMPMagic{
+		Converters:  DefaultConverters,
 		oidTree:     oidTree,
 		destination: dst,
+		mapKeys:     make(mapKeyBuffers),
 	}
 	return magic, nil
 }
 
+// Returns the root OIDs walked by Query, de-duplicated and sorted.
+func (self *SNMPMagic) RootOIDs() []OID {
+	paths := self.oidTree.PrefixPaths()
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i].Compare(paths[j]) < 0
+	})
+
+	roots := paths[:0]
+	for i, path := range paths {
+		if i > 0 && oidEqual(path, paths[i-1]) {
+			continue
+		}
+		if self.fieldRoots != nil && !hasAnyPrefix(path, self.fieldRoots) {
+			continue
+		}
+		roots = append(roots, path)
+	}
+
+	return roots
+}
+
+// Restricts queries to the given top-level fields of the destination (names
+// are case-insensitive), e.g. to skip tables that are not needed. No names
+// selects all fields. Kept across Reset.
+func (self *SNMPMagic) SelectFields(names []string) error {
+	if len(names) == 0 {
+		self.fieldRoots = nil
+		return nil
+	}
+
+	t := reflect.TypeOf(self.destination)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	fieldRoots := make([]OID, 0, len(names))
+	for _, name := range names {
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("snmp")
+			if tag == "" || !strings.EqualFold(field.Name, name) {
+				continue
+			}
+
+			oid, _, err := ParseTag(tag)
+			if err != nil {
+				return err
+			}
+			fieldRoots = append(fieldRoots, oid)
+			found = true
+			break
+		}
+
+		if !found {
+			return fmt.Errorf("snmpmagic: unknown field '%s' in %v", name, t)
+		}
+	}
+
+	self.fieldRoots = fieldRoots
+	return nil
+}
+
+func hasAnyPrefix(oid OID, prefixes []OID) bool {
+	for _, prefix := range prefixes {
+		if oid.HasPrefix(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func (self *SNMPMagic) String() string {
 	var sb strings.Builder
 
 	fmt.Fprintln(&sb, "BulkWalk queries:")
-	for _, path := range self.oidTree.PrefixPaths() {
+	for _, path := range self.RootOIDs() {
 		fmt.Fprintln(&sb, "-", path)
 	}
 	fmt.Fprintln(&sb)
@@ -48,39 +218,360 @@ func (self *SNMPMagic) String() string {
 	return sb.String()
 }
 
+// Clears the destination and the state of the last query (including BootTime
+// and Recorder, which are specific to an agent), so that the SNMPMagic can
+// query another agent. Other settings are kept. An SNMPMagic can be reused
+// sequentially, but must not be reset or queried concurrently.
+func (self *SNMPMagic) Reset() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if dst := reflect.ValueOf(self.destination); dst.Kind() == reflect.Ptr {
+		dst.Elem().Set(reflect.Zero(dst.Elem().Type()))
+	}
+
+	self.BootTime = time.Time{}
+	self.Recorder = nil
+	self.queryDuration = 0
+	self.pduCount = 0
+	self.unmappedCount = 0
+	self.unmappedSample = nil
+	self.bootTimeWarned = false
+	self.recordedAt = time.Time{}
+	atomic.StoreInt32(&self.isFilled, 0)
+}
+
+// Returns the wall-clock duration of Query.
+func (self *SNMPMagic) QueryDuration() time.Duration {
+	return self.queryDuration
+}
+
+// Returns the number of PDUs handled so far.
+func (self *SNMPMagic) PDUCount() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return self.pduCount
+}
+
+// Returns the number of PDUs handled so far that could not be mapped to any
+// field, along with the first of them, if TrackUnmapped is set.
+func (self *SNMPMagic) Unmapped() (count int, sample []UnmappedPDU) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return self.unmappedCount, append([]UnmappedPDU(nil), self.unmappedSample...)
+}
+
+// Keeps track of an unmapped PDU. The mutex must be held.
+func (self *SNMPMagic) addUnmapped(pdu *gosnmp.SnmpPDU) {
+	if !self.TrackUnmapped {
+		return
+	}
+
+	self.unmappedCount += 1
+	if len(self.unmappedSample) < unmappedSampleSize {
+		self.unmappedSample = append(self.unmappedSample, UnmappedPDU{pdu.Name, pdu.Type})
+	}
+}
+
+// Walks all root OIDs of the destination and fills it. Failing roots do not
+// prevent walking the other ones: errors are aggregated in a *QueryError.
 func (self *SNMPMagic) Query(client *gosnmp.GoSNMP) error {
+	return self.QueryContext(context.Background(), client)
+}
+
+// Same as Query, but aborts walks as soon as the context is done. In that case
+// the context error is returned and the destination is left partially filled.
+func (self *SNMPMagic) QueryContext(ctx context.Context, client *gosnmp.GoSNMP) error {
 	if !atomic.CompareAndSwapInt32(&self.isFilled, 0, 1) {
 		return errors.New("snmpmagic: structure has already been filled")
 	}
 
-	if err := client.Connect(); err != nil {
-		return err
+	start := time.Now()
+	defer func() {
+		self.queryDuration = time.Since(start)
+	}()
+
+	if !self.KeepConnection || client.Conn == nil {
+		if err := client.Connect(); err != nil {
+			return err
+		}
+	}
+
+	if self.BootTime.IsZero() && self.oidTree.hasTimeFields {
+		if err := self.fetchBootTime(client); err != nil {
+			log.Println(
+				"WARNING: could not get boot time of", client.Target, ":", err,
+				"- uptime fields are left unset",
+			)
+			self.bootTimeWarned = true
+		}
 	}
-	defer client.Conn.Close()
 
-	rootOids := self.oidTree.PrefixPaths()
+	rootOids := self.RootOIDs()
+	roots := make(chan OID, len(rootOids))
 	for _, rootOid := range rootOids {
-		err := client.BulkWalk(rootOid.String(), self.HandlePDU)
-		if err != nil {
-			return err
+		roots <- rootOid
+	}
+	close(roots)
+
+	parallelism := self.Parallelism
+	if parallelism > len(rootOids) {
+		parallelism = len(rootOids)
+	}
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	// The first worker uses the given client, others use a copy with their own
+	// connection.
+	state := &queryState{}
+	var workers sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		workerClient := client
+		keepOpen := i == 0 && self.KeepConnection
+		if i > 0 {
+			workerClient = copyClient(client)
+			if err := workerClient.Connect(); err != nil {
+				log.Println("WARNING: could not open extra connection to", client.Target, ":", err)
+				break
+			}
+		}
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			if !keepOpen {
+				defer workerClient.Conn.Close()
+			}
+
+			// Closing the connection unblocks a walk waiting for a response.
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				select {
+				case <-ctx.Done():
+					workerClient.Conn.Close()
+				case <-done:
+				}
+			}()
+
+			walker := &ClientWalker{Client: workerClient, Mode: self.WalkMode}
+			self.walkRoots(ctx, walker, roots, state)
+		}()
+	}
+	workers.Wait()
+
+	return state.err(ctx, len(rootOids))
+}
+
+// Same as QueryContext, but walks all root OIDs sequentially from a given
+// walker instead of an agent. BootTime is not fetched.
+func (self *SNMPMagic) QueryWalker(ctx context.Context, walker Walker) error {
+	if !atomic.CompareAndSwapInt32(&self.isFilled, 0, 1) {
+		return errors.New("snmpmagic: structure has already been filled")
+	}
+
+	start := time.Now()
+	defer func() {
+		self.queryDuration = time.Since(start)
+	}()
+
+	rootOids := self.RootOIDs()
+	roots := make(chan OID, len(rootOids))
+	for _, rootOid := range rootOids {
+		roots <- rootOid
+	}
+	close(roots)
+
+	state := &queryState{}
+	self.walkRoots(ctx, walker, roots, state)
+
+	return state.err(ctx, len(rootOids))
+}
+
+// Returns an unconnected copy of a client, for parallel walks. SNMPv3
+// security parameters hold per-connection state (e.g. engine boots and time,
+// salts): each copy gets its own.
+func copyClient(client *gosnmp.GoSNMP) *gosnmp.GoSNMP {
+	clientCopy := *client
+	clientCopy.Conn = nil
+	if client.SecurityParameters != nil {
+		clientCopy.SecurityParameters = client.SecurityParameters.Copy()
+	}
+	return &clientCopy
+}
+
+// Progress of a query, shared between workers walking roots concurrently.
+type queryState struct {
+	mutex          sync.Mutex
+	pduCount       int
+	failures       []*RootError
+	unreachableErr error
+	truncated      bool
+}
+
+func (self *queryState) setTruncated() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.truncated = true
+}
+
+// Whether MaxPDUs was reached, in which case remaining roots are not walked.
+func (self *queryState) isTruncated() bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return self.truncated
+}
+
+func (self *queryState) addFailure(root OID, err error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.pduCount == 0 && self.unreachableErr == nil {
+		self.unreachableErr = err
+	}
+	self.failures = append(self.failures, &RootError{root, err})
+}
+
+// Whether a walk failed before the host ever answered, in which case we do
+// not wait for the other roots to time out as well.
+func (self *queryState) isUnreachable() bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return self.pduCount == 0 && self.unreachableErr != nil
+}
+
+// Returns the outcome of a query once all workers are done.
+func (self *queryState) err(ctx context.Context, rootCount int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Failures of other roots are irrelevant, as data is incomplete anyway.
+	if self.truncated {
+		return ErrTooManyPDUs
+	}
+
+	// A host that never answered is most likely unreachable.
+	if self.pduCount == 0 && self.unreachableErr != nil {
+		return self.unreachableErr
+	}
+
+	if len(self.failures) > 0 {
+		return &QueryError{
+			RootCount: rootCount,
+			Failures:  self.failures,
 		}
 	}
 
 	return nil
 }
 
-func (self *SNMPMagic) HandlePDU(pdu gosnmp.SnmpPDU) error {
-	path, err := ParseOID(pdu.Name)
+// Returned by walk functions to stop the walk of a root without error.
+var errEndOfWalk = errors.New("snmpmagic: end of walk")
+
+// Whether a PDU marks the end of a walk rather than carrying data: agents
+// return them for subtrees they do not support, or past their last OID.
+func isEndOfWalk(pduType gosnmp.Asn1BER) bool {
+	return pduType == gosnmp.EndOfMibView ||
+		pduType == gosnmp.NoSuchObject ||
+		pduType == gosnmp.NoSuchInstance
+}
+
+// Walks roots from the channel until it is empty, with a single walker. A walk
+// stopped by an end-of-walk PDU is not a failure, and keeps the PDUs before.
+func (self *SNMPMagic) walkRoots(
+	ctx context.Context,
+	walker Walker,
+	roots <-chan OID,
+	state *queryState,
+) {
+	walkFn := func(pdu gosnmp.SnmpPDU) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		state.mutex.Lock()
+		state.pduCount += 1
+		state.mutex.Unlock()
+
+		if isEndOfWalk(pdu.Type) {
+			return errEndOfWalk
+		}
+		return self.HandlePDU(pdu)
+	}
+
+	for rootOid := range roots {
+		if ctx.Err() != nil || state.isTruncated() {
+			return
+		}
+		if state.isUnreachable() {
+			state.addFailure(rootOid, errors.New("not walked: host did not answer"))
+			continue
+		}
+
+		err := walker.Walk(rootOid.String(), walkFn)
+		if err == ErrTooManyPDUs {
+			state.setTruncated()
+		} else if err != nil && err != errEndOfWalk && ctx.Err() == nil {
+			state.addFailure(rootOid, err)
+		}
+	}
+}
+
+// Deserializes a PDU into the destination. Safe for concurrent use. Panics
+// caused by unexpected data are returned as errors, as walks run in their own
+// goroutines where they cannot be recovered by the caller. Returns
+// ErrTooManyPDUs without handling the PDU once MaxPDUs have been handled.
+// End-of-walk PDUs are ignored, and not counted.
+func (self *SNMPMagic) HandlePDU(pdu gosnmp.SnmpPDU) (err error) {
+	// End-of-walk markers carry no data, and do not count as PDUs handled.
+	if isEndOfWalk(pdu.Type) {
+		return nil
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.MaxPDUs > 0 && self.pduCount >= self.MaxPDUs {
+		return ErrTooManyPDUs
+	}
+	self.pduCount += 1
+	self.record(&pdu, nil)
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("snmpmagic: panic while handling %s: %v", pdu.Name, r)
+		}
+	}()
+
+	// The path is only valid until the next PDU, and must not be retained.
+	path, err := ParseOIDInto(self.pathBuffer, pdu.Name)
 	if err != nil {
 		return err
 	}
+	self.pathBuffer = path
 
 	remainder := path
 	value := reflect.ValueOf(self.destination)
 	node := self.oidTree
 	for node != nil {
-		// Dereference pointers.
+		// Dereference pointers, allocating nil ones (struct pointer fields).
 		for value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				if !value.CanSet() {
+					return fmt.Errorf(
+						"snmpmagic: cannot set value of field '%s'",
+						node.fieldQualifiedName,
+					)
+				}
+				value.Set(reflect.New(value.Type().Elem()))
+			}
 			value = value.Elem()
 		}
 
@@ -103,30 +594,107 @@ func (self *SNMPMagic) HandlePDU(pdu gosnmp.SnmpPDU) error {
 		// - ensure element at key is initialized
 		// - set value to element
 		if node.IsSuffixCatching() {
+			// Keys are taken from the end of the path, which may not even be
+			// under the table.
+			if !remainder.HasPrefix(node.prefix) {
+				break
+			}
+
 			var err error
-			value, remainder, err = getOrCreateMapElement(value, node.fieldQualifiedName, remainder)
+			value, remainder, err = getOrCreateMapElement(value, node, remainder, self.mapKeys)
 			if err != nil {
 				// We log an error and stop processing of the PDU instead of stopping
 				// the whole walk.
 				log.Println(
-					"ERROR:", err, "at", node.fieldQualifiedName, "with OID", path,
+					"ERROR:", err, "at", node.fieldQualifiedName, "with OID", pdu.Name,
 				)
 				return nil
 			}
 		}
 
-		// Node is a leaf: check types and deserialize PDU.
+		// Node is a leaf: check types and deserialize PDU. The remainder must be
+		// the leaf prefix (for multi-element tags, e.g. "column.index"), followed
+		// by the ".0" instance for scalars.
 		if node.IsLeaf() {
-			if len(remainder) == 0 {
-				deserializePDUToValue(&pdu, value, node.fieldQualifiedName)
-				return nil
-			} else {
-				// TODO: log erroneous data (or schema)?
+			if node.isScalar && len(remainder) == len(node.prefix)+1 &&
+				remainder[len(remainder)-1] == 0 {
+				remainder = remainder[:len(remainder)-1]
+			}
+
+			if !oidEqual(remainder, node.prefix) || !self.deserialize(&pdu, value, node) {
+				self.addUnmapped(&pdu)
 			}
+			return nil
 		}
 
 		node, remainder = node.FindNext(remainder)
 	}
 
+	self.addUnmapped(&pdu)
+	return nil
+}
+
+// Decodes a PDU into a leaf value, with a custom converter if one matches.
+// Returns false if the PDU type is not handled.
+func (self *SNMPMagic) deserialize(pdu *gosnmp.SnmpPDU, value reflect.Value, node *OIDTree) bool {
+	if self.Converters != nil {
+		converter, err := self.Converters.lookup(node.options.Converter, value.Type())
+		if err != nil {
+			log.Println("ERROR:", err, "at", node.fieldQualifiedName)
+			return true
+		}
+		if converter != nil {
+			// Converters get a copy, so that PDUs only escape to the heap when
+			// one is used.
+			pduCopy := *pdu
+			if err := converter(&pduCopy, value); err != nil {
+				log.Println("ERROR:", err, "at", node.fieldQualifiedName, "with OID", pdu.Name)
+			}
+			return true
+		}
+	}
+
+	if value.Type() == timeType {
+		t, err := decodeTime(pdu, node.options.Time, self.BootTime)
+		if err == errUnknownBootTime {
+			// Reported once per query rather than for every PDU.
+			if !self.bootTimeWarned {
+				log.Println("WARNING: agent boot time is unknown, uptime fields are left unset")
+				self.bootTimeWarned = true
+			}
+			return true
+		}
+		if err != nil {
+			log.Println("ERROR:", err, "at", node.fieldQualifiedName, "with OID", pdu.Name)
+			return true
+		}
+		value.Set(reflect.ValueOf(t))
+		return true
+	}
+
+	return deserializePDUToValue(pdu, value, node)
+}
+
+// Computes the boot time of the agent from its sysUpTime.
+func (self *SNMPMagic) fetchBootTime(client *gosnmp.GoSNMP) error {
+	packet, err := client.Get([]string{sysUpTimeOID})
+	if err != nil {
+		return err
+	}
+	if len(packet.Variables) != 1 {
+		return fmt.Errorf("expected 1 variable, got %d", len(packet.Variables))
+	}
+
+	receivedAt := time.Now()
+	self.mutex.Lock()
+	self.record(&packet.Variables[0], &receivedAt)
+	self.mutex.Unlock()
+
+	ticks, ok := toUint64(packet.Variables[0].Value)
+	if !ok {
+		return fmt.Errorf("unexpected sysUpTime value %v", packet.Variables[0].Value)
+	}
+
+	self.BootTime = receivedAt.Add(-time.Duration(ticks) * 10 * time.Millisecond)
 	return nil
 }
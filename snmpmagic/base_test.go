@@ -0,0 +1,447 @@
+package snmpmagic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soniah/gosnmp"
+)
+
+// Interface table of a large chassis, with and without pre-sized maps.
+type benchInterfaceEntry struct {
+	Descr     string `snmp:"2"`
+	Speed     uint   `snmp:"5"`
+	InOctets  uint   `snmp:"10"`
+	OutOctets uint   `snmp:"16"`
+}
+
+type benchMIB struct {
+	Interface map[uint]*benchInterfaceEntry `snmp:".1.3.6.1.2.1.2.2.1"`
+}
+
+type benchCappedMIB struct {
+	Interface map[uint]*benchInterfaceEntry `snmp:".1.3.6.1.2.1.2.2.1,cap=512"`
+}
+
+// Returns the PDUs of a walk of the interface table of a device with a given
+// number of ports, column by column as agents return them.
+func benchInterfacePDUs(portCount int) []gosnmp.SnmpPDU {
+	var pdus []gosnmp.SnmpPDU
+	for _, column := range []int{2, 5, 10, 16} {
+		for port := 1; port <= portCount; port++ {
+			name := fmt.Sprintf(".1.3.6.1.2.1.2.2.1.%d.%d", column, port)
+			if column == 2 {
+				pdus = append(pdus, gosnmp.SnmpPDU{
+					Name: name, Type: gosnmp.OctetString, Value: []byte(fmt.Sprintf("Ethernet%d", port)),
+				})
+			} else {
+				pdus = append(pdus, gosnmp.SnmpPDU{
+					Name: name, Type: gosnmp.Counter32, Value: uint(port * column),
+				})
+			}
+		}
+	}
+	return pdus
+}
+
+func benchmarkHandlePDU(b *testing.B, dst interface{}, pdus []gosnmp.SnmpPDU) {
+	magic, err := NewSNMPMagic(dst)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		magic.Reset()
+		for _, pdu := range pdus {
+			if err := magic.HandlePDU(pdu); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkHandlePDU(b *testing.B) {
+	benchmarkHandlePDU(b, &benchMIB{}, benchInterfacePDUs(400))
+}
+
+func BenchmarkHandlePDUWithCap(b *testing.B) {
+	benchmarkHandlePDU(b, &benchCappedMIB{}, benchInterfacePDUs(400))
+}
+
+func TestHandlePDUWithCap(t *testing.T) {
+	var mib benchCappedMIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pdu := range benchInterfacePDUs(400) {
+		if err := magic.HandlePDU(pdu); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(mib.Interface) != 400 {
+		t.Fatalf("expected 400 interfaces, got %d", len(mib.Interface))
+	}
+	entry := mib.Interface[400]
+	if entry == nil || entry.Descr != "Ethernet400" || entry.Speed != 2000 || entry.OutOctets != 6400 {
+		t.Errorf("unexpected entry of port 400: %+v", entry)
+	}
+}
+
+// SNMPv2-MIB system group, whose objects are scalars.
+type systemMIB struct {
+	System struct {
+		Descr    string `snmp:"1"`
+		ObjectID OID    `snmp:"2"`
+		UpTime   uint   `snmp:"3"`
+		Name     string `snmp:"5"`
+	} `snmp:".1.3.6.1.2.1.1"`
+}
+
+func TestScalarFields(t *testing.T) {
+	var mib systemMIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	magic.TrackUnmapped = true
+
+	pdus := PDUSlice{
+		{Name: ".1.3.6.1.2.1.1.1.0", Type: gosnmp.OctetString, Value: []byte("Arista Networks EOS")},
+		{Name: ".1.3.6.1.2.1.1.2.0", Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.30065.1.3011"},
+		{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(123456)},
+		{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: []byte("spine-01")},
+		// Scalars only have a ".0" instance.
+		{Name: ".1.3.6.1.2.1.1.5.1", Type: gosnmp.OctetString, Value: []byte("not-an-instance")},
+	}
+	if err := magic.QueryWalker(context.Background(), pdus); err != nil {
+		t.Fatal(err)
+	}
+
+	system := mib.System
+	if system.Descr != "Arista Networks EOS" || system.UpTime != 123456 || system.Name != "spine-01" {
+		t.Errorf("unexpected system group: %+v", system)
+	}
+	if system.ObjectID.String() != "1.3.6.1.4.1.30065.1.3011" {
+		t.Errorf("unexpected sysObjectID: %s", system.ObjectID)
+	}
+	if count, sample := magic.Unmapped(); count != 1 || sample[0].Name != ".1.3.6.1.2.1.1.5.1" {
+		t.Errorf("expected the non-.0 instance to be unmapped, got %v", sample)
+	}
+}
+
+func TestStructPointerFields(t *testing.T) {
+	type Thresholds struct {
+		High int `snmp:"1"`
+		Low  int `snmp:"2"`
+	}
+	type Entry struct {
+		Descr      string      `snmp:"2"`
+		Thresholds *Thresholds `snmp:"30"`
+	}
+	type MIB struct {
+		System *struct {
+			Name string `snmp:"5"`
+		} `snmp:".1.3.6.1.2.1.1"`
+		Entity *struct {
+			Name string `snmp:"7.1"`
+		} `snmp:".1.3.6.1.2.1.47.1.1.1.1"`
+		Table map[uint]*Entry `snmp:".1.3.6.1.4.1.99.1"`
+	}
+
+	var mib MIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	magic.TrackUnmapped = true
+
+	pdus := PDUSlice{
+		{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: []byte("spine-01")},
+		{Name: ".1.3.6.1.4.1.99.1.2.1", Type: gosnmp.OctetString, Value: []byte("Ethernet1")},
+		{Name: ".1.3.6.1.4.1.99.1.2.2", Type: gosnmp.OctetString, Value: []byte("Ethernet2")},
+		{Name: ".1.3.6.1.4.1.99.1.30.1.1", Type: gosnmp.Integer, Value: 70},
+		{Name: ".1.3.6.1.4.1.99.1.30.2.1", Type: gosnmp.Integer, Value: -5},
+	}
+	if err := magic.QueryWalker(context.Background(), pdus); err != nil {
+		t.Fatal(err)
+	}
+	if count, sample := magic.Unmapped(); count != 0 {
+		t.Errorf("expected all PDUs to be mapped, got %v", sample)
+	}
+
+	// Pointers are allocated once a PDU is received under them.
+	if mib.System == nil || mib.System.Name != "spine-01" {
+		t.Errorf("unexpected system group: %+v", mib.System)
+	}
+	if mib.Entity != nil {
+		t.Errorf("expected the entity group to be left nil, got %+v", mib.Entity)
+	}
+	entry := mib.Table[1]
+	if entry == nil || entry.Thresholds == nil || *entry.Thresholds != (Thresholds{High: 70, Low: -5}) {
+		t.Errorf("unexpected entry 1: %+v", entry)
+	}
+	if entry := mib.Table[2]; entry == nil || entry.Thresholds != nil {
+		t.Errorf("expected entry 2 without thresholds, got %+v", entry)
+	}
+}
+
+// Handles PDUs of entries that already exist, as for every column after the
+// first one of a table: no allocation is needed.
+func BenchmarkHandlePDUExistingEntries(b *testing.B) {
+	var mib benchMIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		b.Fatal(err)
+	}
+	pdus := benchInterfacePDUs(400)[400:]
+	for _, pdu := range pdus {
+		if err := magic.HandlePDU(pdu); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := magic.HandlePDU(pdus[i%len(pdus)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestHandlePDUDoesNotAliasBuffers(t *testing.T) {
+	type Key struct {
+		Slot uint
+		Port uint
+	}
+	type Entry struct {
+		Object   OID `snmp:"2"`
+		Relative OID `snmp:"3"`
+	}
+	type MIB struct {
+		ByKey   map[Key]*Entry     `snmp:".1.3.6.1.4.1.99.1"`
+		ByArray map[[2]uint]*Entry `snmp:".1.3.6.1.4.1.99.2"`
+	}
+
+	var mib MIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each PDU overwrites the path and key buffers used by the previous one.
+	for _, prefix := range []string{".1.3.6.1.4.1.99.1", ".1.3.6.1.4.1.99.2"} {
+		for slot := 1; slot <= 3; slot++ {
+			for port := 1; port <= 3; port++ {
+				index := fmt.Sprintf(".%d.%d", slot, port)
+				pdus := []gosnmp.SnmpPDU{
+					{Name: prefix + ".2" + index, Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.99.9" + index},
+					{Name: prefix + ".3" + index, Type: gosnmp.ObjectIdentifier, Value: "7" + index},
+				}
+				for _, pdu := range pdus {
+					if err := magic.HandlePDU(pdu); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+		}
+	}
+
+	if len(mib.ByKey) != 9 || len(mib.ByArray) != 9 {
+		t.Fatalf("expected 9 entries per table, got %d and %d", len(mib.ByKey), len(mib.ByArray))
+	}
+	for slot := uint(1); slot <= 3; slot++ {
+		for port := uint(1); port <= 3; port++ {
+			object := fmt.Sprintf("1.3.6.1.4.1.99.9.%d.%d", slot, port)
+			// Relative to the OID of the column
+			relative := fmt.Sprintf("%s.3.7.%d.%d", "1.3.6.1.4.1.99.%d", slot, port)
+
+			for table, entry := range []*Entry{mib.ByKey[Key{slot, port}], mib.ByArray[[2]uint{slot, port}]} {
+				expectedRelative := fmt.Sprintf(relative, table+1)
+				if entry == nil || entry.Object.String() != object || entry.Relative.String() != expectedRelative {
+					t.Errorf("table %d, %d.%d: got %+v, expected %s and %s", table+1, slot, port, entry, object, expectedRelative)
+				}
+			}
+		}
+	}
+}
+
+func TestQueryWalkerEndOfWalk(t *testing.T) {
+	type VendorEntry struct {
+		RxPower float32 `snmp:"6"`
+	}
+	type MIB struct {
+		Interface map[uint]*benchInterfaceEntry `snmp:".1.3.6.1.2.1.2.2.1"`
+		Vendor    map[uint]*VendorEntry         `snmp:".1.3.6.1.4.1.2636.3.60.1.2.1"`
+	}
+
+	pdus := PDUSlice{
+		{Name: ".1.3.6.1.2.1.2.2.1.2.1", Type: gosnmp.OctetString, Value: []byte("Ethernet1")},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.2", Type: gosnmp.OctetString, Value: []byte("Ethernet2")},
+		{Name: ".1.3.6.1.2.1.2.2.1.5.1", Type: gosnmp.Gauge32, Value: uint(1000)},
+		// The agent stops early: PDUs past the marker are not handled.
+		{Name: ".1.3.6.1.2.1.2.2.1.5.2", Type: gosnmp.EndOfMibView},
+		{Name: ".1.3.6.1.2.1.2.2.1.5.2", Type: gosnmp.Gauge32, Value: uint(2000)},
+		// Unsupported vendor tree
+		{Name: ".1.3.6.1.4.1.2636.3.60.1.2.1", Type: gosnmp.NoSuchObject},
+		{Name: ".1.3.6.1.4.1.2636.3.60.1.2.1.6.1", Type: gosnmp.Integer, Value: -2},
+	}
+
+	for _, maxPDUs := range []int{0, 3} {
+		var mib MIB
+		magic, err := NewSNMPMagic(&mib)
+		if err != nil {
+			t.Fatal(err)
+		}
+		magic.MaxPDUs = maxPDUs
+
+		if err := magic.QueryWalker(context.Background(), pdus); err != nil {
+			t.Fatalf("max %d PDUs: %v", maxPDUs, err)
+		}
+		if magic.PDUCount() != 3 {
+			t.Errorf("max %d PDUs: expected 3 PDUs handled, got %d", maxPDUs, magic.PDUCount())
+		}
+		if len(mib.Interface) != 2 || mib.Interface[1].Speed != 1000 || mib.Interface[2].Speed != 0 ||
+			mib.Interface[2].Descr != "Ethernet2" {
+			t.Errorf("max %d PDUs: unexpected interfaces %+v", maxPDUs, mib.Interface)
+		}
+		if len(mib.Vendor) != 0 {
+			t.Errorf("max %d PDUs: expected no vendor data, got %+v", maxPDUs, mib.Vendor)
+		}
+	}
+}
+
+func TestHandlePDUMaxPDUs(t *testing.T) {
+	var mib benchMIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	magic.MaxPDUs = 2
+
+	pdus := benchInterfacePDUs(3)
+	for i, pdu := range pdus[:2] {
+		if err := magic.HandlePDU(pdu); err != nil {
+			t.Fatalf("PDU %d: %v", i, err)
+		}
+		// End-of-walk markers do not count.
+		if err := magic.HandlePDU(gosnmp.SnmpPDU{Name: pdu.Name, Type: gosnmp.EndOfMibView}); err != nil {
+			t.Fatalf("PDU %d: %v", i, err)
+		}
+	}
+	if err := magic.HandlePDU(pdus[2]); err != ErrTooManyPDUs {
+		t.Errorf("expected ErrTooManyPDUs, got %v", err)
+	}
+	if len(mib.Interface) != 2 {
+		t.Errorf("expected 2 interfaces, got %d", len(mib.Interface))
+	}
+}
+
+func TestCopyClient(t *testing.T) {
+	security := &gosnmp.UsmSecurityParameters{
+		UserName:                 "monitoring",
+		AuthenticationProtocol:   gosnmp.SHA,
+		AuthenticationPassphrase: "authpass",
+		PrivacyProtocol:          gosnmp.AES,
+		PrivacyPassphrase:        "privpass",
+	}
+	client := &gosnmp.GoSNMP{
+		Target:             "10.0.0.1",
+		Port:               161,
+		Version:            gosnmp.Version3,
+		SecurityModel:      gosnmp.UserSecurityModel,
+		MsgFlags:           gosnmp.AuthPriv,
+		SecurityParameters: security,
+	}
+
+	clientCopy := copyClient(client)
+	if clientCopy == client || clientCopy.Target != "10.0.0.1" || clientCopy.Conn != nil {
+		t.Errorf("unexpected copy: %+v", clientCopy)
+	}
+
+	// Connections of copies update their own engine state.
+	copySecurity, ok := clientCopy.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+	if !ok || copySecurity == security {
+		t.Fatalf("expected the security parameters to be copied, got %#v", clientCopy.SecurityParameters)
+	}
+	if copySecurity.UserName != "monitoring" || copySecurity.PrivacyPassphrase != "privpass" {
+		t.Errorf("unexpected security parameters: %+v", copySecurity)
+	}
+	copySecurity.AuthoritativeEngineBoots = 42
+	if security.AuthoritativeEngineBoots != 0 {
+		t.Error("expected the original security parameters to be left as is")
+	}
+
+	// SNMPv2c clients have no security parameters.
+	client = &gosnmp.GoSNMP{Target: "10.0.0.1", Version: gosnmp.Version2c, Community: "public"}
+	if clientCopy := copyClient(client); clientCopy.SecurityParameters != nil || clientCopy.Community != "public" {
+		t.Errorf("unexpected copy: %+v", clientCopy)
+	}
+}
+
+func TestUnknownBootTime(t *testing.T) {
+	type Entry struct {
+		LastChange time.Time `snmp:"9"`
+	}
+	type MIB struct {
+		Interface map[uint]*Entry `snmp:".1.3.6.1.2.1.2.2.1"`
+	}
+
+	var mib MIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdus := PDUSlice{
+		{Name: ".1.3.6.1.2.1.2.2.1.9.1", Type: gosnmp.TimeTicks, Value: uint32(100)},
+		{Name: ".1.3.6.1.2.1.2.2.1.9.2", Type: gosnmp.TimeTicks, Value: uint32(200)},
+		{Name: ".1.3.6.1.2.1.2.2.1.9.3", Type: gosnmp.TimeTicks, Value: uint32(300)},
+	}
+
+	// QueryWalker does not fetch the boot time: uptime values are left unset,
+	// with a single warning.
+	output := captureLog(func() {
+		if err := magic.QueryWalker(context.Background(), pdus); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if strings.Count(output, "\n") != 1 || !strings.Contains(output, "boot time is unknown") {
+		t.Errorf("expected a single warning, got %q", output)
+	}
+	if len(mib.Interface) != 3 || !mib.Interface[1].LastChange.IsZero() {
+		t.Errorf("expected unset uptime values, got %+v", mib.Interface[1])
+	}
+
+	// And again for the next query.
+	magic.Reset()
+	output = captureLog(func() {
+		if err := magic.QueryWalker(context.Background(), pdus); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if strings.Count(output, "\n") != 1 {
+		t.Errorf("expected a single warning, got %q", output)
+	}
+
+	magic.Reset()
+	bootTime := time.Unix(1700000000, 0)
+	magic.BootTime = bootTime
+	output = captureLog(func() {
+		if err := magic.QueryWalker(context.Background(), pdus); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if output != "" {
+		t.Errorf("expected no log output, got %q", output)
+	}
+	if !mib.Interface[2].LastChange.Equal(bootTime.Add(2 * time.Second)) {
+		t.Errorf("unexpected uptime value: %v", mib.Interface[2].LastChange)
+	}
+}
@@ -0,0 +1,121 @@
+package snmpmagic
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+)
+
+import (
+	"github.com/soniah/gosnmp"
+)
+
+// Custom decoding of a PDU into a field value, replacing the default one.
+type Converter func(pdu *gosnmp.SnmpPDU, value reflect.Value) error
+
+// Set of converters, selected either by name with the "conv" tag option
+// (e.g. `snmp:"6,conv=mac"`), or by field type. Named converters have
+// precedence. Safe for concurrent use.
+type ConverterRegistry struct {
+	mutex  sync.RWMutex
+	byName map[string]Converter
+	byType map[reflect.Type]Converter
+}
+
+// Builds a registry containing the built-in converters:
+// - "mac": OctetString to MAC address string (e.g. "00:1c:73:00:00:01")
+// - "ipv4": OctetString or IPAddress to dotted IPv4 string or net.IP
+func NewConverterRegistry() *ConverterRegistry {
+	registry := &ConverterRegistry{
+		byName: make(map[string]Converter),
+		byType: make(map[reflect.Type]Converter),
+	}
+	registry.RegisterName("mac", convertMAC)
+	registry.RegisterName("ipv4", convertIPv4)
+	return registry
+}
+
+// Registry used by new SNMPMagic instances.
+var DefaultConverters = NewConverterRegistry()
+
+func (self *ConverterRegistry) RegisterName(name string, converter Converter) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.byName[name] = converter
+}
+
+// Registers a converter for fields of a leaf type. Struct types are mapped as
+// nested structs rather than leaves, so they cannot have type converters.
+func (self *ConverterRegistry) RegisterType(t reflect.Type, converter Converter) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.byType[t] = converter
+}
+
+// Returns the converter for a field, or nil to use the default decoding.
+func (self *ConverterRegistry) lookup(name string, t reflect.Type) (Converter, error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	if name != "" {
+		converter, ok := self.byName[name]
+		if !ok {
+			return nil, fmt.Errorf("snmpmagic: unknown converter '%s'", name)
+		}
+		return converter, nil
+	}
+
+	return self.byType[t], nil
+}
+
+func convertMAC(pdu *gosnmp.SnmpPDU, value reflect.Value) error {
+	bytesVal, ok := pdu.Value.([]byte)
+	if !ok {
+		return fmt.Errorf("mac: expected OctetString, got %v", pdu.Type)
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(net.HardwareAddr(bytesVal).String())
+	case reflect.Slice:
+		if value.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("mac: expected string or []byte field, got %v", value.Type())
+		}
+		value.SetBytes(append([]byte(nil), bytesVal...))
+	default:
+		return fmt.Errorf("mac: expected string or []byte field, got %v", value.Type())
+	}
+
+	return nil
+}
+
+func convertIPv4(pdu *gosnmp.SnmpPDU, value reflect.Value) error {
+	var ip net.IP
+	switch v := pdu.Value.(type) {
+	case []byte:
+		if len(v) != net.IPv4len {
+			return fmt.Errorf("ipv4: expected %d bytes, got %d", net.IPv4len, len(v))
+		}
+		ip = net.IPv4(v[0], v[1], v[2], v[3])
+	case string:
+		// gosnmp decodes IPAddress PDUs as dotted strings.
+		ip = net.ParseIP(v).To4()
+		if ip == nil {
+			return fmt.Errorf("ipv4: invalid address '%s'", v)
+		}
+	default:
+		return fmt.Errorf("ipv4: unexpected %T value", pdu.Value)
+	}
+
+	switch {
+	case value.Kind() == reflect.String:
+		value.SetString(ip.String())
+	case value.Type() == reflect.TypeOf(net.IP{}):
+		value.Set(reflect.ValueOf(ip))
+	default:
+		return fmt.Errorf("ipv4: expected string or net.IP field, got %v", value.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package snmpmagic
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/soniah/gosnmp"
+)
+
+// Type decoded by a type converter, from strings such as "100G".
+type speed uint64
+
+func convertSpeed(pdu *gosnmp.SnmpPDU, value reflect.Value) error {
+	bytesVal, ok := pdu.Value.([]byte)
+	if !ok || !strings.HasSuffix(string(bytesVal), "G") {
+		return errors.New("speed: expected a number of Gbit/s followed by G")
+	}
+	gbps, err := strconv.ParseUint(strings.TrimSuffix(string(bytesVal), "G"), 10, 64)
+	if err != nil {
+		return err
+	}
+	value.SetUint(gbps * 1000000000)
+	return nil
+}
+
+type convertEntry struct {
+	MAC       string `snmp:"1,conv=mac"`
+	MACBytes  []byte `snmp:"2,conv=mac"`
+	Address   string `snmp:"3,conv=ipv4"`
+	IP        net.IP `snmp:"4,conv=ipv4"`
+	Speed     speed  `snmp:"5"`
+	Upper     string `snmp:"6,conv=upper"`
+	SpeedGbps speed  `snmp:"7,conv=gbps"`
+}
+
+type convertMIB struct {
+	Table map[uint]*convertEntry `snmp:".1.3.6.1.4.1.99.1"`
+}
+
+func newConvertRegistry() *ConverterRegistry {
+	registry := NewConverterRegistry()
+	registry.RegisterType(reflect.TypeOf(speed(0)), convertSpeed)
+	registry.RegisterName("upper", func(pdu *gosnmp.SnmpPDU, value reflect.Value) error {
+		value.SetString(strings.ToUpper(string(pdu.Value.([]byte))))
+		return nil
+	})
+	// Speeds without suffix, in Gbit/s
+	registry.RegisterName("gbps", func(pdu *gosnmp.SnmpPDU, value reflect.Value) error {
+		gbps, err := strconv.ParseUint(string(pdu.Value.([]byte)), 10, 64)
+		value.SetUint(gbps * 1000000000)
+		return err
+	})
+	return registry
+}
+
+func TestConverters(t *testing.T) {
+	var mib convertMIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if magic.Converters != DefaultConverters {
+		t.Error("expected new instances to use DefaultConverters")
+	}
+	magic.Converters = newConvertRegistry()
+
+	mac := []byte{0x00, 0x1c, 0x73, 0x00, 0x00, 0x01}
+	pdus := PDUSlice{
+		{Name: ".1.3.6.1.4.1.99.1.1.1", Type: gosnmp.OctetString, Value: mac},
+		{Name: ".1.3.6.1.4.1.99.1.2.1", Type: gosnmp.OctetString, Value: mac},
+		{Name: ".1.3.6.1.4.1.99.1.3.1", Type: gosnmp.OctetString, Value: []byte{10, 0, 0, 1}},
+		{Name: ".1.3.6.1.4.1.99.1.4.1", Type: gosnmp.IPAddress, Value: "192.0.2.1"},
+		{Name: ".1.3.6.1.4.1.99.1.5.1", Type: gosnmp.OctetString, Value: []byte("100G")},
+		{Name: ".1.3.6.1.4.1.99.1.6.1", Type: gosnmp.OctetString, Value: []byte("up")},
+		{Name: ".1.3.6.1.4.1.99.1.7.1", Type: gosnmp.OctetString, Value: []byte("400")},
+	}
+	output := captureLog(func() {
+		if err := magic.QueryWalker(context.Background(), pdus); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if output != "" {
+		t.Errorf("expected no log output, got %q", output)
+	}
+
+	entry := mib.Table[1]
+	if entry == nil {
+		t.Fatalf("expected entry 1, got %v", mib.Table)
+	}
+	if entry.MAC != "00:1c:73:00:00:01" || !reflect.DeepEqual(entry.MACBytes, mac) {
+		t.Errorf("unexpected MAC addresses: %q and %v", entry.MAC, entry.MACBytes)
+	}
+	if entry.Address != "10.0.0.1" || !entry.IP.Equal(net.IPv4(192, 0, 2, 1)) {
+		t.Errorf("unexpected IP addresses: %q and %v", entry.Address, entry.IP)
+	}
+	if entry.Speed != 100000000000 {
+		t.Errorf("unexpected type-converted value: %d", entry.Speed)
+	}
+	// Named converters have precedence over type converters
+	if entry.Upper != "UP" || entry.SpeedGbps != 400000000000 {
+		t.Errorf("unexpected name-converted values: %q and %d", entry.Upper, entry.SpeedGbps)
+	}
+
+	// The default registry does not have our converters
+	if _, err := DefaultConverters.lookup("upper", nil); err == nil {
+		t.Error("expected the upper converter to be unknown to DefaultConverters")
+	}
+}
+
+func TestConverterErrors(t *testing.T) {
+	var mib convertMIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		pdu    gosnmp.SnmpPDU
+		logged string
+	}{
+		{
+			gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.99.1.1.1", Type: gosnmp.Integer, Value: 1},
+			"mac: expected OctetString",
+		},
+		{
+			gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.99.1.3.1", Type: gosnmp.OctetString, Value: []byte{10, 0, 1}},
+			"ipv4: expected 4 bytes, got 3",
+		},
+		{
+			gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.99.1.4.1", Type: gosnmp.IPAddress, Value: "2001:db8::1"},
+			"ipv4: invalid address '2001:db8::1'",
+		},
+		// Unknown to DefaultConverters
+		{
+			gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.99.1.6.1", Type: gosnmp.OctetString, Value: []byte("up")},
+			"unknown converter 'upper'",
+		},
+	}
+	for _, testCase := range testCases {
+		output := captureLog(func() {
+			if err := magic.HandlePDU(testCase.pdu); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if !strings.Contains(output, testCase.logged) || !strings.Contains(output, "convertEntry.") {
+			t.Errorf("%s: expected %q to be logged, got %q", testCase.pdu.Name, testCase.logged, output)
+		}
+	}
+
+	if entry := mib.Table[1]; entry == nil || entry.MAC != "" || entry.Address != "" || entry.IP != nil || entry.Upper != "" {
+		t.Errorf("expected fields to be left unset, got %+v", entry)
+	}
+}
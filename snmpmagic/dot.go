@@ -0,0 +1,53 @@
+package snmpmagic
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Writes the tree as a Graphviz digraph. Edges are labeled with the OID
+// elements leading to a node, and nodes with their field name, with a shape
+// and color depending on their type.
+func (self *OIDTree) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "digraph OIDTree {")
+	fmt.Fprintln(bw, "  node [fontname=\"monospace\"];")
+	fmt.Fprintln(bw, "  edge [fontname=\"monospace\"];")
+	fmt.Fprintln(bw, "  root [shape=point];")
+
+	nextID := 0
+	self.writeDOTNode(bw, "root", self.prefix.String(), &nextID)
+
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+func (self *OIDTree) writeDOTNode(w io.Writer, parentID string, edgeLabel string, nextID *int) {
+	id := "n" + strconv.Itoa(*nextID)
+	*nextID += 1
+
+	var shape, color string
+	switch self.nodeType {
+	case LeafNode:
+		shape, color = "box", "lightblue"
+	case SuffixCatcherNode:
+		shape, color = "doubleoctagon", "orange"
+	default:
+		shape, color = "ellipse", "lightgrey"
+	}
+
+	fmt.Fprintf(
+		w, "  %s [label=%q, shape=%s, style=filled, fillcolor=%s];\n",
+		id, self.fieldQualifiedName, shape, color,
+	)
+	fmt.Fprintf(w, "  %s -> %s [label=%q];\n", parentID, id, edgeLabel)
+
+	for _, key := range self.sortedChildKeys() {
+		child := self.children[key]
+		label := append(OID{key}, child.prefix...).String()
+		child.writeDOTNode(w, id, label, nextID)
+	}
+}
@@ -0,0 +1,51 @@
+package snmpmagic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Returned by Query and Replay when SNMPMagic.MaxPDUs is reached. Data handled
+// until then is still filled in the destination.
+var ErrTooManyPDUs = errors.New("snmpmagic: too many PDUs, walk truncated")
+
+// Failure to walk a given root OID.
+type RootError struct {
+	Root OID
+	Err  error
+}
+
+func (self *RootError) Error() string {
+	return fmt.Sprintf("%s: %v", self.Root, self.Err)
+}
+
+// Error returned by Query when some root OIDs could not be walked. Data from
+// the other roots is still filled in the destination.
+type QueryError struct {
+	RootCount int
+	Failures  []*RootError
+}
+
+func (self *QueryError) Error() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(
+		&sb, "snmpmagic: failed to walk %d/%d roots", len(self.Failures), self.RootCount,
+	)
+	for i, failure := range self.Failures {
+		if i == 0 {
+			sb.WriteString(": ")
+		} else {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(failure.Error())
+	}
+
+	return sb.String()
+}
+
+// Whether at least one root was successfully walked.
+func (self *QueryError) IsPartial() bool {
+	return len(self.Failures) < self.RootCount
+}
@@ -2,6 +2,7 @@ package snmpmagic
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -9,19 +10,48 @@ import (
 type OID []uint
 
 func ParseOID(str string) (OID, error) {
-	// Split into OID path elements, drop leading dot(s)
-	parts := strings.Split(str, ".")
-	for len(parts) > 0 && parts[0] == "" {
-		parts = parts[1:]
+	return ParseOIDInto(make(OID, 0, strings.Count(str, ".")+1), str)
+}
+
+// Same as ParseOID, but reuses the storage of buf, whose elements are
+// overwritten. Parses the string in a single pass, without allocating unless
+// buf is too small.
+func ParseOIDInto(buf OID, str string) (OID, error) {
+	// Drop leading dot(s)
+	i := 0
+	for i < len(str) && str[i] == '.' {
+		i++
+	}
+
+	oid := buf[:0]
+	if i == len(str) {
+		return oid, nil
 	}
 
-	oid := make(OID, len(parts))
-	for i, part := range parts {
-		if partUint, err := strconv.ParseUint(part, 10, 64); err != nil {
-			return nil, err
-		} else {
-			oid[i] = uint(partUint)
+	for start := i; i <= len(str); i++ {
+		if i < len(str) && str[i] != '.' {
+			continue
 		}
+
+		// Same results and errors as strconv.ParseUint, without its overhead.
+		part := str[start:i]
+		if part == "" {
+			return nil, &strconv.NumError{Func: "ParseUint", Num: part, Err: strconv.ErrSyntax}
+		}
+		var value uint64
+		for j := 0; j < len(part); j++ {
+			digit := uint64(part[j] - '0')
+			if digit > 9 {
+				return nil, &strconv.NumError{Func: "ParseUint", Num: part, Err: strconv.ErrSyntax}
+			}
+			if value > (math.MaxUint64-digit)/10 {
+				return nil, &strconv.NumError{Func: "ParseUint", Num: part, Err: strconv.ErrRange}
+			}
+			value = value*10 + digit
+		}
+
+		oid = append(oid, uint(value))
+		start = i + 1
 	}
 
 	return oid, nil
@@ -64,3 +94,31 @@ func (self OID) LongestCommonPrefixLength(other OID) int {
 
 	return prefixLen
 }
+
+// Returns whether the OID is under (or equal to) a given prefix.
+func (self OID) HasPrefix(prefix OID) bool {
+	return len(self) >= len(prefix) && self.LongestCommonPrefixLength(prefix) == len(prefix)
+}
+
+// Orders OIDs element by element, a prefix coming before longer OIDs (i.e. in
+// walk order). Returns -1, 0 or 1 when the OID is respectively lower than,
+// equal to or greater than the other.
+func (self OID) Compare(other OID) int {
+	prefixLen := self.LongestCommonPrefixLength(other)
+	switch {
+	case prefixLen < len(self) && prefixLen < len(other):
+		if self[prefixLen] < other[prefixLen] {
+			return -1
+		}
+		return 1
+	case len(self) < len(other):
+		return -1
+	case len(self) > len(other):
+		return 1
+	}
+	return 0
+}
+
+func oidEqual(a, b OID) bool {
+	return a.Compare(b) == 0
+}
@@ -0,0 +1,213 @@
+package snmpmagic
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Parser ParseOID replaced, kept as a reference of its results and errors.
+func parseOIDSplit(str string) (OID, error) {
+	parts := strings.Split(str, ".")
+	for len(parts) > 0 && parts[0] == "" {
+		parts = parts[1:]
+	}
+
+	oid := make(OID, len(parts))
+	for i, part := range parts {
+		if partUint, err := strconv.ParseUint(part, 10, 64); err != nil {
+			return nil, err
+		} else {
+			oid[i] = uint(partUint)
+		}
+	}
+
+	return oid, nil
+}
+
+var oidCorpus = []string{
+	"",
+	".",
+	"..",
+	"0",
+	"1.3.6.1.2.1.2.2.1.2.1",
+	".1.3.6.1.2.1.2.2.1.2.1",
+	"..1.3.6",
+	".1.3.6.1.4.1.2636.3.60.1.2.1.1.6.501.0",
+	"1.3.6.1.4.1.4294967295",
+	"1.18446744073709551615",
+	// Empty components
+	"1..3",
+	"1.3.",
+	".1.3.6.",
+	// Overflow
+	"1.18446744073709551616",
+	"1.99999999999999999999999",
+	// Non-digits
+	"1.3.a",
+	"1.-3",
+	"1.+3",
+	"1.3 ",
+	" 1.3",
+	"1,3",
+	"iso.3.6",
+}
+
+func TestParseOIDCorpus(t *testing.T) {
+	buf := make(OID, 0, 4)
+	for _, str := range oidCorpus {
+		expected, expectedErr := parseOIDSplit(str)
+
+		oid, err := ParseOID(str)
+		if !reflect.DeepEqual(oid, expected) || fmt.Sprint(err) != fmt.Sprint(expectedErr) {
+			t.Errorf("ParseOID(%q) = %v, %v, expected %v, %v", str, oid, err, expected, expectedErr)
+		}
+
+		// Results do not depend on the previous content of the buffer.
+		oid, err = ParseOIDInto(buf, str)
+		if !reflect.DeepEqual(oid, expected) || fmt.Sprint(err) != fmt.Sprint(expectedErr) {
+			t.Errorf("ParseOIDInto(%q) = %v, %v, expected %v, %v", str, oid, err, expected, expectedErr)
+		}
+		if err == nil {
+			buf = oid
+		}
+	}
+}
+
+func TestParseOIDIntoReusesBuffer(t *testing.T) {
+	buf := make(OID, 0, 16)
+	oid, err := ParseOIDInto(buf, ".1.3.6.1.2.1.1.5.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &oid[0] != &buf[:1][0] {
+		t.Error("expected the OID to be stored in the buffer")
+	}
+
+	// Growing past the capacity of the buffer allocates.
+	oid, err = ParseOIDInto(make(OID, 0, 2), "1.3.6.1")
+	if err != nil || oid.String() != "1.3.6.1" {
+		t.Errorf("unexpected result %v, %v", oid, err)
+	}
+}
+
+func TestOIDHasPrefix(t *testing.T) {
+	testCases := []struct {
+		oid      OID
+		prefix   OID
+		expected bool
+	}{
+		{OID{1, 3, 6, 1, 2, 1}, OID{1, 3, 6, 1}, true},
+		{OID{1, 3, 6, 1}, OID{1, 3, 6, 1}, true},
+		{OID{1, 3, 6, 1}, OID{}, true},
+		{OID{}, OID{}, true},
+		// Prefixes are compared element by element, not as strings
+		{OID{1, 3, 6, 10}, OID{1, 3, 6, 1}, false},
+		{OID{1, 3, 6}, OID{1, 3, 6, 1}, false},
+		{OID{1, 3, 7, 1}, OID{1, 3, 6}, false},
+		{OID{}, OID{1}, false},
+	}
+	for _, testCase := range testCases {
+		if hasPrefix := testCase.oid.HasPrefix(testCase.prefix); hasPrefix != testCase.expected {
+			t.Errorf("%v.HasPrefix(%v) = %v, expected %v", testCase.oid, testCase.prefix, hasPrefix, testCase.expected)
+		}
+	}
+}
+
+func TestOIDCompare(t *testing.T) {
+	testCases := []struct {
+		a, b     OID
+		expected int
+	}{
+		{OID{1, 3, 6}, OID{1, 3, 6}, 0},
+		{OID{}, OID{}, 0},
+		{OID{1, 3, 6}, OID{1, 3, 7}, -1},
+		// Elements are compared numerically, not as strings
+		{OID{1, 3, 2}, OID{1, 3, 10}, -1},
+		// Prefixes come before longer OIDs, in walk order
+		{OID{1, 3, 6}, OID{1, 3, 6, 1}, -1},
+		{OID{}, OID{0}, -1},
+		{OID{1, 3, 6, 1}, OID{1, 3, 7}, -1},
+	}
+	for _, testCase := range testCases {
+		if result := testCase.a.Compare(testCase.b); result != testCase.expected {
+			t.Errorf("%v.Compare(%v) = %d, expected %d", testCase.a, testCase.b, result, testCase.expected)
+		}
+		if result := testCase.b.Compare(testCase.a); result != -testCase.expected {
+			t.Errorf("%v.Compare(%v) = %d, expected %d", testCase.b, testCase.a, result, -testCase.expected)
+		}
+	}
+}
+
+func TestRootOIDsOrder(t *testing.T) {
+	// Fields are not in OID order
+	type MIB struct {
+		JuniperDOM map[uint]*benchInterfaceEntry `snmp:".1.3.6.1.4.1.2636.3.60.1.1.1.1"`
+		IfXTable   map[uint]*benchInterfaceEntry `snmp:".1.3.6.1.2.1.31.1.1.1"`
+		System     struct {
+			Name string `snmp:"5"`
+		} `snmp:".1.3.6.1.2.1.1"`
+		Interface map[uint]*benchInterfaceEntry `snmp:".1.3.6.1.2.1.2.2.1"`
+	}
+	magic, err := NewSNMPMagic(&MIB{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var roots []string
+	for _, root := range magic.RootOIDs() {
+		roots = append(roots, root.String())
+	}
+	expected := []string{
+		"1.3.6.1.2.1.1",
+		"1.3.6.1.2.1.2.2.1",
+		"1.3.6.1.2.1.31.1.1.1",
+		"1.3.6.1.4.1.2636.3.60.1.1.1.1",
+	}
+	if !reflect.DeepEqual(roots, expected) {
+		t.Errorf("got roots %v, expected %v", roots, expected)
+	}
+
+	// Printing does not depend on map iteration order either.
+	str := magic.String()
+	for i := 0; i < 10; i++ {
+		if other := magic.String(); other != str {
+			t.Fatalf("got different outputs:\n%s\nand:\n%s", str, other)
+		}
+	}
+	if !strings.Contains(str, "- 1.3.6.1.2.1.1\n- 1.3.6.1.2.1.2.2.1\n") {
+		t.Errorf("expected roots to be printed in order, got:\n%s", str)
+	}
+}
+
+const benchmarkOID = ".1.3.6.1.4.1.2636.3.60.1.2.1.1.6.501.0"
+
+func BenchmarkParseOID(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseOID(benchmarkOID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseOIDInto(b *testing.B) {
+	buf := make(OID, 0, 32)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseOIDInto(buf, benchmarkOID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseOIDSplit(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := parseOIDSplit(benchmarkOID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package snmpmagic
 
 import (
 	"fmt"
+	"log"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"unicode"
@@ -24,7 +26,7 @@ func BuildOIDTree(x interface{}) (*OIDTree, error) {
 	}
 
 	oidTree := NewOIDTree()
-	if err := oidTree.prepare(t, nil, ""); err != nil {
+	if err := oidTree.prepare(t, nil, "", false); err != nil {
 		return nil, err
 	}
 
@@ -32,6 +34,15 @@ func BuildOIDTree(x interface{}) (*OIDTree, error) {
 	return cachedOidTree.(*OIDTree), nil
 }
 
+// Drops all cached OID trees, so that the next BuildOIDTree calls rebuild
+// them. SNMPMagic instances created before keep using their own tree.
+func ClearOIDTreeCache() {
+	oidTreeCacheByType.Range(func(key, _ interface{}) bool {
+		oidTreeCacheByType.Delete(key)
+		return true
+	})
+}
+
 type OIDNodeType uint
 
 const (
@@ -48,6 +59,17 @@ type OIDTree struct {
 	fieldIndex         int
 	fieldQualifiedName string
 	nodeType           OIDNodeType
+	options            TagOptions
+
+	// Full OID of a leaf field, used to resolve relative OID values.
+	absolutePath OID
+
+	// Whether a leaf is a scalar (outside of any table), whose value is the
+	// ".0" instance of its OID.
+	isScalar bool
+
+	// Whether the tree has time.Time leaves (only set on the root).
+	hasTimeFields bool
 }
 
 func NewOIDTree() *OIDTree {
@@ -57,6 +79,7 @@ func NewOIDTree() *OIDTree {
 		fieldIndex:         -1,
 		fieldQualifiedName: "",
 		nodeType:           UninitializedNode,
+		options:            DefaultTagOptions(),
 	}
 }
 
@@ -68,60 +91,107 @@ func (self *OIDTree) IsSuffixCatching() bool {
 	return self.nodeType == SuffixCatcherNode
 }
 
-func (self *OIDTree) prepare(t reflect.Type, prefix OID, parentName string) error {
+func (self *OIDTree) prepare(t reflect.Type, prefix OID, parentName string, inTable bool) error {
 	// Dereference pointers.
 	if t.Kind() == reflect.Ptr {
-		self.prepare(t.Elem(), prefix, t.Elem().Name())
-		return nil
+		return self.prepare(t.Elem(), prefix, t.Elem().Name(), inTable)
 	}
 
 	for fieldIndex := 0; fieldIndex < t.NumField(); fieldIndex++ {
 		field := t.Field(fieldIndex)
 
+		// Fields without tags are not mapped to OIDs, e.g. computed fields.
 		snmpTag := field.Tag.Get("snmp")
 		if snmpTag == "" {
-			return nil
+			continue
 		}
 
 		// Unexported fields cannot be set.
-		// TODO: log warning - has SNMP tag but cannot be set
 		if strings.IndexFunc(field.Name, unicode.IsLower) == 0 {
+			log.Printf(
+				"WARNING: snmpmagic: %s.%s has an snmp tag but is unexported, ignoring it",
+				parentName, field.Name,
+			)
 			continue
 		}
 
-		snmpTagOid, err := ParseOID(snmpTag)
+		snmpTagOid, options, err := ParseTag(snmpTag)
 		if err != nil {
-			return err
+			return fmt.Errorf("%s.%s: %v", parentName, field.Name, err)
 		}
 
+		fieldQualifiedName := parentName + "." + field.Name
 		path := append(prefix.Copy(), snmpTagOid...)
 		if snmpTag[0] == '.' && len(prefix) > 0 {
-			// TODO: log warning - ignoring absolute path outside of top level
+			log.Printf(
+				"WARNING: snmpmagic: %s: absolute tag '%s' below the top level is relative to %s",
+				fieldQualifiedName, snmpTag, prefix,
+			)
 		}
 
-		fieldQualifiedName := parentName + "." + field.Name
-		switch field.Type.Kind() {
-		case reflect.Struct:
-			self.Insert(path, fieldIndex, fieldQualifiedName, SimpleNode)
-			self.prepare(field.Type, path, field.Type.Name())
+		if options.Capacity != 0 && field.Type.Kind() != reflect.Map {
+			return fmt.Errorf("%s: cap can only be used with map tables", fieldQualifiedName)
+		}
 
-		case reflect.Map:
-			self.Insert(path, fieldIndex, fieldQualifiedName, SuffixCatcherNode)
-			self.prepare(field.Type.Elem(), path, field.Type.Elem().Name())
+		switch kind := field.Type.Kind(); {
+		// time.Time is a value rather than a sub-tree.
+		case kind == reflect.Struct && field.Type != timeType:
+			self.Insert(path, fieldIndex, fieldQualifiedName, SimpleNode, options)
+			if err := self.prepare(field.Type, path, field.Type.Name(), inTable); err != nil {
+				return err
+			}
+
+		// Struct pointers are allocated when the first PDU under them is received.
+		case kind == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct &&
+			field.Type.Elem() != timeType:
+			self.Insert(path, fieldIndex, fieldQualifiedName, SimpleNode, options)
+			if err := self.prepare(field.Type.Elem(), path, field.Type.Elem().Name(), inTable); err != nil {
+				return err
+			}
+
+		// Tables indexed by a single integer can also be slices of structs.
+		case kind == reflect.Slice && isStructOrStructPtr(field.Type.Elem()):
+			elemType := field.Type.Elem()
+			if elemType.Kind() == reflect.Ptr {
+				elemType = elemType.Elem()
+			}
+			self.Insert(path, fieldIndex, fieldQualifiedName, SuffixCatcherNode, options)
+			if err := self.prepare(elemType, path, elemType.Name(), true); err != nil {
+				return err
+			}
+
+		case kind == reflect.Map:
+			if _, err := mapKeyArity(field.Type.Key()); err != nil {
+				return fmt.Errorf("%s: %v", fieldQualifiedName, err)
+			}
+			self.Insert(path, fieldIndex, fieldQualifiedName, SuffixCatcherNode, options)
+			if err := self.prepare(field.Type.Elem(), path, field.Type.Elem().Name(), true); err != nil {
+				return err
+			}
 
 		default:
-			self.Insert(path, fieldIndex, fieldQualifiedName, LeafNode)
+			if options.Scale != 1 && !isFloatKind(kind) {
+				return fmt.Errorf("%s: scale can only be used with float fields", fieldQualifiedName)
+			}
+			self.Insert(path, fieldIndex, fieldQualifiedName, LeafNode, options)
+			if node := self.find(path); node != nil {
+				node.absolutePath = path
+				node.isScalar = !inTable
+			}
+			if field.Type == timeType {
+				self.hasTimeFields = true
+			}
 		}
 	}
 
 	return nil
 }
 
-func (self *OIDTree) createOrUpdateChild(path OID, fieldIndex int, fieldQualifiedName string, nodeType OIDNodeType) {
+func (self *OIDTree) createOrUpdateChild(path OID, fieldIndex int, fieldQualifiedName string, nodeType OIDNodeType, options TagOptions) {
 	key := path[0]
 	childPath := path[1:]
 	if child, ok := self.children[key]; ok {
-		child.Insert(childPath, fieldIndex, fieldQualifiedName, nodeType)
+		child.Insert(childPath, fieldIndex, fieldQualifiedName, nodeType, options)
 	} else if self.IsLeaf() {
 		panic("snmpmagic: oidtree: cannot insert node under a leaf")
 	} else {
@@ -131,6 +201,7 @@ func (self *OIDTree) createOrUpdateChild(path OID, fieldIndex int, fieldQualifie
 			fieldIndex:         fieldIndex,
 			fieldQualifiedName: fieldQualifiedName,
 			nodeType:           nodeType,
+			options:            options,
 		}
 	}
 }
@@ -148,21 +219,35 @@ func (self *OIDTree) prettyPrint(sb *strings.Builder, indent string) {
 	}
 	if self.IsLeaf() {
 		sb.WriteString("<leaf>")
+		if self.isScalar {
+			sb.WriteString(" <scalar>")
+		}
 	}
 	sb.WriteRune('\n')
 
-	for key, child := range self.children {
+	for _, key := range self.sortedChildKeys() {
 		fmt.Fprintf(sb, "%s[%v]\n", indent, key)
-		child.prettyPrint(sb, indent+"  ")
+		self.children[key].prettyPrint(sb, indent+"  ")
+	}
+}
+
+// Returns the keys of children in OID order, for stable outputs.
+func (self *OIDTree) sortedChildKeys() []uint {
+	keys := make([]uint, 0, len(self.children))
+	for key := range self.children {
+		keys = append(keys, key)
 	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
 }
 
-func (self *OIDTree) Insert(path OID, fieldIndex int, fieldQualifiedName string, nodeType OIDNodeType) {
+func (self *OIDTree) Insert(path OID, fieldIndex int, fieldQualifiedName string, nodeType OIDNodeType, options TagOptions) {
 	if self.nodeType == UninitializedNode {
 		self.prefix = path.Copy()
 		self.fieldIndex = fieldIndex
 		self.fieldQualifiedName = fieldQualifiedName
 		self.nodeType = nodeType
+		self.options = options
 		return
 	}
 
@@ -171,7 +256,7 @@ func (self *OIDTree) Insert(path OID, fieldIndex int, fieldQualifiedName string,
 	// Check whether can just insert a child node.
 	if commonLen == len(self.prefix) && commonLen < len(path) {
 		self.createOrUpdateChild(
-			path[commonLen:], fieldIndex, fieldQualifiedName, nodeType,
+			path[commonLen:], fieldIndex, fieldQualifiedName, nodeType, options,
 		)
 		return
 	}
@@ -189,6 +274,9 @@ func (self *OIDTree) Insert(path OID, fieldIndex int, fieldQualifiedName string,
 			fieldIndex:         self.fieldIndex,
 			fieldQualifiedName: self.fieldQualifiedName,
 			nodeType:           self.nodeType,
+			options:            self.options,
+			absolutePath:       self.absolutePath,
+			isScalar:           self.isScalar,
 		},
 	}
 
@@ -198,10 +286,13 @@ func (self *OIDTree) Insert(path OID, fieldIndex int, fieldQualifiedName string,
 	self.fieldIndex = -1
 	self.fieldQualifiedName = ""
 	self.nodeType = SimpleNode
+	self.options = DefaultTagOptions()
+	self.absolutePath = nil
+	self.isScalar = false
 
 	// Insert new child.
 	self.createOrUpdateChild(
-		path[commonLen:], fieldIndex, fieldQualifiedName, nodeType,
+		path[commonLen:], fieldIndex, fieldQualifiedName, nodeType, options,
 	)
 }
 
@@ -224,25 +315,74 @@ func (self *OIDTree) FindNext(path OID) (next *OIDTree, remainder OID) {
 	return nil, path
 }
 
-func (self *OIDTree) PrefixPaths() (paths []OID) {
-	if self.IsLeaf() {
-		return
+// Returns the node whose full path is exactly the given path, if any.
+func (self *OIDTree) find(path OID) *OIDTree {
+	node, remainder := self, path
+	for node != nil {
+		next, nextRemainder := node.FindNext(remainder)
+		if next == node && len(nextRemainder) == 0 {
+			return node
+		}
+		node, remainder = next, nextRemainder
 	}
+	return nil
+}
 
-	if self.IsSuffixCatching() {
-		paths = append(paths, self.prefix.Copy())
-		return
+// Returns the OIDs of the sub-trees walked by queries (see RootOIDs), in no
+// particular order.
+func (self *OIDTree) PrefixPaths() (paths []OID) {
+	// Nodes left to visit, with the path leading to them (without their own
+	// prefix). Paths are capped, so that appending to them always copies
+	// rather than overwriting the path of a sibling.
+	type pendingNode struct {
+		node *OIDTree
+		path OID
 	}
+	pending := []pendingNode{{self, nil}}
+
+	for len(pending) > 0 {
+		top := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		node := top.node
+		path := append(top.path, node.prefix...)
+		path = path[:len(path):len(path)]
+
+		switch {
+		// Walking the OID of a scalar yields its single instance.
+		case node.IsLeaf():
+			if node.isScalar {
+				paths = append(paths, path)
+			}
+
+		case node.IsSuffixCatching():
+			paths = append(paths, path)
 
-	for key, child := range self.children {
-		for _, path := range child.PrefixPaths() {
-			prefixPath := self.prefix.Copy()
-			prefixPath = append(prefixPath, key)
-			prefixPath = append(prefixPath, path...)
+		// Struct fields without tables (e.g. groups of scalars) are walked as a
+		// whole.
+		case node.fieldIndex >= 0 && !node.hasSuffixCatchers():
+			paths = append(paths, path)
 
-			paths = append(paths, prefixPath)
+		default:
+			for key, child := range node.children {
+				pending = append(pending, pendingNode{child, append(path, key)})
+			}
 		}
 	}
 
 	return
 }
+
+// Whether the sub-tree has suffix-catching nodes (i.e. tables).
+func (self *OIDTree) hasSuffixCatchers() bool {
+	if self.IsSuffixCatching() {
+		return true
+	}
+
+	for _, child := range self.children {
+		if child.hasSuffixCatchers() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package snmpmagic
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/soniah/gosnmp"
+)
+
+func TestBuildOIDTreeMapEntryErrors(t *testing.T) {
+	type ScaledEntry struct {
+		Value int `snmp:"1,scale=0.1"`
+	}
+	type ScaledMIB struct {
+		Table map[uint]*ScaledEntry `snmp:".1.3.6.1.4.1.1"`
+	}
+	type CappedEntry struct {
+		Values []uint `snmp:"1,cap=4"`
+	}
+	type CappedMIB struct {
+		Table map[uint]CappedEntry `snmp:".1.3.6.1.4.1.1"`
+	}
+
+	testCases := []struct {
+		name     string
+		mib      interface{}
+		expected string
+	}{
+		{"scale on int", &ScaledMIB{}, "ScaledEntry.Value: scale can only be used with float fields"},
+		{"cap on slice", &CappedMIB{}, "CappedEntry.Values: cap can only be used with map tables"},
+	}
+	for _, testCase := range testCases {
+		_, err := BuildOIDTree(testCase.mib)
+		if err == nil || !strings.Contains(err.Error(), testCase.expected) {
+			t.Errorf("%s: expected error %q, got %v", testCase.name, testCase.expected, err)
+		}
+	}
+}
+
+func TestClearOIDTreeCache(t *testing.T) {
+	first, err := BuildOIDTree(&benchMIB{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached, _ := BuildOIDTree(&benchMIB{}); cached != first {
+		t.Error("expected the tree to be cached by type")
+	}
+
+	magic, err := NewSNMPMagic(&benchMIB{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ClearOIDTreeCache()
+	rebuilt, err := BuildOIDTree(&benchMIB{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt == first {
+		t.Error("expected the tree to be rebuilt once the cache is cleared")
+	}
+	if rebuilt.String() != first.String() {
+		t.Errorf("rebuilt tree differs:\n%s\nfrom:\n%s", rebuilt, first)
+	}
+
+	// Existing instances keep their tree
+	if magic.oidTree != first {
+		t.Error("expected existing instances to keep their tree")
+	}
+}
+
+func TestUntaggedFieldsAreSkipped(t *testing.T) {
+	type Entry struct {
+		Descr    string `snmp:"2"`
+		Computed float32
+		Speed    uint `snmp:"5"`
+	}
+	type MIB struct {
+		Name      string `snmp:".1.3.6.1.2.1.1.5.0"`
+		Cache     map[string]string
+		Interface map[uint]*Entry `snmp:".1.3.6.1.2.1.2.2.1"`
+	}
+
+	var mib MIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	magic.TrackUnmapped = true
+
+	// Fields after untagged ones are still mapped.
+	pdus := PDUSlice{
+		{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: []byte("switch1")},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.1", Type: gosnmp.OctetString, Value: []byte("Ethernet1")},
+		{Name: ".1.3.6.1.2.1.2.2.1.5.1", Type: gosnmp.Gauge32, Value: uint(1000000000)},
+	}
+	if err := magic.QueryWalker(context.Background(), pdus); err != nil {
+		t.Fatal(err)
+	}
+	if count, sample := magic.Unmapped(); count != 0 {
+		t.Errorf("expected all PDUs to be mapped, got %v", sample)
+	}
+
+	entry := mib.Interface[1]
+	if mib.Name != "switch1" || entry == nil || entry.Descr != "Ethernet1" || entry.Speed != 1000000000 {
+		t.Fatalf("unexpected data: %+v, %+v", mib, entry)
+	}
+	if mib.Cache != nil || entry.Computed != 0 {
+		t.Errorf("expected untagged fields to be left as is, got %+v, %+v", mib, entry)
+	}
+}
+
+func TestAbsoluteTagBelowTopLevel(t *testing.T) {
+	type Group struct {
+		Name string `snmp:".5.0"`
+	}
+	type MIB struct {
+		System Group `snmp:".1.3.6.1.2.1.1"`
+	}
+
+	var mib MIB
+	var magic *SNMPMagic
+	output := captureLog(func() {
+		var err error
+		if magic, err = NewSNMPMagic(&mib); err != nil {
+			t.Fatal(err)
+		}
+	})
+	expected := "WARNING: snmpmagic: Group.Name: absolute tag '.5.0' below the top level is relative to 1.3.6.1.2.1.1"
+	if !strings.Contains(output, expected) {
+		t.Errorf("expected %q to be logged, got %q", expected, output)
+	}
+
+	// The tag is used as a relative one.
+	pdu := gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: []byte("spine-01")}
+	if err := magic.HandlePDU(pdu); err != nil {
+		t.Fatal(err)
+	}
+	if mib.System.Name != "spine-01" {
+		t.Errorf("expected the field to be mapped under its parent, got %+v", mib)
+	}
+}
@@ -0,0 +1,155 @@
+package snmpmagic
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+import (
+	"github.com/soniah/gosnmp"
+)
+
+// PDU as stored in records, one JSON object per line. Octet strings are base64
+// encoded, as by encoding/json.
+type RecordedPDU struct {
+	Name  string
+	Type  gosnmp.Asn1BER
+	Value interface{}
+
+	// Wall-clock time the PDU was received, only set for the sysUpTime fetched
+	// for BootTime, which is not handled as a PDU on replay.
+	Time *time.Time `json:",omitempty"`
+}
+
+// Writes a PDU to the recorder, if any, with the time it was received if not
+// nil. Must be called with the mutex held.
+func (self *SNMPMagic) record(pdu *gosnmp.SnmpPDU, receivedAt *time.Time) {
+	if self.Recorder == nil {
+		return
+	}
+
+	line, err := json.Marshal(&RecordedPDU{pdu.Name, pdu.Type, pdu.Value, receivedAt})
+	if err == nil {
+		_, err = self.Recorder.Write(append(line, '\n'))
+	}
+	if err != nil {
+		log.Println("ERROR: could not record PDU", pdu.Name, ":", err)
+	}
+}
+
+// Fills the destination from PDUs previously written to a Recorder, instead of
+// querying an agent. BootTime is rebuilt from the recorded sysUpTime and the
+// time it was received, see RecordedAt.
+func (self *SNMPMagic) Replay(r io.Reader) error {
+	if !atomic.CompareAndSwapInt32(&self.isFilled, 0, 1) {
+		return errors.New("snmpmagic: structure has already been filled")
+	}
+
+	start := time.Now()
+	defer func() {
+		self.queryDuration = time.Since(start)
+	}()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		pdu, receivedAt, err := decodeRecordedPDU(scanner.Bytes())
+		if err != nil {
+			return fmt.Errorf("snmpmagic: invalid record at line %d: %v", lineNum, err)
+		}
+
+		// Boot time is recorded as the sysUpTime fetched before walks, with
+		// the time it was received. Records of earlier versions lack the
+		// latter: it is then the first line, and the current time is used.
+		if pdu.Name == sysUpTimeOID && (receivedAt != nil || lineNum == 1) {
+			if ticks, ok := toUint64(pdu.Value); ok && self.BootTime.IsZero() {
+				if receivedAt == nil {
+					now := time.Now()
+					receivedAt = &now
+				} else {
+					self.recordedAt = *receivedAt
+				}
+				self.BootTime = receivedAt.Add(-time.Duration(ticks) * 10 * time.Millisecond)
+			}
+			continue
+		}
+
+		if err := self.HandlePDU(*pdu); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Returns the wall-clock time the data filled by Replay was recorded at (when
+// the boot time of the agent was fetched), or the zero time if unknown.
+func (self *SNMPMagic) RecordedAt() time.Time {
+	return self.recordedAt
+}
+
+// Decodes a record line, restoring the Go types gosnmp uses for each PDU type.
+// Also returns the time the PDU was received, if recorded.
+func decodeRecordedPDU(line []byte) (*gosnmp.SnmpPDU, *time.Time, error) {
+	var record struct {
+		Name  string
+		Type  gosnmp.Asn1BER
+		Value json.RawMessage
+		Time  *time.Time
+	}
+	if err := json.Unmarshal(line, &record); err != nil {
+		return nil, nil, err
+	}
+
+	pdu := &gosnmp.SnmpPDU{Name: record.Name, Type: record.Type}
+	if len(record.Value) == 0 || string(record.Value) == "null" {
+		return pdu, record.Time, nil
+	}
+
+	var err error
+	switch record.Type {
+	case gosnmp.Integer:
+		var value int
+		err = json.Unmarshal(record.Value, &value)
+		pdu.Value = value
+	case gosnmp.Counter32, gosnmp.Gauge32:
+		var value uint
+		err = json.Unmarshal(record.Value, &value)
+		pdu.Value = value
+	case gosnmp.TimeTicks, gosnmp.Uinteger32:
+		var value uint32
+		err = json.Unmarshal(record.Value, &value)
+		pdu.Value = value
+	case gosnmp.Counter64:
+		var value uint64
+		err = json.Unmarshal(record.Value, &value)
+		pdu.Value = value
+	case gosnmp.OctetString, gosnmp.Opaque, gosnmp.BitString:
+		var value []byte
+		err = json.Unmarshal(record.Value, &value)
+		pdu.Value = value
+	case gosnmp.ObjectIdentifier, gosnmp.IPAddress:
+		var value string
+		err = json.Unmarshal(record.Value, &value)
+		pdu.Value = value
+	case gosnmp.OpaqueFloat:
+		var value float32
+		err = json.Unmarshal(record.Value, &value)
+		pdu.Value = value
+	case gosnmp.OpaqueDouble:
+		var value float64
+		err = json.Unmarshal(record.Value, &value)
+		pdu.Value = value
+	default:
+		err = errors.New("unsupported type " + strconv.Itoa(int(record.Type)))
+	}
+
+	return pdu, record.Time, err
+}
@@ -0,0 +1,166 @@
+package snmpmagic
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soniah/gosnmp"
+)
+
+type recordEntry struct {
+	Name    string  `snmp:"2"`
+	Enabled bool    `snmp:"3"`
+	Counter uint64  `snmp:"4"`
+	Level   int     `snmp:"5"`
+	Ratio   float64 `snmp:"6"`
+	Address string  `snmp:"7"`
+	Object  OID     `snmp:"8"`
+	Ticks   uint32  `snmp:"9"`
+}
+
+type recordMIB struct {
+	Table map[uint]*recordEntry `snmp:".1.3.6.1.4.1.99.1"`
+}
+
+// PDUs of every type a record may hold, with the Go types gosnmp decodes them
+// to.
+var recordPDUs = PDUSlice{
+	{Name: ".1.3.6.1.4.1.99.1.2.1", Type: gosnmp.OctetString, Value: []byte("Ethernet1")},
+	{Name: ".1.3.6.1.4.1.99.1.3.1", Type: gosnmp.Integer, Value: 1},
+	{Name: ".1.3.6.1.4.1.99.1.4.1", Type: gosnmp.Counter64, Value: uint64(1) << 40},
+	{Name: ".1.3.6.1.4.1.99.1.5.1", Type: gosnmp.Integer, Value: -42},
+	{Name: ".1.3.6.1.4.1.99.1.6.1", Type: gosnmp.OpaqueDouble, Value: float64(0.25)},
+	{Name: ".1.3.6.1.4.1.99.1.7.1", Type: gosnmp.IPAddress, Value: "10.0.0.1"},
+	{Name: ".1.3.6.1.4.1.99.1.8.1", Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.99"},
+	{Name: ".1.3.6.1.4.1.99.1.9.1", Type: gosnmp.TimeTicks, Value: uint32(100)},
+	{Name: ".1.3.6.1.4.1.99.1.2.2", Type: gosnmp.Null, Value: nil},
+	{Name: ".1.3.6.1.4.1.99.1.3.2", Type: gosnmp.UnknownType, Value: nil},
+}
+
+func TestRecordReplay(t *testing.T) {
+	var recorded recordMIB
+	magic, err := NewSNMPMagic(&recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record bytes.Buffer
+	magic.Recorder = &record
+	if err := magic.QueryWalker(context.Background(), recordPDUs); err != nil {
+		t.Fatal(err)
+	}
+
+	var replayed recordMIB
+	magic, err = NewSNMPMagic(&replayed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := magic.Replay(&record); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(recorded, replayed) {
+		t.Errorf("replayed %+v, recorded %+v", replayed.Table[1], recorded.Table[1])
+	}
+	entry := replayed.Table[1]
+	if entry == nil || !entry.Enabled || entry.Counter != 1<<40 || entry.Level != -42 ||
+		entry.Ratio != 0.25 || entry.Address != "10.0.0.1" || entry.Ticks != 100 {
+		t.Errorf("unexpected replayed entry: %+v", entry)
+	}
+}
+
+func TestDecodeRecordedPDU(t *testing.T) {
+	testCases := []struct {
+		line     string
+		expected gosnmp.SnmpPDU
+	}{
+		{`{"Name":".1.3","Type":0,"Value":null}`, gosnmp.SnmpPDU{Name: ".1.3", Type: gosnmp.UnknownType}},
+		{`{"Name":".1.3","Type":5,"Value":null}`, gosnmp.SnmpPDU{Name: ".1.3", Type: gosnmp.Null}},
+		{`{"Name":".1.3","Type":130}`, gosnmp.SnmpPDU{Name: ".1.3", Type: gosnmp.EndOfMibView}},
+		{`{"Name":".1.3","Type":4,"Value":"eA=="}`, gosnmp.SnmpPDU{Name: ".1.3", Type: gosnmp.OctetString, Value: []byte("x")}},
+		{`{"Name":".1.3","Type":70,"Value":18446744073709551615}`, gosnmp.SnmpPDU{Name: ".1.3", Type: gosnmp.Counter64, Value: uint64(18446744073709551615)}},
+	}
+	for _, testCase := range testCases {
+		pdu, _, err := decodeRecordedPDU([]byte(testCase.line))
+		if err != nil {
+			t.Errorf("%s: %v", testCase.line, err)
+		} else if !reflect.DeepEqual(*pdu, testCase.expected) {
+			t.Errorf("%s: decoded %#v, expected %#v", testCase.line, *pdu, testCase.expected)
+		}
+	}
+
+	for _, line := range []string{
+		`{"Name":".1.3","Type":69,"Value":"x"}`,
+		`{"Name":".1.3","Type":1,"Value":"yes"}`,
+		`not json`,
+	} {
+		if _, _, err := decodeRecordedPDU([]byte(line)); err == nil {
+			t.Errorf("%s: expected an error", line)
+		}
+	}
+}
+
+func TestReplayBootTime(t *testing.T) {
+	type Entry struct {
+		LastChange time.Time `snmp:"9"`
+	}
+	type MIB struct {
+		Interface map[uint]*Entry `snmp:".1.3.6.1.2.1.2.2.1"`
+	}
+
+	var mib MIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	magic.TrackUnmapped = true
+
+	// Recorded 1000s after boot, and the interface changed 10s after boot.
+	record := `{"Name":".1.3.6.1.2.1.1.3.0","Type":67,"Value":100000,"Time":"2024-01-01T10:00:00Z"}
+{"Name":".1.3.6.1.2.1.2.2.1.9.1","Type":67,"Value":1000}
+`
+	if err := magic.Replay(strings.NewReader(record)); err != nil {
+		t.Fatal(err)
+	}
+
+	recordedAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	if !magic.RecordedAt().Equal(recordedAt) {
+		t.Errorf("unexpected record time: %v", magic.RecordedAt())
+	}
+	bootTime := recordedAt.Add(-1000 * time.Second)
+	if !magic.BootTime.Equal(bootTime) {
+		t.Errorf("unexpected boot time: %v", magic.BootTime)
+	}
+	if entry := mib.Interface[1]; entry == nil || !entry.LastChange.Equal(bootTime.Add(10*time.Second)) {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+
+	// The boot time record is not handled as a PDU, as in the recorded query.
+	if count, _ := magic.Unmapped(); magic.PDUCount() != 1 || count != 0 {
+		t.Errorf("expected a single mapped PDU, got %d PDUs and %d unmapped", magic.PDUCount(), count)
+	}
+}
+
+func TestRecordBootTime(t *testing.T) {
+	var mib recordMIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record bytes.Buffer
+	magic.Recorder = &record
+
+	receivedAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	magic.record(&gosnmp.SnmpPDU{Name: sysUpTimeOID, Type: gosnmp.TimeTicks, Value: uint32(100)}, &receivedAt)
+	magic.record(&gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.99.1.9.1", Type: gosnmp.TimeTicks, Value: uint32(100)}, nil)
+
+	expected := `{"Name":".1.3.6.1.2.1.1.3.0","Type":67,"Value":100,"Time":"2024-01-01T10:00:00Z"}
+{"Name":".1.3.6.1.4.1.99.1.9.1","Type":67,"Value":100}
+`
+	if record.String() != expected {
+		t.Errorf("recorded %q, expected %q", record.String(), expected)
+	}
+}
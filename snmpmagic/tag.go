@@ -0,0 +1,115 @@
+package snmpmagic
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Options that can follow the OID in an snmp tag, separated by commas, e.g.
+// `snmp:".1.3.6.1.2.1.2.2.1,key=-2"`.
+type TagOptions struct {
+	// Position of the map key in the OID suffix of suffix-catching fields,
+	// relative to its end (-1 is the last element).
+	MapKeyIndex int
+
+	// Name of the converter used to decode leaf values (see ConverterRegistry).
+	Converter string
+
+	// Interpretation of values of time.Time fields (see TimeUptime etc.).
+	Time string
+
+	// Multiplier applied to numeric values decoded to float fields, e.g. 0.01
+	// for values in hundredths.
+	Scale float64
+
+	// Number of elements table maps are created with, to avoid growing them
+	// one element at a time on large tables. 0 for defaultTableCapacity.
+	Capacity int
+}
+
+// Initial capacity of table maps without a cap option.
+const defaultTableCapacity = 8
+
+// Maximum capacity of table maps, so that a typo cannot make us allocate huge
+// maps.
+const maxTableCapacity = 1 << 20
+
+func DefaultTagOptions() TagOptions {
+	return TagOptions{
+		MapKeyIndex: -1,
+		Scale:       1,
+	}
+}
+
+// Splits an snmp tag into its OID and options.
+func ParseTag(tag string) (OID, TagOptions, error) {
+	options := DefaultTagOptions()
+
+	parts := strings.Split(tag, ",")
+	oid, err := ParseOID(parts[0])
+	if err != nil {
+		return nil, options, err
+	}
+
+	for _, part := range parts[1:] {
+		var key, value string
+		if eqIdx := strings.IndexByte(part, '='); eqIdx >= 0 {
+			key, value = part[:eqIdx], part[eqIdx+1:]
+		} else {
+			key = part
+		}
+
+		switch strings.TrimSpace(key) {
+		case "key":
+			index, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, options, fmt.Errorf("snmpmagic: invalid key index '%s'", value)
+			}
+			if index >= 0 {
+				return nil, options, fmt.Errorf(
+					"snmpmagic: key index must be negative (relative to OID end), got %d",
+					index,
+				)
+			}
+			options.MapKeyIndex = index
+
+		case "conv":
+			options.Converter = strings.TrimSpace(value)
+			if options.Converter == "" {
+				return nil, options, errors.New("snmpmagic: empty converter name")
+			}
+
+		case "time":
+			options.Time = strings.TrimSpace(value)
+			switch options.Time {
+			case TimeUptime, TimeUnix, TimeDateAndTime:
+			default:
+				return nil, options, fmt.Errorf(
+					"snmpmagic: unknown time interpretation '%s'", value,
+				)
+			}
+
+		case "scale":
+			scale, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || scale == 0 || math.IsInf(scale, 0) || math.IsNaN(scale) {
+				return nil, options, fmt.Errorf("snmpmagic: invalid scale '%s'", value)
+			}
+			options.Scale = scale
+
+		case "cap":
+			capacity, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || capacity <= 0 || capacity > maxTableCapacity {
+				return nil, options, fmt.Errorf("snmpmagic: invalid capacity '%s'", value)
+			}
+			options.Capacity = capacity
+
+		default:
+			return nil, options, fmt.Errorf("snmpmagic: unknown tag option '%s'", key)
+		}
+	}
+
+	return oid, options, nil
+}
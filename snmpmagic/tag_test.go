@@ -0,0 +1,90 @@
+package snmpmagic
+
+import (
+	"testing"
+)
+
+func TestParseTag(t *testing.T) {
+	withOptions := func(fn func(*TagOptions)) TagOptions {
+		options := DefaultTagOptions()
+		fn(&options)
+		return options
+	}
+
+	testCases := []struct {
+		tag      string
+		oid      string
+		expected TagOptions
+	}{
+		{".1.3.6.1.2.1.2.2.1", "1.3.6.1.2.1.2.2.1", DefaultTagOptions()},
+		{"2", "2", DefaultTagOptions()},
+		{"6.1", "6.1", DefaultTagOptions()},
+		{".1.3.6.1.4.1.99.3.1,key=-2", "1.3.6.1.4.1.99.3.1", withOptions(func(options *TagOptions) {
+			options.MapKeyIndex = -2
+		})},
+		{"5,conv=hexstring", "5", withOptions(func(options *TagOptions) {
+			options.Converter = "hexstring"
+		})},
+		{"3,time=uptime", "3", withOptions(func(options *TagOptions) { options.Time = TimeUptime })},
+		{"3,time=unix", "3", withOptions(func(options *TagOptions) { options.Time = TimeUnix })},
+		{"3,time=dateandtime", "3", withOptions(func(options *TagOptions) { options.Time = TimeDateAndTime })},
+		{"6,scale=1e-2", "6", withOptions(func(options *TagOptions) { options.Scale = 0.01 })},
+		{"6,scale=-0.5", "6", withOptions(func(options *TagOptions) { options.Scale = -0.5 })},
+		{".1.3.6.1.2.1.2.2.1,cap=512", "1.3.6.1.2.1.2.2.1", withOptions(func(options *TagOptions) {
+			options.Capacity = 512
+		})},
+		// Several options, with spaces
+		{".1.3.6.1.4.1.99.3.1, key=-3, cap=64", "1.3.6.1.4.1.99.3.1", withOptions(func(options *TagOptions) {
+			options.MapKeyIndex = -3
+			options.Capacity = 64
+		})},
+		{"7,scale=1e-3,conv=custom", "7", withOptions(func(options *TagOptions) {
+			options.Scale = 0.001
+			options.Converter = "custom"
+		})},
+	}
+	for _, testCase := range testCases {
+		oid, options, err := ParseTag(testCase.tag)
+		if err != nil {
+			t.Errorf("%s: %v", testCase.tag, err)
+			continue
+		}
+		if oid.String() != testCase.oid {
+			t.Errorf("%s: got OID %s, expected %s", testCase.tag, oid, testCase.oid)
+		}
+		if options != testCase.expected {
+			t.Errorf("%s: got options %+v, expected %+v", testCase.tag, options, testCase.expected)
+		}
+	}
+}
+
+func TestParseTagErrors(t *testing.T) {
+	for _, tag := range []string{
+		".1.3..6",
+		".1.3.x",
+		"2,",
+		"2,unknown=1",
+		"2,key",
+		"2,key=",
+		"2,key=x",
+		"2,key=0",
+		"2,key=1",
+		"2,conv",
+		"2,conv= ",
+		"2,time=",
+		"2,time=epoch",
+		"2,scale",
+		"2,scale=0",
+		"2,scale=x",
+		"2,scale=NaN",
+		"2,scale=Inf",
+		"2,cap=0",
+		"2,cap=-1",
+		"2,cap=x",
+		"2,cap=2000000",
+	} {
+		if oid, options, err := ParseTag(tag); err == nil {
+			t.Errorf("%q: expected an error, got %s and %+v", tag, oid, options)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package snmpmagic
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+import (
+	"github.com/soniah/gosnmp"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// OID of sysUpTime.0, used to convert TimeTicks to absolute times.
+var sysUpTimeOID = ".1.3.6.1.2.1.1.3.0"
+
+// Returned by decodeTime for uptime values when the boot time is unknown.
+var errUnknownBootTime = errors.New("agent boot time is unknown")
+
+// Interpretations of PDU values for time.Time fields, selected with the "time"
+// tag option. By default TimeTicks are read as uptime and OctetStrings as
+// DateAndTime.
+const (
+	// TimeTicks (or unsigned integer) since agent boot, e.g. ifLastChange.
+	TimeUptime = "uptime"
+	// Seconds since the Unix epoch.
+	TimeUnix = "unix"
+	// SNMPv2-TC DateAndTime octet string (8 or 11 bytes).
+	TimeDateAndTime = "dateandtime"
+)
+
+// Decodes a PDU into a time.Time value. bootTime is the time the agent booted,
+// needed to decode uptime values.
+func decodeTime(pdu *gosnmp.SnmpPDU, interpretation string, bootTime time.Time) (time.Time, error) {
+	if interpretation == "" {
+		switch pdu.Type {
+		case gosnmp.OctetString:
+			interpretation = TimeDateAndTime
+		default:
+			interpretation = TimeUptime
+		}
+	}
+
+	switch interpretation {
+	case TimeDateAndTime:
+		bytesVal, ok := pdu.Value.([]byte)
+		if !ok {
+			return time.Time{}, fmt.Errorf("expected DateAndTime OctetString, got %v", pdu.Type)
+		}
+		return parseDateAndTime(bytesVal)
+
+	case TimeUptime:
+		ticks, ok := toUint64(pdu.Value)
+		if !ok {
+			return time.Time{}, fmt.Errorf("expected TimeTicks, got %v", pdu.Type)
+		}
+		if bootTime.IsZero() {
+			return time.Time{}, errUnknownBootTime
+		}
+		// TimeTicks are hundredths of seconds.
+		return bootTime.Add(time.Duration(ticks) * 10 * time.Millisecond), nil
+
+	case TimeUnix:
+		seconds, ok := toInt64(pdu.Value)
+		if !ok {
+			return time.Time{}, fmt.Errorf("expected integer, got %v", pdu.Type)
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+
+	return time.Time{}, fmt.Errorf("unknown time interpretation '%s'", interpretation)
+}
+
+// Parses an SNMPv2-TC DateAndTime. Empty or all-zero values (commonly returned
+// for unknown dates) yield the zero time.
+func parseDateAndTime(b []byte) (time.Time, error) {
+	if len(b) != 8 && len(b) != 11 {
+		if len(b) == 0 {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("DateAndTime must be 8 or 11 bytes, got %d", len(b))
+	}
+
+	year := int(binary.BigEndian.Uint16(b[0:2]))
+	month, day := int(b[2]), int(b[3])
+	if year == 0 && month == 0 && day == 0 {
+		return time.Time{}, nil
+	}
+
+	loc := time.UTC
+	if len(b) == 11 {
+		offset := (int(b[9])*60 + int(b[10])) * 60
+		if b[8] == '-' {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+
+	hour, minute, second, deciSecond := int(b[4]), int(b[5]), int(b[6]), int(b[7])
+	return time.Date(
+		year, time.Month(month), day, hour, minute, second,
+		deciSecond*int(100*time.Millisecond), loc,
+	), nil
+}
@@ -3,22 +3,31 @@ package snmpmagic
 import (
 	"fmt"
 	"log"
+	"math"
+	"math/big"
+	"net"
 	"reflect"
+	"strings"
 )
 
 import (
 	"github.com/soniah/gosnmp"
 )
 
-func deserializePDUToValue(pdu *gosnmp.SnmpPDU, value reflect.Value, fieldName string) {
+// Decodes a PDU into a leaf value. Returns false if the PDU type is not
+// handled. Null PDUs, which some agents return for sensors not populated yet,
+// are handled by leaving the value as is. Exceptions for absent objects are
+// skipped by HandlePDU.
+func deserializePDUToValue(pdu *gosnmp.SnmpPDU, value reflect.Value, node *OIDTree) bool {
 	var expectedFieldType string
+	fieldName := node.fieldQualifiedName
 
-	// TODO: add a type conversion flag (possibly with per-type options)
 	switch pdu.Type {
 	case gosnmp.Integer:
-		intVal, ok := pdu.Value.(int64)
+		intVal, ok := toInt64(pdu.Value)
 		if !ok {
-			intVal = int64(pdu.Value.(int))
+			log.Printf("%s: unexpected %T value for %v", fieldName, pdu.Value, pdu.Type)
+			return true
 		}
 		switch value.Kind() {
 		case reflect.Bool:
@@ -31,10 +40,18 @@ func deserializePDUToValue(pdu *gosnmp.SnmpPDU, value reflect.Value, fieldName s
 			}
 
 		case reflect.Int, reflect.Int32, reflect.Int64:
+			if value.OverflowInt(intVal) {
+				log.Printf("%s cannot hold value %d (%v)", fieldName, intVal, value.Type())
+				break
+			}
 			value.SetInt(intVal)
+			checkEnumValue(value, fieldName)
+
+		case reflect.Float32, reflect.Float64:
+			setFloatValue(value, float64(intVal)*node.options.Scale, fieldName)
 
 		default:
-			expectedFieldType = "{int, int32, int64}"
+			expectedFieldType = "{int, int32, int64, float32, float64}"
 		}
 
 	case gosnmp.Counter32, gosnmp.Counter64:
@@ -44,9 +61,10 @@ func deserializePDUToValue(pdu *gosnmp.SnmpPDU, value reflect.Value, fieldName s
 	case gosnmp.TimeTicks:
 		fallthrough
 	case gosnmp.Uinteger32:
-		uintVal, ok := pdu.Value.(uint64)
+		uintVal, ok := toUint64(pdu.Value)
 		if !ok {
-			uintVal = uint64(pdu.Value.(uint))
+			log.Printf("%s: unexpected %T value for %v", fieldName, pdu.Value, pdu.Type)
+			return true
 		}
 		switch value.Kind() {
 		case reflect.Bool:
@@ -59,10 +77,17 @@ func deserializePDUToValue(pdu *gosnmp.SnmpPDU, value reflect.Value, fieldName s
 			}
 
 		case reflect.Uint, reflect.Uint32, reflect.Uint64:
+			if value.OverflowUint(uintVal) {
+				log.Printf("%s cannot hold value %d (%v)", fieldName, uintVal, value.Type())
+				break
+			}
 			value.SetUint(uintVal)
 
+		case reflect.Float32, reflect.Float64:
+			setFloatValue(value, float64(uintVal)*node.options.Scale, fieldName)
+
 		default:
-			expectedFieldType = "{uint, uint32, uint64}"
+			expectedFieldType = "{uint, uint32, uint64, float32, float64}"
 		}
 
 	case gosnmp.OctetString:
@@ -88,16 +113,58 @@ func deserializePDUToValue(pdu *gosnmp.SnmpPDU, value reflect.Value, fieldName s
 		if value.Kind() == reflect.String {
 			value.SetString(pdu.Value.(string))
 		} else if value.Kind() == reflect.Slice && value.Type() == reflect.TypeOf(OID{}) {
-			// FIXME: error handling + handle relative OIDs!
-			if oid, err := ParseOID(pdu.Value.(string)); err == nil {
+			if oid, err := resolveOID(pdu.Value.(string), node.absolutePath); err == nil {
 				value.Set(reflect.ValueOf(oid))
+			} else {
+				log.Printf("%s: invalid OID value '%v': %v", fieldName, pdu.Value, err)
 			}
 		} else {
 			expectedFieldType = "{snmpmagic.OID,string}"
 		}
 
+	case gosnmp.OpaqueFloat, gosnmp.OpaqueDouble:
+		floatVal, ok := toFloat64(pdu.Value)
+		if !ok {
+			log.Printf("%s: unexpected %T value for %v", fieldName, pdu.Value, pdu.Type)
+			return true
+		}
+		switch value.Kind() {
+		case reflect.Float32, reflect.Float64:
+			setFloatValue(value, floatVal*node.options.Scale, fieldName)
+
+		default:
+			expectedFieldType = "{float32, float64}"
+		}
+
+	case gosnmp.IPAddress:
+		ip, ok := toIPv4(pdu.Value)
+		if !ok {
+			log.Printf("%s: invalid IpAddress value '%v'", fieldName, pdu.Value)
+			return true
+		}
+		switch {
+		case value.Kind() == reflect.String:
+			value.SetString(ip.String())
+		case value.Type() == reflect.TypeOf(net.IP{}):
+			value.Set(reflect.ValueOf(ip))
+		case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8:
+			value.SetBytes(ip)
+		default:
+			expectedFieldType = "{string, []byte, net.IP}"
+		}
+
+	case gosnmp.Null:
+		// No value: the field is left as is.
+		return true
+
+	case gosnmp.UnknownType:
+		// Values gosnmp cannot decode, which it reports without value (e.g.
+		// BOOLEAN): not handled, but not worth a log line for each of them.
+		return false
+
 	default:
 		log.Println("UNHANDLED:", fieldName, pdu.Name, pdu.Type, reflect.TypeOf(pdu.Value))
+		return false
 	}
 
 	if expectedFieldType != "" {
@@ -108,15 +175,171 @@ func deserializePDUToValue(pdu *gosnmp.SnmpPDU, value reflect.Value, fieldName s
 			expectedFieldType,
 		)
 	}
+	return true
+}
+
+// Parses an OID value. Absolute OIDs start with a dot, as returned by gosnmp;
+// other ones are relative to the given anchor (the OID of the field).
+func resolveOID(str string, anchor OID) (OID, error) {
+	oid, err := ParseOID(str)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(str, ".") || len(oid) == 0 {
+		return oid, nil
+	}
+
+	if len(anchor) == 0 {
+		return nil, fmt.Errorf("snmpmagic: cannot resolve relative OID '%s'", str)
+	}
+
+	return append(anchor.Copy(), oid...), nil
+}
+
+// Converts a signed integer PDU value, as delivered by gosnmp depending on
+// the agent and platform.
+func toInt64(x interface{}) (int64, bool) {
+	switch v := x.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		if uint64(v) > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	case *big.Int:
+		if v != nil && v.IsInt64() {
+			return v.Int64(), true
+		}
+	}
+	return 0, false
+}
+
+// Sets a float field, unless the value does not fit in it.
+func setFloatValue(value reflect.Value, floatVal float64, fieldName string) {
+	if value.OverflowFloat(floatVal) {
+		log.Printf("%s cannot hold value %g (%v)", fieldName, floatVal, value.Type())
+		return
+	}
+	value.SetFloat(floatVal)
 }
 
-func getOrCreateMapElement(value reflect.Value, fieldQualifiedName string, path OID) (
+// Converts an Opaque float or double PDU value, decoded by gosnmp as float32
+// and float64 respectively.
+func toFloat64(x interface{}) (float64, bool) {
+	switch v := x.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// Converts an IpAddress PDU value to a 4-byte IP. gosnmp decodes them as
+// dotted strings, but raw bytes are accepted as well.
+func toIPv4(x interface{}) (net.IP, bool) {
+	switch v := x.(type) {
+	case string:
+		ip := net.ParseIP(v).To4()
+		return ip, ip != nil
+	case []byte:
+		if len(v) == net.IPv4len {
+			return net.IP(append([]byte(nil), v...)), true
+		}
+	}
+	return nil, false
+}
+
+// Converts an unsigned integer PDU value (counters, gauges, ticks), as
+// delivered by gosnmp depending on the agent and platform. Negative values
+// are clamped to zero.
+func toUint64(x interface{}) (uint64, bool) {
+	switch v := x.(type) {
+	case uint:
+		return uint64(v), true
+	case uint32:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	case int:
+		if v < 0 {
+			return 0, true
+		}
+		return uint64(v), true
+	case int64:
+		if v < 0 {
+			return 0, true
+		}
+		return uint64(v), true
+	case *big.Int:
+		if v == nil {
+			return 0, false
+		}
+		if v.Sign() < 0 {
+			return 0, true
+		}
+		if v.IsUint64() {
+			return v.Uint64(), true
+		}
+	}
+	return 0, false
+}
+
+// Implemented by integer types with a known set of named values, so that
+// values outside of that set get reported when deserializing.
+type SNMPEnum interface {
+	fmt.Stringer
+	IsKnown() bool
+}
+
+// Logs values that are not part of their enum type, if any. The value is kept
+// as-is, so that both the number and its name (via String) are available.
+func checkEnumValue(value reflect.Value, fieldName string) {
+	if !value.CanInterface() {
+		return
+	}
+
+	if enum, ok := value.Interface().(SNMPEnum); ok && !enum.IsKnown() {
+		log.Printf("%s has unknown %v value %s", fieldName, value.Type(), enum)
+	}
+}
+
+// Maximum index of slice tables, so that a bogus index cannot make us
+// allocate huge slices.
+const maxSliceTableIndex = 1 << 20
+
+// Extracts the map key at the key index of a suffix-catching node (relative to
+// the end of path) and returns the corresponding map element, creating it if
+// needed. Maps are created with room for the capacity of the node. The path
+// must start with the prefix of the node. The remainder is the path without
+// the key elements: path is compacted in place, so it must be a scratch buffer
+// (see HandlePDU).
+func getOrCreateMapElement(value reflect.Value, node *OIDTree, path OID, keys mapKeyBuffers) (
 	elem reflect.Value, remainder OID, err error,
 ) {
+	fieldQualifiedName := node.fieldQualifiedName
+	keyIndex := node.options.MapKeyIndex
+
 	valueType := value.Type()
+	if valueType.Kind() == reflect.Slice {
+		return getOrCreateSliceElement(value, node, path)
+	}
 	if valueType.Kind() != reflect.Map {
 		err = fmt.Errorf(
-			"snmpmagic: suffix-catching fields must be a map (got %v)",
+			"snmpmagic: suffix-catching fields must be a map or a slice (got %v)",
 			valueType,
 		)
 		return
@@ -140,39 +363,40 @@ func getOrCreateMapElement(value reflect.Value, fieldQualifiedName string, path
 			return
 		}
 
-		newMap := reflect.MakeMap(valueType)
-		value.Set(newMap)
+		capacity := node.options.Capacity
+		if capacity == 0 {
+			capacity = defaultTableCapacity
+		}
+		value.Set(reflect.MakeMapWithSize(valueType, capacity))
 	}
 
-	// TODO: check for custom index possibility
-	//       (if -2, then should at least have 2 elements, etc.)
-	if len(path) == 0 {
-		err = fmt.Errorf(
-			"snmpmagic: reached suffix-catching node with no path elements left",
-		)
+	keyType := valueType.Key()
+	keyArity, err := mapKeyArity(keyType)
+	if err != nil {
 		return
 	}
 
-	mapKeyIndex := len(path) - 1 // TODO: make customizable
-	mapKey := path[mapKeyIndex]
-	remainder = path[:mapKeyIndex]
-
-	var mapKeyValue reflect.Value
-	switch valueType.Key().Kind() {
-	case reflect.String:
-		mapKeyValue = reflect.ValueOf(fmt.Sprint(mapKey))
-
-	case reflect.Uint:
-		mapKeyValue = reflect.ValueOf(mapKey)
-
-	default:
+	// The key ends at keyIndex, and spans as many elements as its arity. It
+	// cannot reach into the prefix of the node (the OID of the table).
+	keyEnd := len(path) + keyIndex + 1
+	keyStart := keyEnd - keyArity
+	if keyStart < len(node.prefix) {
 		err = fmt.Errorf(
-			"snmpmagic: suffix-catching map key must be {string,uint} (got %v)",
-			valueType.Key(),
+			"snmpmagic: reached suffix-catching node with %d path elements left, "+
+				"but key has %d elements and index %d",
+			len(path)-len(node.prefix), keyArity, keyIndex,
 		)
 		return
 	}
 
+	mapKeyValue := keys.get(keyType)
+	if err = buildMapKey(mapKeyValue, path[keyStart:keyEnd]); err != nil {
+		err = fmt.Errorf("snmpmagic: map field '%s': %v", fieldQualifiedName, err)
+		return
+	}
+
+	remainder = append(path[:keyStart], path[keyEnd:]...)
+
 	// Check existence of map element, create and insert if not present.
 	mapElem := value.MapIndex(mapKeyValue)
 	if !mapElem.IsValid() || mapElem.IsNil() {
@@ -187,3 +411,174 @@ func getOrCreateMapElement(value reflect.Value, fieldQualifiedName string, path
 
 	return
 }
+
+// Same as getOrCreateMapElement for slice tables: the key is a single OID
+// element used as the slice index. The slice grows to index+1 as needed,
+// elements at missing indexes being left as zero values (nil pointers for
+// slices of pointers).
+func getOrCreateSliceElement(value reflect.Value, node *OIDTree, path OID) (
+	elem reflect.Value, remainder OID, err error,
+) {
+	fieldQualifiedName := node.fieldQualifiedName
+	keyIndex := node.options.MapKeyIndex
+
+	keyPos := len(path) + keyIndex
+	if keyPos < len(node.prefix) {
+		err = fmt.Errorf(
+			"snmpmagic: reached suffix-catching node with %d path elements left, "+
+				"but key has index %d",
+			len(path)-len(node.prefix), keyIndex,
+		)
+		return
+	}
+
+	index := path[keyPos]
+	if index > maxSliceTableIndex {
+		err = fmt.Errorf(
+			"snmpmagic: index %d of slice field '%s' is over the limit (%d)",
+			index, fieldQualifiedName, maxSliceTableIndex,
+		)
+		return
+	}
+
+	remainder = append(path[:keyPos], path[keyPos+1:]...)
+
+	if int(index) >= value.Len() {
+		if !value.CanSet() {
+			err = fmt.Errorf(
+				"snmpmagic: cannot set value of field '%s'",
+				fieldQualifiedName,
+			)
+			return
+		}
+
+		growth := reflect.MakeSlice(value.Type(), int(index)+1-value.Len(), int(index)+1-value.Len())
+		value.Set(reflect.AppendSlice(value, growth))
+	}
+
+	elem = value.Index(int(index))
+	if elem.Kind() == reflect.Ptr {
+		if elem.IsNil() {
+			elem.Set(reflect.New(elem.Type().Elem()))
+		}
+		elem = elem.Elem()
+	}
+
+	return
+}
+
+// Returns whether a type is a struct (other than time.Time) or a pointer to
+// one, i.e. can be the element of a table.
+func isStructOrStructPtr(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType
+}
+
+// Returns the number of OID elements needed to build a map key of the given
+// type: 1 for strings and integers, or one per element for arrays and
+// structs of integers (multi-dimensional table indexes).
+func mapKeyArity(keyType reflect.Type) (int, error) {
+	switch keyType.Kind() {
+	case reflect.String:
+		return 1, nil
+
+	case reflect.Array:
+		if isIntegerKind(keyType.Elem().Kind()) {
+			return keyType.Len(), nil
+		}
+
+	case reflect.Struct:
+		for i := 0; i < keyType.NumField(); i++ {
+			if !isIntegerKind(keyType.Field(i).Type.Kind()) {
+				return 0, fmt.Errorf(
+					"snmpmagic: suffix-catching map key fields must be integers (got %v)",
+					keyType,
+				)
+			}
+		}
+		return keyType.NumField(), nil
+
+	default:
+		if isIntegerKind(keyType.Kind()) {
+			return 1, nil
+		}
+	}
+
+	return 0, fmt.Errorf(
+		"snmpmagic: suffix-catching map key must be a string, an integer, "+
+			"or an array/struct of integers (got %v)",
+		keyType,
+	)
+}
+
+// Settable map keys by type, reused across PDUs rather than allocating a key
+// for each of them: maps store a copy of keys.
+type mapKeyBuffers map[reflect.Type]reflect.Value
+
+func (self mapKeyBuffers) get(keyType reflect.Type) reflect.Value {
+	key, ok := self[keyType]
+	if !ok {
+		key = reflect.New(keyType).Elem()
+		self[keyType] = key
+	}
+	return key
+}
+
+// Sets a map key from OID elements. The number of elements must match the
+// arity of the key type (see mapKeyArity). Fails if an element overflows its
+// part of the key, rather than mapping different indexes to the same entry.
+func buildMapKey(key reflect.Value, elems OID) error {
+	switch key.Kind() {
+	case reflect.String:
+		key.SetString(fmt.Sprint(elems[0]))
+
+	case reflect.Array:
+		for i, elem := range elems {
+			if err := setInteger(key.Index(i), elem); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Struct:
+		for i, elem := range elems {
+			if err := setInteger(key.Field(i), elem); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return setInteger(key, elems[0])
+	}
+	return nil
+}
+
+func isIntegerKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func isFloatKind(kind reflect.Kind) bool {
+	return kind == reflect.Float32 || kind == reflect.Float64
+}
+
+func setInteger(value reflect.Value, x uint) error {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if uint64(x) > math.MaxInt64 || value.OverflowInt(int64(x)) {
+			return fmt.Errorf("%v cannot hold index %d", value.Type(), x)
+		}
+		value.SetInt(int64(x))
+	default:
+		if value.OverflowUint(uint64(x)) {
+			return fmt.Errorf("%v cannot hold index %d", value.Type(), x)
+		}
+		value.SetUint(uint64(x))
+	}
+	return nil
+}
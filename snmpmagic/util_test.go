@@ -0,0 +1,510 @@
+package snmpmagic
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/soniah/gosnmp"
+)
+
+// Tables indexed by several OID elements, e.g. LLDP-MIB's
+// lldpRemTable (timeMark.localPort.index), or by one at a given position.
+type multiIndexKey struct {
+	TimeMark  uint
+	LocalPort uint
+	Index     uint
+}
+
+type multiIndexEntry struct {
+	ChassisID string `snmp:"5"`
+	PortID    string `snmp:"7"`
+}
+
+type laneKeyEntry struct {
+	RxPower int `snmp:"3.1"`
+	TxPower int `snmp:"4.1"`
+}
+
+type multiIndexMIB struct {
+	ByStruct map[multiIndexKey]*multiIndexEntry `snmp:".1.0.8802.1.1.2.1.4.1.1"`
+	ByArray  map[[3]uint8]*multiIndexEntry      `snmp:".1.3.6.1.4.1.99.1.1"`
+	ByString map[string]*multiIndexEntry        `snmp:".1.3.6.1.4.1.99.2.1"`
+	ByPort   map[uint]*laneKeyEntry             `snmp:".1.3.6.1.4.1.99.3.1,key=-2"`
+}
+
+func TestMultiIndexMapKeys(t *testing.T) {
+	var mib multiIndexMIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pdus := PDUSlice{
+		{Name: ".1.0.8802.1.1.2.1.4.1.1.5.0.12.1", Type: gosnmp.OctetString, Value: []byte("chassis-a")},
+		{Name: ".1.0.8802.1.1.2.1.4.1.1.5.0.12.2", Type: gosnmp.OctetString, Value: []byte("chassis-b")},
+		{Name: ".1.0.8802.1.1.2.1.4.1.1.7.0.12.1", Type: gosnmp.OctetString, Value: []byte("Ethernet1")},
+		{Name: ".1.3.6.1.4.1.99.1.1.5.10.0.1", Type: gosnmp.OctetString, Value: []byte("array")},
+		{Name: ".1.3.6.1.4.1.99.2.1.7.42", Type: gosnmp.OctetString, Value: []byte("string")},
+		// Column, port, then lane: the key is the port, before the lane.
+		{Name: ".1.3.6.1.4.1.99.3.1.3.7.1", Type: gosnmp.Integer, Value: -40},
+		{Name: ".1.3.6.1.4.1.99.3.1.4.7.1", Type: gosnmp.Integer, Value: -25},
+		{Name: ".1.3.6.1.4.1.99.3.1.3.7.2", Type: gosnmp.Integer, Value: -41},
+	}
+	if err := magic.QueryWalker(context.Background(), pdus); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mib.ByStruct) != 2 {
+		t.Fatalf("expected 2 struct-keyed entries, got %v", mib.ByStruct)
+	}
+	entry := mib.ByStruct[multiIndexKey{TimeMark: 0, LocalPort: 12, Index: 1}]
+	if entry == nil || entry.ChassisID != "chassis-a" || entry.PortID != "Ethernet1" {
+		t.Errorf("unexpected entry 0.12.1: %+v", entry)
+	}
+	if entry := mib.ByStruct[multiIndexKey{0, 12, 2}]; entry == nil || entry.ChassisID != "chassis-b" {
+		t.Errorf("unexpected entry 0.12.2: %+v", entry)
+	}
+
+	if entry := mib.ByArray[[3]uint8{10, 0, 1}]; entry == nil || entry.ChassisID != "array" {
+		t.Errorf("unexpected array-keyed entries: %v", mib.ByArray)
+	}
+	if entry := mib.ByString["42"]; entry == nil || entry.PortID != "string" {
+		t.Errorf("unexpected string-keyed entries: %v", mib.ByString)
+	}
+
+	// The lane 2 PDU matches no leaf once the port is taken out.
+	if len(mib.ByPort) != 1 || mib.ByPort[7] == nil {
+		t.Fatalf("expected a single entry for port 7, got %v", mib.ByPort)
+	}
+	if port := mib.ByPort[7]; port.RxPower != -40 || port.TxPower != -25 {
+		t.Errorf("unexpected entry of port 7: %+v", port)
+	}
+}
+
+func TestMultiIndexMapKeyTooShort(t *testing.T) {
+	var mib multiIndexMIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only two elements after the table OID for a key of three, and an OID
+	// next to a table rather than under it: keys must not be taken from the
+	// table OID.
+	pdus := []gosnmp.SnmpPDU{
+		{Name: ".1.0.8802.1.1.2.1.4.1.1.5.12", Type: gosnmp.OctetString, Value: []byte("x")},
+		{Name: ".1.3.6.1.4.1.99.1.2.5.10.0.1", Type: gosnmp.OctetString, Value: []byte("x")},
+	}
+	for _, pdu := range pdus {
+		if err := magic.HandlePDU(pdu); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(mib.ByStruct) != 0 || len(mib.ByArray) != 0 {
+		t.Errorf("expected no entry, got %v and %v", mib.ByStruct, mib.ByArray)
+	}
+}
+
+func TestInvalidMapKeyType(t *testing.T) {
+	type Entry struct {
+		Value uint `snmp:"1"`
+	}
+	type MIB struct {
+		Table map[float64]*Entry `snmp:".1.3.6.1.4.1.99.1"`
+	}
+
+	if _, err := BuildOIDTree(&MIB{}); err == nil {
+		t.Error("expected an error for a float map key")
+	}
+}
+
+// Returns what fn logs.
+func captureLog(fn func()) string {
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+
+	fn()
+	return output.String()
+}
+
+func TestNullAndUnknownTypePDUs(t *testing.T) {
+	type Entry struct {
+		Present bool    `snmp:"1"`
+		Power   float32 `snmp:"2"`
+	}
+	type MIB struct {
+		Table map[uint]*Entry `snmp:".1.3.6.1.4.1.99.1"`
+	}
+
+	var mib MIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	magic.TrackUnmapped = true
+
+	// BOOLEAN values are returned by gosnmp as UnknownType, without value.
+	pdus := PDUSlice{
+		{Name: ".1.3.6.1.4.1.99.1.1.1", Type: gosnmp.Integer, Value: 1},
+		{Name: ".1.3.6.1.4.1.99.1.1.1", Type: gosnmp.UnknownType, Value: nil},
+		{Name: ".1.3.6.1.4.1.99.1.2.1", Type: gosnmp.Null, Value: nil},
+		{Name: ".1.3.6.1.4.1.99.1.2.2", Type: gosnmp.OpaqueFloat, Value: float32(-2.5)},
+		{Name: ".1.3.6.1.4.1.99.1.2.2", Type: gosnmp.Null, Value: nil},
+	}
+	output := captureLog(func() {
+		if err := magic.QueryWalker(context.Background(), pdus); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if output != "" {
+		t.Errorf("expected no log output, got %q", output)
+	}
+	if count, sample := magic.Unmapped(); count != 1 || sample[0].Type != gosnmp.UnknownType {
+		t.Errorf("expected the UnknownType PDU to be unmapped, got %v", sample)
+	}
+	// Null and UnknownType leave the value decoded before as is.
+	if entry := mib.Table[1]; entry == nil || !entry.Present || entry.Power != 0 {
+		t.Errorf("unexpected entry 1: %+v", entry)
+	}
+	if entry := mib.Table[2]; entry == nil || entry.Present || entry.Power != -2.5 {
+		t.Errorf("unexpected entry 2: %+v", entry)
+	}
+}
+
+func TestExceptionPDUsAreSilent(t *testing.T) {
+	var mib benchMIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	magic.TrackUnmapped = true
+
+	for _, pduType := range []gosnmp.Asn1BER{gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView} {
+		output := captureLog(func() {
+			pdus := PDUSlice{{Name: ".1.3.6.1.2.1.2.2.1.2.1", Type: pduType}}
+			if err := magic.HandlePDU(pdus[0]); err != nil {
+				t.Fatal(err)
+			}
+
+			// Walks stop on them without error
+			magic.Reset()
+			if err := magic.QueryWalker(context.Background(), pdus); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		if output != "" {
+			t.Errorf("%v: expected no log output, got %q", pduType, output)
+		}
+		if count, _ := magic.Unmapped(); count != 0 || len(mib.Interface) != 0 {
+			t.Errorf("%v: expected the PDU to be ignored, got %d unmapped and %v", pduType, count, mib.Interface)
+		}
+	}
+}
+
+func TestToInt64(t *testing.T) {
+	testCases := []struct {
+		value    interface{}
+		expected int64
+		ok       bool
+	}{
+		{-42, -42, true},
+		{int32(-42), -42, true},
+		{uint32(math.MaxUint32), math.MaxUint32, true},
+		{uint64(math.MaxInt64), math.MaxInt64, true},
+		{big.NewInt(-42), -42, true},
+		// Values above MaxInt64 must not wrap to negative ones
+		{uint64(math.MaxInt64) + 1, 0, false},
+		{uint64(math.MaxUint64), 0, false},
+		{new(big.Int).Lsh(big.NewInt(1), 64), 0, false},
+		{"42", 0, false},
+	}
+	for _, testCase := range testCases {
+		value, ok := toInt64(testCase.value)
+		if value != testCase.expected || ok != testCase.ok {
+			t.Errorf(
+				"toInt64(%v) = %d, %v, expected %d, %v",
+				testCase.value, value, ok, testCase.expected, testCase.ok,
+			)
+		}
+	}
+}
+
+func TestUnsignedOverflow(t *testing.T) {
+	type Entry struct {
+		Octets uint32 `snmp:"1"`
+	}
+	type MIB struct {
+		Table  map[uint]*Entry     `snmp:".1.3.6.1.4.1.99.1"`
+		Lanes  map[[2]uint8]*Entry `snmp:".1.3.6.1.4.1.99.2"`
+		Signed map[int8]*Entry     `snmp:".1.3.6.1.4.1.99.3"`
+	}
+
+	var mib MIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		pdu    gosnmp.SnmpPDU
+		logged string
+	}{
+		{
+			gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.99.1.1.1", Type: gosnmp.Counter64, Value: uint64(1) << 32},
+			"Entry.Octets cannot hold value 4294967296 (uint32)",
+		},
+		{
+			gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.99.2.1.1.256", Type: gosnmp.Counter32, Value: uint(1)},
+			"uint8 cannot hold index 256",
+		},
+		{
+			gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.99.3.1.128", Type: gosnmp.Counter32, Value: uint(1)},
+			"int8 cannot hold index 128",
+		},
+	}
+	for _, testCase := range testCases {
+		output := captureLog(func() {
+			if err := magic.HandlePDU(testCase.pdu); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if !strings.Contains(output, testCase.logged) {
+			t.Errorf("%s: expected %q to be logged, got %q", testCase.pdu.Name, testCase.logged, output)
+		}
+	}
+
+	// Overflowing values are left as is, and overflowing indexes do not wrap
+	// around to other entries.
+	if entry := mib.Table[1]; entry == nil || entry.Octets != 0 {
+		t.Errorf("unexpected entry 1: %+v", entry)
+	}
+	if len(mib.Lanes) != 0 || len(mib.Signed) != 0 {
+		t.Errorf("expected no entry, got %v and %v", mib.Lanes, mib.Signed)
+	}
+
+	// The largest values still fit.
+	magic.HandlePDU(gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.99.1.1.1", Type: gosnmp.Counter32, Value: uint(math.MaxUint32)})
+	magic.HandlePDU(gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.99.2.1.1.255", Type: gosnmp.Counter32, Value: uint(1)})
+	if mib.Table[1].Octets != math.MaxUint32 || mib.Lanes[[2]uint8{1, 255}] == nil {
+		t.Errorf("unexpected entries: %+v and %v", mib.Table[1], mib.Lanes)
+	}
+}
+
+func TestSliceTables(t *testing.T) {
+	type Entry struct {
+		Descr string `snmp:"2"`
+		Speed uint   `snmp:"5"`
+	}
+	type MIB struct {
+		ByPointer []*Entry `snmp:".1.3.6.1.2.1.2.2.1"`
+		ByValue   []Entry  `snmp:".1.3.6.1.4.1.99.1"`
+	}
+
+	var mib MIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sparse ifIndexes, not in order
+	pdus := PDUSlice{
+		{Name: ".1.3.6.1.2.1.2.2.1.2.5", Type: gosnmp.OctetString, Value: []byte("Ethernet5")},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.2", Type: gosnmp.OctetString, Value: []byte("Ethernet2")},
+		{Name: ".1.3.6.1.2.1.2.2.1.5.5", Type: gosnmp.Gauge32, Value: uint(100000000000)},
+		{Name: ".1.3.6.1.4.1.99.1.2.3", Type: gosnmp.OctetString, Value: []byte("Ethernet3")},
+	}
+	if err := magic.QueryWalker(context.Background(), pdus); err != nil {
+		t.Fatal(err)
+	}
+
+	// Slices grow to the highest index + 1, leaving gaps as zero values.
+	if len(mib.ByPointer) != 6 {
+		t.Fatalf("expected 6 elements, got %d", len(mib.ByPointer))
+	}
+	for i, entry := range mib.ByPointer {
+		switch i {
+		case 2:
+			if entry == nil || entry.Descr != "Ethernet2" || entry.Speed != 0 {
+				t.Errorf("unexpected entry 2: %+v", entry)
+			}
+		case 5:
+			if entry == nil || entry.Descr != "Ethernet5" || entry.Speed != 100000000000 {
+				t.Errorf("unexpected entry 5: %+v", entry)
+			}
+		default:
+			if entry != nil {
+				t.Errorf("expected no entry %d, got %+v", i, entry)
+			}
+		}
+	}
+	if len(mib.ByValue) != 4 || mib.ByValue[3].Descr != "Ethernet3" || mib.ByValue[0] != (Entry{}) {
+		t.Errorf("unexpected value entries: %+v", mib.ByValue)
+	}
+
+	// Indexes over the limit are rejected rather than allocating huge slices.
+	output := captureLog(func() {
+		magic.HandlePDU(gosnmp.SnmpPDU{
+			Name: fmt.Sprintf(".1.3.6.1.2.1.2.2.1.2.%d", maxSliceTableIndex+1), Type: gosnmp.OctetString, Value: []byte("x"),
+		})
+	})
+	if !strings.Contains(output, "is over the limit") || len(mib.ByPointer) != 6 {
+		t.Errorf("expected the index to be rejected, got %d elements and %q", len(mib.ByPointer), output)
+	}
+}
+
+func TestIPAddressPDUs(t *testing.T) {
+	type Entry struct {
+		Address string `snmp:"1"`
+		Bytes   []byte `snmp:"2"`
+		IP      net.IP `snmp:"3"`
+		Index   uint   `snmp:"4"`
+	}
+	type MIB struct {
+		Table map[uint]*Entry `snmp:".1.3.6.1.2.1.4.20.1"`
+	}
+
+	var mib MIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// gosnmp decodes IpAddress values as dotted strings, recordings may have
+	// the 4 raw bytes.
+	pdus := PDUSlice{
+		{Name: ".1.3.6.1.2.1.4.20.1.1.1", Type: gosnmp.IPAddress, Value: "10.0.0.1"},
+		{Name: ".1.3.6.1.2.1.4.20.1.2.1", Type: gosnmp.IPAddress, Value: []byte{10, 0, 0, 2}},
+		{Name: ".1.3.6.1.2.1.4.20.1.3.1", Type: gosnmp.IPAddress, Value: "192.0.2.1"},
+		{Name: ".1.3.6.1.2.1.4.20.1.1.2", Type: gosnmp.IPAddress, Value: []byte{192, 0, 2, 255}},
+	}
+	output := captureLog(func() {
+		if err := magic.QueryWalker(context.Background(), pdus); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if output != "" {
+		t.Errorf("expected no log output, got %q", output)
+	}
+
+	entry := mib.Table[1]
+	if entry == nil || entry.Address != "10.0.0.1" || !bytes.Equal(entry.Bytes, []byte{10, 0, 0, 2}) ||
+		!entry.IP.Equal(net.IPv4(192, 0, 2, 1)) {
+		t.Errorf("unexpected entry 1: %+v", entry)
+	}
+	if entry := mib.Table[2]; entry == nil || entry.Address != "192.0.2.255" {
+		t.Errorf("unexpected entry 2: %+v", entry)
+	}
+
+	testCases := []struct {
+		pdu    gosnmp.SnmpPDU
+		logged string
+	}{
+		{
+			gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.4.20.1.1.3", Type: gosnmp.IPAddress, Value: "2001:db8::1"},
+			"Entry.Address: invalid IpAddress value '2001:db8::1'",
+		},
+		{
+			gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.4.20.1.1.3", Type: gosnmp.IPAddress, Value: []byte{10, 0, 0}},
+			"Entry.Address: invalid IpAddress value",
+		},
+		{
+			gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.4.20.1.4.3", Type: gosnmp.IPAddress, Value: "10.0.0.3"},
+			"Entry.Index is uint but should be {string, []byte, net.IP}",
+		},
+	}
+	for _, testCase := range testCases {
+		output := captureLog(func() {
+			if err := magic.HandlePDU(testCase.pdu); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if !strings.Contains(output, testCase.logged) {
+			t.Errorf("%v: expected %q to be logged, got %q", testCase.pdu.Value, testCase.logged, output)
+		}
+	}
+	if entry := mib.Table[3]; entry != nil && (entry.Address != "" || entry.Index != 0) {
+		t.Errorf("expected entry 3 to be left unset, got %+v", entry)
+	}
+}
+
+func TestOpaqueFloatPDUs(t *testing.T) {
+	type Entry struct {
+		Power      float32 `snmp:"1"`
+		Precise    float64 `snmp:"2"`
+		Scaled     float64 `snmp:"3,scale=1e-3"`
+		Count      uint    `snmp:"4"`
+		Overflowed float32 `snmp:"5"`
+	}
+	type MIB struct {
+		Table map[uint]*Entry `snmp:".1.3.6.1.4.1.99.1"`
+	}
+
+	var mib MIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pdus := PDUSlice{
+		{Name: ".1.3.6.1.4.1.99.1.1.1", Type: gosnmp.OpaqueFloat, Value: float32(-2.25)},
+		{Name: ".1.3.6.1.4.1.99.1.2.1", Type: gosnmp.OpaqueDouble, Value: float64(0.000123456789)},
+		// Widths are independent of the field's
+		{Name: ".1.3.6.1.4.1.99.1.1.2", Type: gosnmp.OpaqueDouble, Value: float64(-7.5)},
+		{Name: ".1.3.6.1.4.1.99.1.2.2", Type: gosnmp.OpaqueFloat, Value: float32(1.5)},
+		{Name: ".1.3.6.1.4.1.99.1.3.1", Type: gosnmp.OpaqueFloat, Value: float32(2500)},
+	}
+	output := captureLog(func() {
+		if err := magic.QueryWalker(context.Background(), pdus); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if output != "" {
+		t.Errorf("expected no log output, got %q", output)
+	}
+
+	if entry := mib.Table[1]; entry == nil || entry.Power != -2.25 || entry.Precise != 0.000123456789 || entry.Scaled != 2.5 {
+		t.Errorf("unexpected entry 1: %+v", entry)
+	}
+	if entry := mib.Table[2]; entry == nil || entry.Power != -7.5 || entry.Precise != 1.5 {
+		t.Errorf("unexpected entry 2: %+v", entry)
+	}
+
+	testCases := []struct {
+		pdu    gosnmp.SnmpPDU
+		logged string
+	}{
+		{
+			gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.99.1.4.3", Type: gosnmp.OpaqueFloat, Value: float32(1)},
+			"Entry.Count is uint but should be {float32, float64}",
+		},
+		{
+			gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.99.1.1.3", Type: gosnmp.OpaqueDouble, Value: "1.5"},
+			"Entry.Power: unexpected string value for OpaqueDouble",
+		},
+		{
+			gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.99.1.5.3", Type: gosnmp.OpaqueDouble, Value: math.MaxFloat64},
+			"Entry.Overflowed cannot hold value",
+		},
+	}
+	for _, testCase := range testCases {
+		output := captureLog(func() {
+			if err := magic.HandlePDU(testCase.pdu); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if !strings.Contains(output, testCase.logged) {
+			t.Errorf("%s: expected %q to be logged, got %q", testCase.pdu.Name, testCase.logged, output)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package snmpmagic
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// Issue found in a MIB definition, for a given field.
+type FieldError struct {
+	// Field path from the top-level type, e.g. "OpticsMIB.Interface.Descr".
+	Field string
+	Err   error
+}
+
+func (self *FieldError) Error() string {
+	return fmt.Sprintf("%s: %v", self.Field, self.Err)
+}
+
+// Tagged field found while validating a MIB definition.
+type mibField struct {
+	name string
+	path OID
+	// Struct fields contain other fields without shadowing them.
+	isStruct bool
+}
+
+// Checks a MIB definition (a struct or pointer to struct) for mistakes that
+// BuildOIDTree lets through, and which would result in missing data:
+//   - invalid tags
+//   - fields whose OID is the same as, or under, the OID of a leaf or table
+//   - table fields with an unsupported key or element type
+//   - leaf fields of a kind that PDUs cannot be decoded to
+//   - absolute tags below the top level, which are relative in practice
+//   - scale or cap options on fields they do not apply to
+//
+// Returns all issues found, as *FieldError, or nil if there are none.
+func ValidateMIBType(x interface{}) []error {
+	t := reflect.TypeOf(x)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return []error{fmt.Errorf("snmpmagic: MIB must be a struct (got %T)", x)}
+	}
+
+	var errs []error
+	var fields []mibField
+	validateStruct(t, nil, t.Name(), &fields, &errs)
+
+	for i, a := range fields {
+		for _, b := range fields[i+1:] {
+			if err := checkOverlap(a, b); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errs
+}
+
+func validateStruct(t reflect.Type, prefix OID, parentName string, fields *[]mibField, errs *[]error) {
+	addError := func(name string, err error) {
+		*errs = append(*errs, &FieldError{Field: name, Err: err})
+	}
+
+	for fieldIndex := 0; fieldIndex < t.NumField(); fieldIndex++ {
+		field := t.Field(fieldIndex)
+		name := parentName + "." + field.Name
+
+		snmpTag := field.Tag.Get("snmp")
+		if snmpTag == "" {
+			continue
+		}
+		if strings.IndexFunc(field.Name, unicode.IsLower) == 0 {
+			addError(name, errors.New("field has an snmp tag but is unexported"))
+			continue
+		}
+
+		tagOid, options, err := ParseTag(snmpTag)
+		if err != nil {
+			addError(name, err)
+			continue
+		}
+		if snmpTag[0] == '.' && len(prefix) > 0 {
+			addError(name, fmt.Errorf(
+				"absolute tag '%s' below the top level is relative to %s", snmpTag, prefix,
+			))
+		}
+
+		path := append(prefix.Copy(), tagOid...)
+		fieldType := field.Type
+		if options.Capacity != 0 && fieldType.Kind() != reflect.Map {
+			addError(name, fmt.Errorf("cap can only be used with map tables (got %v)", fieldType))
+		}
+		switch kind := fieldType.Kind(); {
+		case kind == reflect.Struct && fieldType != timeType:
+			*fields = append(*fields, mibField{name, path, true})
+			validateStruct(fieldType, path, name, fields, errs)
+
+		case kind == reflect.Ptr && isStructOrStructPtr(fieldType):
+			*fields = append(*fields, mibField{name, path, true})
+			validateStruct(fieldType.Elem(), path, name, fields, errs)
+
+		case kind == reflect.Slice && isStructOrStructPtr(fieldType.Elem()):
+			*fields = append(*fields, mibField{name, path, false})
+			elemType := fieldType.Elem()
+			if elemType.Kind() == reflect.Ptr {
+				elemType = elemType.Elem()
+			}
+			validateStruct(elemType, path, name, fields, errs)
+
+		case kind == reflect.Map:
+			*fields = append(*fields, mibField{name, path, false})
+			if _, err := mapKeyArity(fieldType.Key()); err != nil {
+				addError(name, err)
+			}
+			if !isStructOrStructPtr(fieldType.Elem()) || fieldType.Elem().Kind() != reflect.Ptr {
+				addError(name, fmt.Errorf(
+					"table map element must be a struct pointer (got %v)", fieldType.Elem(),
+				))
+				continue
+			}
+			validateStruct(fieldType.Elem().Elem(), path, name, fields, errs)
+
+		default:
+			*fields = append(*fields, mibField{name, path, false})
+			// Custom converters may decode to any type.
+			if options.Converter == "" && !isSupportedLeafType(fieldType) {
+				addError(name, fmt.Errorf("unsupported field type %v", fieldType))
+			}
+			if options.Scale != 1 && !isFloatKind(kind) {
+				addError(name, fmt.Errorf("scale can only be used with float fields (got %v)", fieldType))
+			}
+		}
+	}
+}
+
+// Returns an error if one of the fields shadows the other, i.e. has the same
+// OID, or is a leaf or table with the OID of the other under its own.
+func checkOverlap(a, b mibField) error {
+	if len(a.path) > len(b.path) {
+		a, b = b, a
+	}
+	if !b.path.HasPrefix(a.path) {
+		return nil
+	}
+
+	if oidEqual(a.path, b.path) {
+		return &FieldError{Field: b.name, Err: fmt.Errorf(
+			"OID %s is also used by %s", b.path, a.name,
+		)}
+	}
+	if !a.isStruct && !strings.HasPrefix(b.name, a.name+".") {
+		return &FieldError{Field: b.name, Err: fmt.Errorf(
+			"OID %s is under the OID of %s (%s)", b.path, a.name, a.path,
+		)}
+	}
+	return nil
+}
+
+// Returns whether PDUs can be decoded to fields of a given type.
+func isSupportedLeafType(t reflect.Type) bool {
+	if t == timeType || t == reflect.TypeOf(OID{}) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	}
+	return false
+}
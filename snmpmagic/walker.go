@@ -0,0 +1,102 @@
+package snmpmagic
+
+import (
+	"log"
+)
+
+import (
+	"github.com/soniah/gosnmp"
+)
+
+// Source of the PDUs of a subtree, walked by Query.
+type Walker interface {
+	// Calls walkFn for each PDU under the root OID, in order, stopping at the
+	// first error.
+	Walk(root string, walkFn gosnmp.WalkFunc) error
+}
+
+// Walker querying an agent through a connected gosnmp client.
+type ClientWalker struct {
+	Client *gosnmp.GoSNMP
+	Mode   WalkMode
+}
+
+func (self *ClientWalker) Walk(root string, walkFn gosnmp.WalkFunc) error {
+	switch self.Mode {
+	case WalkNext:
+		return self.Client.Walk(root, walkFn)
+
+	case WalkAuto:
+		return walkWithFallback(root, self.Client.BulkWalk, self.Client.Walk, walkFn, self.Client.Target)
+	}
+
+	return self.Client.BulkWalk(root, walkFn)
+}
+
+// Walks a root with bulkWalk, and again with walk if it fails. PDUs received
+// before the failure are skipped by the second walk, so that they are only
+// handled (hence counted toward MaxPDUs, and recorded) once.
+func walkWithFallback(
+	root string,
+	bulkWalk, walk func(string, gosnmp.WalkFunc) error,
+	walkFn gosnmp.WalkFunc,
+	target string,
+) error {
+	lastName := ""
+	err := bulkWalk(root, func(pdu gosnmp.SnmpPDU) error {
+		if err := walkFn(pdu); err != nil {
+			return err
+		}
+		lastName = pdu.Name
+		return nil
+	})
+	if err == nil || err == errEndOfWalk || err == ErrTooManyPDUs {
+		return err
+	}
+
+	log.Printf(
+		"WARNING: bulk walk of %s on %s failed (%v), retrying with GETNEXT",
+		root, target, err,
+	)
+
+	var last OID
+	if lastName != "" {
+		last, _ = ParseOID(lastName)
+	}
+	return walk(root, func(pdu gosnmp.SnmpPDU) error {
+		if last != nil {
+			if oid, err := ParseOID(pdu.Name); err == nil && oid.Compare(last) <= 0 {
+				return nil
+			}
+			last = nil
+		}
+		return walkFn(pdu)
+	})
+}
+
+// Walker over a fixed list of PDUs, e.g. to test deserialization without an
+// agent.
+type PDUSlice []gosnmp.SnmpPDU
+
+func (self PDUSlice) Walk(root string, walkFn gosnmp.WalkFunc) error {
+	rootOid, err := ParseOID(root)
+	if err != nil {
+		return err
+	}
+
+	for _, pdu := range self {
+		path, err := ParseOID(pdu.Name)
+		if err != nil {
+			return err
+		}
+		if !path.HasPrefix(rootOid) {
+			continue
+		}
+
+		if err := walkFn(pdu); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package snmpmagic
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/soniah/gosnmp"
+)
+
+func TestPDUSliceWalk(t *testing.T) {
+	pdus := PDUSlice{
+		{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: []byte("switch1")},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.1", Type: gosnmp.OctetString, Value: []byte("Ethernet1")},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.2", Type: gosnmp.OctetString, Value: []byte("Ethernet2")},
+		// Not under the interface table, despite the common string prefix
+		{Name: ".1.3.6.1.2.1.2.2.10.1", Type: gosnmp.Integer, Value: 1},
+		{Name: ".1.3.6.1.2.1.2.2.1.5.1", Type: gosnmp.Gauge32, Value: uint(1000000000)},
+	}
+
+	var walked []string
+	err := pdus.Walk(".1.3.6.1.2.1.2.2.1", func(pdu gosnmp.SnmpPDU) error {
+		walked = append(walked, pdu.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{".1.3.6.1.2.1.2.2.1.2.1", ".1.3.6.1.2.1.2.2.1.2.2", ".1.3.6.1.2.1.2.2.1.5.1"}
+	if strings.Join(walked, " ") != strings.Join(expected, " ") {
+		t.Errorf("walked %v, expected %v", walked, expected)
+	}
+
+	// Walks stop at the first error
+	errStop := errors.New("stop")
+	walked = nil
+	err = pdus.Walk(".1.3.6.1.2.1", func(pdu gosnmp.SnmpPDU) error {
+		walked = append(walked, pdu.Name)
+		if len(walked) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop || len(walked) != 2 {
+		t.Errorf("expected the walk to stop after 2 PDUs, got %v after %v", err, walked)
+	}
+
+	if err := pdus.Walk(".1.3.x", func(gosnmp.SnmpPDU) error { return nil }); err == nil {
+		t.Error("expected an error for an invalid root")
+	}
+	invalid := PDUSlice{{Name: ".1.3..6", Type: gosnmp.Integer, Value: 1}}
+	if err := invalid.Walk(".1.3", func(gosnmp.SnmpPDU) error { return nil }); err == nil {
+		t.Error("expected an error for an invalid PDU name")
+	}
+}
+
+// Walker failing the walks of some roots, after walking their PDUs.
+type failingWalker struct {
+	pdus     PDUSlice
+	failures map[string]error
+	walked   []string
+}
+
+func (self *failingWalker) Walk(root string, walkFn gosnmp.WalkFunc) error {
+	self.walked = append(self.walked, root)
+	if err := self.pdus.Walk(root, walkFn); err != nil {
+		return err
+	}
+	return self.failures[root]
+}
+
+type walkerMIB struct {
+	System struct {
+		Name string `snmp:"5"`
+	} `snmp:".1.3.6.1.2.1.1"`
+	Interface map[uint]*benchInterfaceEntry `snmp:".1.3.6.1.2.1.2.2.1"`
+}
+
+func TestQueryWalkerRootFailures(t *testing.T) {
+	var mib walkerMIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errTimeout := errors.New("request timeout")
+	walker := &failingWalker{
+		pdus: PDUSlice{
+			{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: []byte("switch1")},
+			{Name: ".1.3.6.1.2.1.2.2.1.2.1", Type: gosnmp.OctetString, Value: []byte("Ethernet1")},
+		},
+		failures: map[string]error{"1.3.6.1.2.1.2.2.1": errTimeout},
+	}
+	err = magic.QueryWalker(context.Background(), walker)
+
+	// Data of the other roots, and walked before the failure, is kept.
+	var queryErr *QueryError
+	if !errors.As(err, &queryErr) || queryErr.RootCount != 2 || len(queryErr.Failures) != 1 ||
+		queryErr.Failures[0].Err != errTimeout {
+		t.Fatalf("expected the interface table walk to fail, got %v", err)
+	}
+	if mib.System.Name != "switch1" || mib.Interface[1] == nil || mib.Interface[1].Descr != "Ethernet1" {
+		t.Errorf("unexpected data: %+v", mib)
+	}
+}
+
+func TestQueryWalkerUnreachable(t *testing.T) {
+	var mib walkerMIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first root fails without any PDU: the others are not walked.
+	errTimeout := errors.New("request timeout")
+	walker := &failingWalker{failures: map[string]error{
+		"1.3.6.1.2.1.1":     errTimeout,
+		"1.3.6.1.2.1.2.2.1": errTimeout,
+	}}
+	if err := magic.QueryWalker(context.Background(), walker); err != errTimeout {
+		t.Errorf("expected the error of the first root, got %v", err)
+	}
+	if len(walker.walked) != 1 {
+		t.Errorf("expected a single root to be walked, got %v", walker.walked)
+	}
+}
+
+func TestWalkWithFallback(t *testing.T) {
+	var mib benchMIB
+	magic, err := NewSNMPMagic(&mib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recorded bytes.Buffer
+	magic.Recorder = &recorded
+	magic.MaxPDUs = 4
+
+	pdus := PDUSlice(benchInterfacePDUs(1))
+	errTooBig := errors.New("response too big")
+	// Bulk walk failing after the first 2 PDUs
+	bulkWalk := func(root string, walkFn gosnmp.WalkFunc) error {
+		if err := PDUSlice(pdus[:2]).Walk(root, walkFn); err != nil {
+			return err
+		}
+		return errTooBig
+	}
+
+	var handled []string
+	walkFn := func(pdu gosnmp.SnmpPDU) error {
+		handled = append(handled, pdu.Name)
+		return magic.HandlePDU(pdu)
+	}
+	output := captureLog(func() {
+		err = walkWithFallback("1.3.6.1.2.1.2.2.1", bulkWalk, pdus.Walk, walkFn, "10.0.0.1")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "retrying with GETNEXT") {
+		t.Errorf("expected the retry to be logged, got %q", output)
+	}
+
+	// PDUs of the failed bulk walk are handled, counted and recorded once: the
+	// 4 PDUs of the table fit in MaxPDUs.
+	if len(handled) != len(pdus) {
+		t.Errorf("expected %d PDUs to be handled, got %v", len(pdus), handled)
+	}
+	if lines := strings.Count(recorded.String(), "\n"); lines != len(pdus) {
+		t.Errorf("expected %d recorded PDUs, got %d", len(pdus), lines)
+	}
+	if entry := mib.Interface[1]; entry == nil || entry.OutOctets == 0 {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+
+	// Walks that do not fail are not retried
+	handled = nil
+	err = walkWithFallback("1.3.6.1.2.1.2.2.1", pdus.Walk, bulkWalk, func(pdu gosnmp.SnmpPDU) error {
+		handled = append(handled, pdu.Name)
+		return nil
+	}, "10.0.0.1")
+	if err != nil || len(handled) != len(pdus) {
+		t.Errorf("expected a single walk, got %v and %v", err, handled)
+	}
+}
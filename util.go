@@ -1,30 +1,68 @@
 package main
 
 import (
+	"fmt"
 	"math"
+	"net"
+	"runtime"
 	"strconv"
 	"strings"
 )
 
+import (
+	"github.com/criteo/netopticon/snmpmagic"
+)
+
+// Power reported for no signal, or anything weaker. Keeps outputs finite, as
+// log(0) = -Inf and log(x) = NaN for negative values.
+var powerFloorDBm float32 = -40
+
 func wattsToDecibellMilliwatts(watts float32) float32 {
+	if watts <= 0 {
+		return powerFloorDBm
+	}
+
 	// Simplified from 10 * log10(watts * 1000)
-	return float32(10 * (3 + math.Log10(float64(watts))))
+	dbm := float32(10 * (3 + math.Log10(float64(watts))))
+	if dbm < powerFloorDBm {
+		return powerFloorDBm
+	}
+	return dbm
+}
+
+// Inverse of wattsToDecibellMilliwatts, without the floor: -Inf dBm is 0 W.
+func decibellMilliwattsToWatts(dbm float32) float32 {
+	// Simplified from 10^(dbm / 10) / 1000
+	return float32(math.Pow(10, float64(dbm)/10-3))
 }
 
-func interfaceNameToPort(name string) (uint, bool) {
+// Converts an interface name to its port, along with its subport for breakout
+// (channelized) interfaces.
+func interfaceNameToPort(name string) (PortID, bool) {
 	if strings.HasPrefix(name, "Ethernet") {
 		// EthernetP or EthernetP/L
 		name = name[8:]
+		subport := ""
 		slashIdx := strings.IndexByte(name, '/')
 		if slashIdx > 0 {
-			name = name[:slashIdx]
+			name, subport = name[:slashIdx], name[slashIdx+1:]
 		}
 
+		// Should not be a sub-interface (e.g. Ethernet1/1.100)
 		if port, err := strconv.ParseUint(name, 10, 32); err == nil {
-			return uint(port), true
+			id := PortID{Port: uint(port)}
+			// Arista subport numbering starts at 1
+			if subport != "" {
+				sub, err := strconv.ParseUint(subport, 10, 32)
+				if err != nil {
+					return PortID{}, false
+				}
+				id.Subport = uint(sub)
+			}
+			return id, true
 		}
 	} else if strings.HasPrefix(name, "et-") {
-		// et-*/*/P
+		// et-*/*/P or et-*/*/P:C
 		// XXX: does not support multiple line cards, but should be OK.
 		slashIdx := strings.LastIndexByte(name, '/')
 		if slashIdx > 0 {
@@ -33,12 +71,154 @@ func interfaceNameToPort(name string) (uint, bool) {
 
 		// Should not be a virtual interface (e.g. et-0/0/0.0)
 		if !strings.ContainsRune(name, '.') {
+			channel := ""
+			if colonIdx := strings.IndexByte(name, ':'); colonIdx > 0 {
+				name, channel = name[:colonIdx], name[colonIdx+1:]
+			}
+
 			if port, err := strconv.ParseUint(name, 10, 32); err == nil {
-				// Juniper port numbering starts at 0
-				return uint(port + 1), true
+				// Juniper port and channel numbering starts at 0
+				id := PortID{Port: uint(port + 1)}
+				if channel != "" {
+					sub, err := strconv.ParseUint(channel, 10, 32)
+					if err != nil {
+						return PortID{}, false
+					}
+					id.Subport = uint(sub + 1)
+				}
+				return id, true
+			}
+		}
+	} else if len(name) > 0 && name[0] >= '1' && name[0] <= '9' {
+		// S/M/P or S/M/cC/P, optionally followed by ", <description>" (Nokia)
+		// XXX: does not support multiple line cards, but should be OK.
+		if commaIdx := strings.IndexByte(name, ','); commaIdx > 0 {
+			name = name[:commaIdx]
+		}
+
+		parts := strings.Split(name, "/")
+		if len(parts) >= 3 {
+			// Breakout ports are numbered after their connector.
+			portPart := parts[len(parts)-1]
+			subportPart := ""
+			if connector := parts[len(parts)-2]; strings.HasPrefix(connector, "c") {
+				portPart, subportPart = connector[1:], portPart
+			}
+
+			// Should not be a SAP or sub-interface (e.g. 1/1/5:100)
+			if port, err := strconv.ParseUint(portPart, 10, 32); err == nil {
+				// Nokia port numbering starts at 1
+				id := PortID{Port: uint(port)}
+				if subportPart != "" {
+					sub, err := strconv.ParseUint(subportPart, 10, 32)
+					if err != nil {
+						return PortID{}, false
+					}
+					id.Subport = uint(sub)
+				}
+				return id, true
+			}
+		}
+	} else if prefix, ok := ciscoInterfacePrefix(name); ok {
+		// <Type>R/S/I/P or <Type>R/S/I/P/B (e.g. TenGigE0/0/0/5/1)
+		parts := strings.Split(name[len(prefix):], "/")
+		portPart := parts[len(parts)-1]
+		subportPart := ""
+		if len(parts) == 5 {
+			portPart, subportPart = parts[3], parts[4]
+		}
+
+		// Should not be a sub-interface (e.g. TenGigE0/0/0/5.100)
+		if !strings.ContainsRune(portPart, '.') && !strings.ContainsRune(subportPart, '.') {
+			if port, err := strconv.ParseUint(portPart, 10, 32); err == nil {
+				// Cisco port and breakout numbering starts at 0
+				id := PortID{Port: uint(port + 1)}
+				if subportPart != "" {
+					sub, err := strconv.ParseUint(subportPart, 10, 32)
+					if err != nil {
+						return PortID{}, false
+					}
+					id.Subport = uint(sub + 1)
+				}
+				return id, true
+			}
+		}
+	}
+
+	return PortID{}, false
+}
+
+var ciscoInterfacePrefixes = []string{
+	"GigabitEthernet",
+	"TenGigE",
+	"TwentyFiveGigE",
+	"FortyGigE",
+	"FiftyGigE",
+	"HundredGigE",
+	"TwoHundredGigE",
+	"FourHundredGigE",
+}
+
+// Returns the Cisco interface type prefix of a name, if any.
+func ciscoInterfacePrefix(name string) (string, bool) {
+	for _, prefix := range ciscoInterfacePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return prefix, true
+		}
+	}
+	return "", false
+}
+
+// Checks whether an error returned by gosnmp is caused by a host not answering
+// in time, as opposed to e.g. a protocol or parsing error.
+func isTimeoutError(err error) bool {
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+
+	// gosnmp reports exhausted retries with a plain error.
+	return strings.Contains(err.Error(), "timeout")
+}
+
+// Checks whether a query error may not happen again on a later attempt, e.g.
+// a host briefly unreachable, as opposed to e.g. an authentication failure.
+// Partial failures are not transient, as some data was collected.
+func isTransientError(err error) bool {
+	if queryErr, ok := err.(*snmpmagic.QueryError); ok {
+		if queryErr.IsPartial() {
+			return false
+		}
+		for _, failure := range queryErr.Failures {
+			if !isTransientError(failure.Err) {
+				return false
 			}
 		}
+		return true
+	}
+
+	return isTimeoutError(err) || strings.Contains(err.Error(), "connection refused")
+}
+
+// Summarizes the innermost frames of a panicking goroutine's stack. Must be
+// called from a deferred function that recovered the panic.
+func panicStack(maxFrames int) string {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(1, pcs)])
+
+	var parts []string
+	afterPanic := false
+	for len(parts) < maxFrames {
+		frame, more := frames.Next()
+		if afterPanic && !strings.HasPrefix(frame.Function, "runtime.") {
+			parts = append(parts, fmt.Sprintf("%s:%d", frame.Function, frame.Line))
+		} else if frame.Function == "runtime.gopanic" {
+			afterPanic = true
+		}
+
+		if !more {
+			break
+		}
 	}
 
-	return ^uint(0), false
+	return strings.Join(parts, " < ")
 }
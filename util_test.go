@@ -0,0 +1,107 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestInterfaceNameToPort(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected PortID
+		ok       bool
+	}{
+		// Arista: EthernetP or EthernetP/L, numbered from 1
+		{"Ethernet5", PortID{Port: 5}, true},
+		{"Ethernet5/1", PortID{Port: 5, Subport: 1}, true},
+		{"Ethernet49/4", PortID{Port: 49, Subport: 4}, true},
+		{"Ethernet5.100", PortID{}, false},
+		{"Ethernet5/1.100", PortID{}, false},
+		{"Management1", PortID{}, false},
+
+		// Juniper: et-*/*/P or et-*/*/P:C, numbered from 0
+		{"et-0/0/0", PortID{Port: 1}, true},
+		{"et-0/0/4", PortID{Port: 5}, true},
+		{"et-0/0/4:2", PortID{Port: 5, Subport: 3}, true},
+		{"et-0/0/4.0", PortID{}, false},
+		{"et-0/0/4:x", PortID{}, false},
+
+		// Cisco: <Type>R/S/I/P or <Type>R/S/I/P/B, numbered from 0
+		{"TenGigE0/0/0/5", PortID{Port: 6}, true},
+		{"TenGigE0/0/0/5/1", PortID{Port: 6, Subport: 2}, true},
+		{"HundredGigE0/0/0/0", PortID{Port: 1}, true},
+		{"TenGigE0/0/0/5.100", PortID{}, false},
+		{"TenGigE0/0/0/5/1.100", PortID{}, false},
+
+		// Nokia: S/M/P or S/M/cC/P, optionally with a description, numbered
+		// from 1
+		{"1/1/5", PortID{Port: 5}, true},
+		{"1/1/c2/3", PortID{Port: 2, Subport: 3}, true},
+		{"1/1/5, 10-Gig Ethernet", PortID{Port: 5}, true},
+		{"1/1/c2/3, 100-Gig Ethernet", PortID{Port: 2, Subport: 3}, true},
+		{"1/1/5:100", PortID{}, false},
+		{"1/5", PortID{}, false},
+
+		{"", PortID{}, false},
+		{"lo0", PortID{}, false},
+	}
+	for _, testCase := range testCases {
+		port, ok := interfaceNameToPort(testCase.name)
+		if ok != testCase.ok || port != testCase.expected {
+			t.Errorf("%q: got %v, %v, expected %v, %v", testCase.name, port, ok, testCase.expected, testCase.ok)
+		}
+	}
+}
+
+func TestWattsToDecibellMilliwatts(t *testing.T) {
+	defer func(floor float32) { powerFloorDBm = floor }(powerFloorDBm)
+	powerFloorDBm = -40
+
+	testCases := []struct {
+		name     string
+		watts    float32
+		expected float32
+	}{
+		{"1 mW", 0.001, 0},
+		{"1 W", 1, 30},
+		{"0.5 mW", 0.0005, -3.0103},
+		// Readings of no signal are reported at the floor
+		{"zero", 0, -40},
+		{"negative", -0.001, -40},
+		{"below the floor", 1e-9, -40},
+		{"at the floor", 1e-7, -40},
+	}
+	for _, testCase := range testCases {
+		dbm := wattsToDecibellMilliwatts(testCase.watts)
+		if !approxEqual(dbm, testCase.expected) {
+			t.Errorf("%s: got %v dBm, expected %v", testCase.name, dbm, testCase.expected)
+		}
+	}
+
+	// The floor follows -dbm-floor
+	powerFloorDBm = -60
+	if dbm := wattsToDecibellMilliwatts(1e-9); !approxEqual(dbm, -60) {
+		t.Errorf("expected -60 dBm with a -60 floor, got %v", dbm)
+	}
+	if dbm := wattsToDecibellMilliwatts(1e-8); !approxEqual(dbm, -50) {
+		t.Errorf("expected -50 dBm with a -60 floor, got %v", dbm)
+	}
+}
+
+func TestDecibellMilliwattsRoundTrip(t *testing.T) {
+	for _, dbm := range []float32{-39.9, -20, -7.5, -3, 0, 0.01, 3, 10.5} {
+		if got := wattsToDecibellMilliwatts(decibellMilliwattsToWatts(dbm)); !approxEqual(got, dbm) {
+			t.Errorf("%v dBm: got %v dBm after round trip", dbm, got)
+		}
+	}
+	for _, watts := range []float32{1e-7 * 1.01, 1e-5, 0.001, 0.0025, 0.01} {
+		got := decibellMilliwattsToWatts(wattsToDecibellMilliwatts(watts))
+		if math.Abs(float64(got-watts)) > float64(watts)*1e-5 {
+			t.Errorf("%v W: got %v W after round trip", watts, got)
+		}
+	}
+
+	if watts := decibellMilliwattsToWatts(float32(math.Inf(-1))); watts != 0 {
+		t.Errorf("expected -Inf dBm to be 0 W, got %v", watts)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+)
+
+// Network device vendor, as far as extractors are concerned.
+type Vendor int
+
+const (
+	VendorUnknown Vendor = iota
+	VendorArista
+	VendorJuniper
+	VendorCisco
+	VendorNokia
+)
+
+var vendorNames = [...]string{
+	"unknown", "arista", "juniper", "cisco", "nokia",
+}
+
+func (self Vendor) String() string {
+	return vendorNames[self]
+}
+
+// sysObjectID prefixes (private enterprise numbers) of each vendor.
+var vendorObjectIDPrefixes = []struct {
+	prefix string
+	vendor Vendor
+}{
+	{".1.3.6.1.4.1.30065.", VendorArista},
+	{".1.3.6.1.4.1.2636.", VendorJuniper},
+	{".1.3.6.1.4.1.9.", VendorCisco},
+	{".1.3.6.1.4.1.6527.", VendorNokia}, // TiMetra (Alcatel-Lucent)
+}
+
+// Detects the vendor of a device from its sysObjectID.
+func detectVendor(mib *OpticsMIB) Vendor {
+	objectID := mib.System.ObjectID
+	if !strings.HasPrefix(objectID, ".") {
+		objectID = "." + objectID
+	}
+
+	for _, entry := range vendorObjectIDPrefixes {
+		if strings.HasPrefix(objectID, entry.prefix) {
+			return entry.vendor
+		}
+	}
+	return VendorUnknown
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+import (
+	"github.com/criteo/netopticon/snmpmagic"
+)
+
+import (
+	"github.com/soniah/gosnmp"
+)
+
+// Walks an OID subtree on each host and prints the PDUs received as is,
+// without mapping them to OpticsMIB. Returns the exit status.
+func walkSubtree(hosts []HostSpec, credentials *Credentials, root string) int {
+	status := 0
+	for _, host := range hosts {
+		if len(hosts) > 1 {
+			fmt.Printf("# %s\n", host.Target)
+		}
+		if err := printSubtree(host.Target, credentials.ForHost(host), root); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", host.Target, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// Walks an OID subtree on a host, printing each PDU as "name = type: value".
+func printSubtree(host string, credentials *Credentials, root string) error {
+	client, err := newClient(host, credentials)
+	if err != nil {
+		return err
+	}
+	if err := selectSNMPVersion(client, credentials); err != nil {
+		return err
+	}
+	mode := walkMode
+	// GETBULK does not exist in SNMPv1.
+	if client.Version == gosnmp.Version1 {
+		mode = snmpmagic.WalkNext
+	}
+
+	if err := client.Connect(); err != nil {
+		return err
+	}
+	defer client.Conn.Close()
+
+	walker := &snmpmagic.ClientWalker{Client: client, Mode: mode}
+	return walker.Walk(root, func(pdu gosnmp.SnmpPDU) error {
+		fmt.Printf("%s = %v: %s\n", pdu.Name, pdu.Type, formatPDUValue(pdu.Value))
+		return nil
+	})
+}
+
+// Formats a raw PDU value for display. Octet strings are quoted if printable,
+// and shown in hexadecimal otherwise (e.g. MAC addresses).
+func formatPDUValue(value interface{}) string {
+	data, ok := value.([]byte)
+	if !ok {
+		return fmt.Sprint(value)
+	}
+
+	printable := utf8.Valid(data)
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			printable = false
+			break
+		}
+	}
+	if printable {
+		return strconv.Quote(string(data))
+	}
+	return "0x" + hex.EncodeToString(data)
+}